@@ -1,37 +1,550 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"go.maqui.dev/pkg"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
 )
 
+// version is the Maqui version, set at build time with -ldflags "-X main.version=..."
+var version = "devel"
+
+// Exit codes of the maqui command. Programs run by maqui run exit with their own codes, that don't collide with these
+// for panics.
+const (
+	exitOk           = 0
+	exitCompileError = 1
+	exitUsageError   = 2
+	// exitPanic is the exit code of programs that panic
+	exitPanic = maqui.PanicExitCode
+)
+
+const usage = `Maqui is a tool for managing Maqui source code.
+
+Usage:
+
+	maqui <command> [arguments]
+
+The commands are:
+
+	build    compile a source file into an executable
+	run      compile and run a source file
+	check    report the errors of a source file without building it
+	explain  print the documentation of a diagnostic code
+	version  print the Maqui version
+
+Use "maqui help <command>" for more information about a command.
+
+The exit code is 1 if the source code has errors or the build fails, and 2 if the command is used incorrectly.
+Programs built by maqui exit with 101 when they panic.
+`
+
+// command is a maqui subcommand
+type command struct {
+	name string
+	// args is a short description of the positional arguments
+	args string
+	// description is the long form help text of the command
+	description string
+	// run executes the command with the arguments that follow its name and returns the exit code
+	run func(cmd *command, args []string) int
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{
+			name: "build",
+			args: "[flags] <file> [inputs...]",
+			description: `Build compiles a source file into an executable. By default the executable is written to the
+current directory and named after the source file, without its extension. Object files and archives (.o, .a) given
+after the source file are linked into the executable, along with the libraries given with -l. Flags can be given
+before or after the source file.
+
+The toolchain is clang, or llc and a C compiler to link. The C compiler is taken from --cc, the MAQUI_CC environment
+variable, or searched in PATH.
+
+The --emit flag stops the build at an earlier stage and writes its output instead: the tokens, the annotated AST,
+LLVM IR as text or bitcode, assembly or an object file. The output is named after the source file with the extension
+of its kind (.tokens, .ast, .ll, .bc, .s and .o), unless -o is used. Use -o - to write them to the standard output,
+which executables can't be written to.
+
+The --profile flag chooses between a debug build, the default, and a release build. Debug builds are not optimized and
+panic on failed runtime checks, such as integer divisions by zero, and assertions, printing the location and the stack
+trace of the calls. Release builds are optimized with -O2, have no checks nor assertions, and are stripped. The
+profile is recorded in the .comment section of the output.
+
+The --overflow flag sets what happens when integer arithmetic overflows: wrap keeps the low bits of the result, trap
+stops the program with a trap instruction, and check panics at the operation. Debug builds check, and release builds
+wrap. The wrappingAdd and checkedAdd built-ins, and their Sub and Mul variants, overflow the same way in every build.
+
+The -g flag adds DWARF debug information, so gdb and lldb can set breakpoints on source lines, step through the code
+and show the local variables. Executables built with -g are never stripped.`,
+			run: runBuild,
+		},
+		{
+			name: "run",
+			args: "[flags] <file> [arguments...]",
+			description: `Run compiles a source file and runs the executable, passing it the arguments that follow the
+file. The executable is removed afterwards. The exit code is the one of the program, which is 101 if it panics, or 128
+plus the signal number if the program is killed by a signal.`,
+			run: runRun,
+		},
+		{
+			name: "check",
+			args: "[flags] <file>",
+			description: `Check reports the errors of a source file without building it. Nothing is printed if the
+source file has no errors.`,
+			run: runCheck,
+		},
+		{
+			name:        "explain",
+			args:        "<code>",
+			description: `Explain prints the documentation of a diagnostic code, such as E0002.`,
+			run:         runExplain,
+		},
+		{
+			name:        "version",
+			description: `Version prints the Maqui version, and the platform maqui runs on.`,
+			run:         runVersion,
+		},
+	}
+}
+
 func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Expected one argument: source location")
-		return
+	os.Exit(dispatch(os.Args[1:]))
+}
+
+// dispatch runs the command named by the first argument and returns the exit code
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitUsageError
+	}
+
+	switch name := args[0]; name {
+	case "help", "-h", "-help", "--help":
+		return help(args[1:])
+	default:
+		if cmd := lookup(name); cmd != nil {
+			return cmd.run(cmd, args[1:])
+		}
+
+		fmt.Fprintf(os.Stderr, "maqui %s: unknown command\nRun 'maqui help' for usage.\n", name)
+		return exitUsageError
+	}
+}
+
+// help prints the usage of maqui or one of its commands
+func help(args []string) int {
+	switch len(args) {
+	case 0:
+		fmt.Print(usage)
+		return exitOk
+	case 1:
+		cmd := lookup(args[0])
+		if cmd == nil {
+			fmt.Fprintf(os.Stderr, "maqui help %s: unknown command\nRun 'maqui help' for usage.\n", args[0])
+			return exitUsageError
+		}
+
+		fs, _ := cmd.flags()
+		fs.SetOutput(os.Stdout)
+		fs.Usage()
+		return exitOk
+	default:
+		fmt.Fprintln(os.Stderr, "usage: maqui help <command>")
+		return exitUsageError
+	}
+}
+
+// lookup returns the command with the name, or nil if there's none
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
 
-	source := os.Args[1]
+	return nil
+}
 
-	c := maqui.NewCompiler(maqui.Target{
-		Arch:   maqui.X86_64,
-		Vendor: maqui.Unknown,
-		OS:     maqui.Linux,
-	})
+// buildFlags holds the flags shared by the commands that compile source files
+type buildFlags struct {
+	cc       string
+	libs     listFlag
+	libDirs  listFlag
+	emit     string
+	output   string
+	target   string
+	profile  string
+	opt      string
+	overflow string
+	debug    bool
+	format   string
+	verbose  bool
+}
 
-	compileErr, err := c.Compile(source)
+// flags returns the flag set of the command, and the values the flags are parsed into
+func (cmd *command) flags() (*flag.FlagSet, *buildFlags) {
+	fs := flag.NewFlagSet("maqui "+cmd.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: maqui %s %s\n\n%s\n", cmd.name, cmd.args, cmd.description)
+
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+
+	f := &buildFlags{}
+	switch cmd.name {
+	case "build":
+		fs.StringVar(&f.output, "o", "", "write the output to the `file`, or to the standard output if it's -")
+		fs.StringVar(&f.emit, "emit", string(maqui.EmitExe), fmt.Sprintf("`kind` of output, one of %v", maqui.Emits))
+		fallthrough
+	case "run", "check":
+		if cmd.name != "check" {
+			fs.StringVar(&f.cc, "cc", "", "use the C `compiler` to build, instead of the one in MAQUI_CC or PATH")
+			fs.Var(&f.libs, "l", "link the `library`, can be repeated")
+			fs.Var(&f.libDirs, "L", "search libraries in the `dir`, can be repeated")
+			fs.StringVar(&f.profile, "profile", maqui.ProfileDebug.Name,
+				"build `profile`: debug keeps the runtime checks and assertions, release optimizes with -O2, "+
+					"removes them and strips the executable")
+			fs.StringVar(&f.opt, "O", "", fmt.Sprintf("optimization `level`, one of %v, as in -O2. It overrides "+
+				"the level of the profile", maqui.OptLevels))
+			fs.StringVar(&f.overflow, "overflow", "", fmt.Sprintf("integer overflow `mode`, one of %v. It overrides "+
+				"the mode of the profile", maqui.Overflows))
+			fs.BoolVar(&f.debug, "g", false, "generate debug information for gdb and lldb, and don't strip the executable")
+		}
+
+		fs.StringVar(&f.target, "target", maqui.DefaultTarget.String(),
+			fmt.Sprintf("build for the target `triple` in the arch-vendor-os[-env] form, with arch one of %v",
+				maqui.Archs))
+		fs.StringVar(&f.format, "diagnostics-format", string(maqui.FormatText),
+			fmt.Sprintf("output `format` of diagnostics, one of %v. Text is written to stderr, other formats to stdout",
+				maqui.DiagnosticFormats))
+		fs.BoolVar(&f.verbose, "v", false, "print the steps of the build")
+	}
+
+	return fs, f
+}
+
+// parse parses the arguments of the command. Flags can follow the positional arguments, as in build a.mq -lm, except
+// for run, whose arguments after the source file belong to the program. If it returns false, the command must exit
+// with the returned code.
+func (cmd *command) parse(args []string, positional int) (*buildFlags, []string, int, bool) {
+	fs, f := cmd.flags()
+
+	var rest []string
+	for args = joinedFlags(args, cmd.name == "run"); ; {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, nil, exitOk, false
+			}
+
+			return nil, nil, exitUsageError, false
+		}
+
+		// The flag package stops at the first positional argument, and after --
+		parsed := len(args) - fs.NArg()
+		if fs.NArg() == 0 || cmd.name == "run" || (parsed > 0 && args[parsed-1] == "--") {
+			rest = append(rest, fs.Args()...)
+			break
+		}
+
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if len(rest) < positional || (!strings.Contains(cmd.args, "...") && len(rest) > positional) {
+		fmt.Fprintf(os.Stderr, "usage: maqui %s %s\nRun 'maqui help %s' for details.\n", cmd.name, cmd.args, cmd.name)
+		return nil, nil, exitUsageError, false
+	}
+
+	if f.format != "" && !isDiagnosticFormat(maqui.DiagnosticFormat(f.format)) {
+		fmt.Fprintf(os.Stderr, "maqui %s: unknown diagnostics format %q, expected one of %v\n",
+			cmd.name, f.format, maqui.DiagnosticFormats)
+		return nil, nil, exitUsageError, false
+	}
+
+	if f.emit != "" && !isEmit(maqui.Emit(f.emit)) {
+		fmt.Fprintf(os.Stderr, "maqui %s: unknown output kind %q, expected one of %v\n", cmd.name, f.emit, maqui.Emits)
+		return nil, nil, exitUsageError, false
+	}
+
+	return f, rest, exitOk, true
+}
+
+// compiler creates a compiler configured by the flags, that links the inputs into executables. If it returns false,
+// the command must exit with usage error.
+func (cmd *command) compiler(f *buildFlags, output string, inputs []string) (*maqui.Compiler, bool) {
+	target, err := maqui.ParseTarget(f.target)
 	if err != nil {
-		panic(err.Error())
+		fmt.Fprintf(os.Stderr, "maqui %s: %v\n", cmd.name, err)
+		return nil, false
+	}
+
+	profile := maqui.ProfileDebug
+	if f.profile != "" {
+		if profile, err = maqui.ParseProfile(f.profile); err != nil {
+			fmt.Fprintf(os.Stderr, "maqui %s: %v\n", cmd.name, err)
+			return nil, false
+		}
+	}
+
+	if f.opt != "" {
+		if profile.Opt, err = maqui.ParseOptLevel(f.opt); err != nil {
+			fmt.Fprintf(os.Stderr, "maqui %s: %v\n", cmd.name, err)
+			return nil, false
+		}
 	}
 
-	if len(compileErr) != 0 {
-		for _, err := range compileErr {
-			fmt.Println(err)
+	if f.overflow != "" {
+		if profile.Overflow, err = maqui.ParseOverflow(f.overflow); err != nil {
+			fmt.Fprintf(os.Stderr, "maqui %s: %v\n", cmd.name, err)
+			return nil, false
+		}
+	}
+
+	options := maqui.Options{
+		Target:  target,
+		Profile: profile,
+		Debug:   f.debug,
+		Emit:    maqui.Emit(f.emit),
+		Output:  output,
+		CC:      f.cc,
+		Link: maqui.LinkOptions{
+			Libraries:    f.libs,
+			LibraryPaths: f.libDirs,
+			Inputs:       inputs,
+		},
+	}
+
+	if f.verbose {
+		options.Log = os.Stderr
+	}
+
+	return maqui.NewCompiler(options), true
+}
+
+func runBuild(cmd *command, args []string) int {
+	f, args, code, ok := cmd.parse(args, 1)
+	if !ok {
+		return code
+	}
+
+	linked := f.emit == string(maqui.EmitExe)
+	if linked && f.output == maqui.Stdout {
+		fmt.Fprintln(os.Stderr, "maqui build: executables can't be written to the standard output, use --emit to "+
+			"write another kind of output")
+		return exitUsageError
+	}
+
+	if !linked && (len(args) > 1 || len(f.libs) > 0 || len(f.libDirs) > 0) {
+		fmt.Fprintf(os.Stderr, "maqui build: inputs and libraries are only linked into executables, not with --emit=%s\n",
+			f.emit)
+		return exitUsageError
+	}
+
+	c, ok := cmd.compiler(f, f.output, args[1:])
+	if !ok {
+		return exitUsageError
+	}
+
+	compileErrs, err := c.Compile(args[0])
+	return cmd.report(f, args[0], compileErrs, err)
+}
+
+func runRun(cmd *command, args []string) int {
+	f, args, code, ok := cmd.parse(args, 1)
+	if !ok {
+		return code
+	}
+
+	dir, err := os.MkdirTemp("", "maqui-run-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "maqui run: %v\n", err)
+		return exitCompileError
+	}
+	defer os.RemoveAll(dir)
+
+	exe := filepath.Join(dir, "main")
+	c, ok := cmd.compiler(f, exe, nil)
+	if !ok {
+		return exitUsageError
+	}
+
+	compileErrs, err := c.Compile(args[0])
+	if code := cmd.report(f, args[0], compileErrs, err); code != exitOk {
+		return code
+	}
+
+	if f.verbose {
+		fmt.Fprintln(os.Stderr, strings.Join(append([]string{exe}, args[1:]...), " "))
+	}
+
+	program := exec.Command(exe, args[1:]...)
+	program.Stdin = os.Stdin
+	program.Stdout = os.Stdout
+	program.Stderr = os.Stderr
+
+	if err := program.Run(); err != nil {
+		return programExit(err)
+	}
+
+	return exitOk
+}
+
+// programExit returns the exit code of run for a program that failed. It's the exit code of the program, or 128 plus
+// the signal number if the program was killed by a signal, as in shells. Signals and programs that couldn't be run are
+// reported.
+func programExit(err error) int {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		fmt.Fprintf(os.Stderr, "maqui run: %v\n", err)
+		return exitCompileError
+	}
+
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		fmt.Fprintf(os.Stderr, "maqui run: program killed by signal %d (%v)\n", status.Signal(), status.Signal())
+		return 128 + int(status.Signal())
+	}
+
+	return exitErr.ExitCode()
+}
+
+func runCheck(cmd *command, args []string) int {
+	f, args, code, ok := cmd.parse(args, 1)
+	if !ok {
+		return code
+	}
+
+	c, ok := cmd.compiler(f, "", nil)
+	if !ok {
+		return exitUsageError
+	}
+
+	compileErrs, err := c.Check(args[0])
+	return cmd.report(f, args[0], compileErrs, err)
+}
+
+func runExplain(cmd *command, args []string) int {
+	_, args, code, ok := cmd.parse(args, 1)
+	if !ok {
+		return code
+	}
+
+	text, ok := maqui.Explain(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "maqui explain: unknown diagnostic code %q\n", args[0])
+		return exitUsageError
+	}
+
+	fmt.Print(text)
+	return exitOk
+}
+
+func runVersion(cmd *command, args []string) int {
+	if _, _, code, ok := cmd.parse(args, 0); !ok {
+		return code
+	}
+
+	fmt.Printf("maqui version %s %s/%s\n", version, runtime.GOOS, runtime.GOARCH)
+	return exitOk
+}
+
+// report prints the diagnostics and the error of a compilation, and returns the exit code
+func (cmd *command) report(f *buildFlags, filename string, compileErrs []maqui.CompileError, err error) int {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "maqui %s: %v\n", cmd.name, err)
+		return exitCompileError
+	}
+
+	format := maqui.DiagnosticFormat(f.format)
+	if len(compileErrs) != 0 || format == maqui.FormatSARIF {
+		// Without the source the diagnostics are still reported, only the snippets are missing
+		src, _ := os.ReadFile(filename)
+
+		var out io.Writer = os.Stdout
+		if format == maqui.FormatText {
+			out = os.Stderr
+		}
+
+		if err := maqui.WriteDiagnostics(out, format, compileErrs, src); err != nil {
+			fmt.Fprintf(os.Stderr, "maqui %s: %v\n", cmd.name, err)
+			return exitCompileError
+		}
+	}
+
+	if maqui.HasErrors(compileErrs) {
+		return exitCompileError
+	}
+
+	return exitOk
+}
+
+// isDiagnosticFormat returns true if the format is one of the supported diagnostic formats
+func isDiagnosticFormat(format maqui.DiagnosticFormat) bool {
+	for _, f := range maqui.DiagnosticFormats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isEmit returns true if the kind of output is supported by the compiler
+func isEmit(emit maqui.Emit) bool {
+	for _, e := range maqui.Emits {
+		if e == emit {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listFlag is a flag that can be repeated, holding all its values
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// joinedFlags rewrites flags joined with their value, as in -lm, -L/usr/lib or -O2, into a form the flag package
+// understands (-l=m). The arguments after -- are kept as they are, and if untilSource is set, the arguments after the
+// source file too, as they belong to the program being run.
+func joinedFlags(args []string, untilSource bool) []string {
+	rewritten := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" || (untilSource && strings.HasSuffix(arg, ".mq")) {
+			return append(rewritten, args[i:]...)
+		}
+
+		if len(arg) > 2 && (arg[:2] == "-l" || arg[:2] == "-L" || arg[:2] == "-O") && arg[2] != '=' {
+			arg = arg[:2] + "=" + arg[2:]
 		}
 
-		return
+		rewritten = append(rewritten, arg)
 	}
 
-	fmt.Println("Ok")
+	return rewritten
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		name   string
+		cmd    string
+		args   []string
+		expect []string
+		libs   []string
+		opt    string
+	}{
+		{"FlagsBeforeFile", "build", []string{"-lm", "-O2", "a.mq", "b.o"}, []string{"a.mq", "b.o"}, []string{"m"}, "2"},
+		{"FlagsAfterFile", "build", []string{"a.mq", "-lm", "-O2"}, []string{"a.mq"}, []string{"m"}, "2"},
+		{"FlagsBetweenInputs", "build", []string{"a.mq", "b.o", "-l", "m", "c.a"}, []string{"a.mq", "b.o", "c.a"},
+			[]string{"m"}, ""},
+		{"EndOfFlags", "build", []string{"a.mq", "--", "-lm"}, []string{"a.mq", "-lm"}, nil, ""},
+		{"CheckFlagsAfterFile", "check", []string{"a.mq", "-v"}, []string{"a.mq"}, nil, ""},
+		{"ProgramArguments", "run", []string{"-O2", "a.mq", "-lm", "-O1"}, []string{"a.mq", "-lm", "-O1"}, nil, "2"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, args, code, ok := lookup(c.cmd).parse(c.args, 1)
+			if assert.True(t, ok) {
+				assert.Equal(t, exitOk, code)
+				assert.Equal(t, c.expect, args)
+				assert.Equal(t, c.libs, []string(f.libs))
+				assert.Equal(t, c.opt, f.opt)
+			}
+		})
+	}
+}
+
+func TestParseUsageError(t *testing.T) {
+	cases := []struct {
+		name string
+		cmd  string
+		args []string
+	}{
+		{"UnknownFlagAfterFile", "build", []string{"a.mq", "-unknown"}},
+		{"ExtraArgument", "check", []string{"a.mq", "-v", "b.mq"}},
+		{"MissingFile", "build", []string{"-lm"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, code, ok := lookup(c.cmd).parse(c.args, 1)
+			assert.False(t, ok)
+			assert.Equal(t, exitUsageError, code)
+		})
+	}
+}
+
+func TestProgramExit(t *testing.T) {
+	cases := []struct {
+		name   string
+		script string
+		expect int
+	}{
+		{"ExitCode", "exit 3", 3},
+		{"Signal", "kill -SEGV $$", 128 + int(syscall.SIGSEGV)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := exec.Command("sh", "-c", c.script).Run()
+			assert.Equal(t, c.expect, programExit(err))
+		})
+	}
+
+	assert.Equal(t, exitCompileError, programExit(exec.Command("does-not-exist").Run()))
+}
+
+func TestBuildExecutableToStdout(t *testing.T) {
+	assert.Equal(t, exitUsageError, runBuild(lookup("build"), []string{"-o", "-", "does-not-exist.mq"}))
+}
+
+func TestExitCodesDocumented(t *testing.T) {
+	panics := fmt.Sprintf("exit with %d when they panic", exitPanic)
+	assert.Contains(t, usage, panics)
+	assert.Contains(t, lookup("run").description, fmt.Sprintf("which is %d if it panics", exitPanic))
+
+	for _, code := range []int{exitOk, exitCompileError, exitUsageError} {
+		assert.NotEqual(t, code, exitPanic)
+	}
+}
@@ -5,7 +5,6 @@ go 1.18
 require (
 	github.com/llir/llvm v0.3.6
 	github.com/stretchr/testify v1.8.0
-	golang.org/x/sync v0.1.0
 )
 
 require (
@@ -1,40 +1,367 @@
 package maqui
 
 import (
+	"unicode/utf8"
+
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
 	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// runtimePrefix starts the symbols of the runtime library. The dot is not valid in identifiers, so the symbols can't
+// collide with user definitions.
+const runtimePrefix = "maqui."
+
+// builtinRuneToString is the symbol of the internal function used to convert runes into strings
+const builtinRuneToString = runtimePrefix + "runeToString"
+
+// builtinConcat is the symbol of the internal function that concatenates two strings, used by the string addition
+const builtinConcat = runtimePrefix + "concat"
+
+// The printers write a value with a format of C. The print built-ins are emitted as calls to them, see formatArg.
+const (
+	builtinPrintInt    = runtimePrefix + "printInt"
+	builtinPrintFloat  = runtimePrefix + "printFloat"
+	builtinPrintString = runtimePrefix + "printString"
 )
 
-func defineBuiltins(b *LLVMIRBuilder) {
-	defineBuiltinFunc(b, "print", builtinPrint)
+// The string builders build the strings with embedded expressions. The appenders write a value with a format of C at
+// the end of the string, see formatArg.
+const (
+	builtinNewBuilder    = runtimePrefix + "newBuilder"
+	builtinAppendInt     = runtimePrefix + "appendInt"
+	builtinAppendFloat   = runtimePrefix + "appendFloat"
+	builtinAppendString  = runtimePrefix + "appendString"
+	builtinBuilderString = runtimePrefix + "builderString"
+)
+
+// builtinFunc is a function provided by Maqui. Its single definition gives the signature to the semantic analysis,
+// declares the function in the generated modules and defines it in the runtime library, so they can't get out of sync.
+type builtinFunc struct {
+	// name is the name used in Maqui code. It's empty for the internal functions of the runtime.
+	name string
+	// symbol is the name of the function in the runtime library. If empty, it's the name with the runtimePrefix.
+	symbol string
+	// typ is the signature in Maqui code, only set for the functions with a name
+	typ *FuncType
+	// define builds the function into the runtime library. It's nil for the built-ins the compiler emits inline, such
+	// as assert.
+	define funcDefinition
+}
+
+// builtinFuncs is the registry of the built-in functions. They're defined in order, after the functions they call.
+var builtinFuncs = []builtinFunc{
+	{symbol: runtimePanic, define: runtimePanicFunc},
+	{symbol: runtimeAlloc, define: runtimeAllocFunc},
+	{symbol: runtimeEnter, define: runtimeEnterFunc},
+	{symbol: runtimeLeave, define: runtimeLeaveFunc},
+	{symbol: runtimeCall, define: runtimeCallFunc},
+	{symbol: builtinRuneToString, define: builtinRuneString},
+	{symbol: builtinConcat, define: builtinConcatFunc},
+	{symbol: builtinPrintInt, define: builtinPrinter(types.I64)},
+	{symbol: builtinPrintFloat, define: builtinPrinter(types.Double)},
+	{symbol: builtinPrintString, define: builtinPrinter(types.I8Ptr)},
+	{symbol: builtinNewBuilder, define: builtinNewBuilderFunc},
+	{symbol: builtinAppendInt, define: builtinAppender(types.I64)},
+	{symbol: builtinAppendFloat, define: builtinAppender(types.Double)},
+	{symbol: builtinAppendString, define: builtinAppender(types.I8Ptr)},
+	{symbol: builtinBuilderString, define: builtinBuilderStringFunc},
+	{name: "print", typ: variadicSignature()},
+	{name: "println", typ: variadicSignature()},
+	{name: "printf", typ: variadicSignature(&ArgumentType{Name: "format", Type: &BasicType{"string"}})},
+	{name: "assert", typ: signature(&BasicType{"bool"})},
+	{name: "panic", typ: signature(&BasicType{"string"})},
+	{name: "formatInt", typ: signature(&BasicType{"int64"}, &BasicType{"string"}), define: builtinFormatInt},
+	{name: "formatFloat", typ: signature(&BasicType{"float64"}, &BasicType{"string"}), define: builtinFormatFloat},
+	{name: "parseInt", typ: signature(&BasicType{"string"}, &BasicType{"int64"}), define: builtinParseInt},
+	{name: "parseFloat", typ: signature(&BasicType{"string"}, &BasicType{"float64"}), define: builtinParseFloat},
+	{name: "wrappingAdd", typ: integerSignature()},
+	{name: "wrappingSub", typ: integerSignature()},
+	{name: "wrappingMul", typ: integerSignature()},
+	{name: "checkedAdd", typ: integerSignature()},
+	{name: "checkedSub", typ: integerSignature()},
+	{name: "checkedMul", typ: integerSignature()},
+}
+
+// signature returns the type of a built-in that takes an argument, and optionally returns a value
+func signature(arg Type, ret ...Type) *FuncType {
+	names := map[string]string{"bool": "cond", "string": "s"}
+
+	name := "v"
+	if n, ok := names[arg.String()]; ok {
+		name = n
+	}
+
+	return &FuncType{Args: []*ArgumentType{{Name: name, Type: arg}}, Returns: ret}
 }
 
-type funcDefinition = func(mod *ir.Module) *ir.Func
+// variadicSignature returns the type of a built-in that takes the arguments, followed by any number of values of any
+// type
+func variadicSignature(args ...*ArgumentType) *FuncType {
+	return &FuncType{Args: append(args, &ArgumentType{Name: "args", Type: &AnyType{}}), Variadic: true}
+}
 
-func defineBuiltinFunc(b *LLVMIRBuilder, name string, definition funcDefinition) {
-	f := definition(b.mod)
-	f.SetName(name)
-	b.values.Set(name, f)
+// integerSignature returns the type of the built-ins generic over the integer types, which take two operands
+func integerSignature() *FuncType {
+	return &FuncType{
+		Args:    []*ArgumentType{{Name: "a", Type: &IntegerParam{}}, {Name: "b", Type: &IntegerParam{}}},
+		Returns: []Type{&IntegerParam{}},
+	}
 }
 
-func builtinPrint(mod *ir.Module) *ir.Func {
-	f := mod.NewFunc("", types.Void, ir.NewParam("v", types.I32))
-	b := f.NewBlock("")
+// symbolName returns the symbol of the function in the runtime library
+func (f builtinFunc) symbolName() string {
+	if f.symbol != "" {
+		return f.symbol
+	}
+
+	return runtimePrefix + f.name
+}
+
+// declareBuiltins declares the functions of the runtime library in the module being built. The declarations are
+// taken from the definitions of the runtime, and they're looked up by their Maqui name, or by their symbol if they
+// have none.
+func declareBuiltins(b *LLVMIRBuilder, runtime *ir.Module) {
+	for _, f := range builtinFuncs {
+		if f.name != "" {
+			b.builtins[f.name] = true
+		}
+
+		if f.define == nil {
+			continue
+		}
+
+		def := lookupFunc(runtime, f.symbolName())
+
+		var params []*ir.Param
+		for _, p := range def.Params {
+			params = append(params, ir.NewParam(p.Name(), p.Type()))
+		}
 
-	printf := mod.NewFunc("printf", types.I32, ir.NewParam("format", types.I8Ptr))
-	printf.Sig.Variadic = true
+		decl := b.mod.NewFunc(def.Name(), def.Sig.RetType, params...)
+		decl.Sig.Variadic = def.Sig.Variadic
+		decl.FuncAttrs = def.FuncAttrs
 
+		key := f.name
+		if key == "" {
+			key = f.symbolName()
+		}
+
+		b.values.Set(key, decl)
+	}
+}
+
+// arithmeticBuiltin is an integer operation with its own overflow mode, whatever the mode of the build
+type arithmeticBuiltin struct {
+	operation BinaryOp
+	mode      Overflow
+}
+
+// arithmeticBuiltins maps the names of the built-ins generic over the integer types to their operation. They are
+// emitted inline, as their operands can be of any integer type, see integerSignature.
+var arithmeticBuiltins = map[string]arithmeticBuiltin{
+	"wrappingAdd": {BinaryAddition, OverflowWrap},
+	"wrappingSub": {BinarySubtraction, OverflowWrap},
+	"wrappingMul": {BinaryMultiplication, OverflowWrap},
+	"checkedAdd":  {BinaryAddition, OverflowCheck},
+	"checkedSub":  {BinarySubtraction, OverflowCheck},
+	"checkedMul":  {BinaryMultiplication, OverflowCheck},
+}
+
+// funcDefinition builds a function into a module for a target with the sizes
+type funcDefinition = func(mod *ir.Module, s sizes) *ir.Func
+
+// externalFunc declares a function provided by the C standard library. If the function was already declared by another
+// built-in, the existing declaration is returned.
+func externalFunc(mod *ir.Module, name string, ret types.Type, variadic bool, params ...*ir.Param) *ir.Func {
+	if f := lookupFunc(mod, name); f != nil {
+		return f
+	}
+
+	f := mod.NewFunc(name, ret, params...)
+	f.Sig.Variadic = variadic
+
+	return f
+}
+
+// sizeT returns the type of size_t, the unsigned integer as large as a pointer of the target
+func sizeT(s sizes) *types.IntType {
+	return types.NewInt(uint64(s.word))
+}
+
+// lookupFunc returns the function of the module with the name, or nil if there's none
+func lookupFunc(mod *ir.Module, name string) *ir.Func {
+	for _, f := range mod.Funcs {
+		if f.Name() == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+// globalString defines a null-terminated string as a global and returns a pointer to its first character
+func globalString(mod *ir.Module, name string, str string) constant.Constant {
 	zero := constant.NewInt(types.I32, 0)
 
-	format := constant.NewCharArrayFromString("%d\n")
-	formatGlob := mod.NewGlobalDef("._printf_fmt", format)
+	data := constant.NewCharArrayFromString(str + "\x00")
+	glob := mod.NewGlobalDef(name, data)
+	glob.Immutable = true
+
+	return constant.NewGetElementPtr(data.Typ, glob, zero, zero)
+}
+
+// builtinFormat defines a function that formats a single value into a newly allocated string using snprintf
+func builtinFormat(mod *ir.Module, s sizes, name string, param types.Type, format string, size int64) *ir.Func {
+	f := mod.NewFunc("", types.I8Ptr, ir.NewParam("v", param))
+	b := f.NewBlock("")
+
+	snprintf := externalFunc(mod, "snprintf", types.I32, true,
+		ir.NewParam("buf", types.I8Ptr),
+		ir.NewParam("size", sizeT(s)),
+		ir.NewParam("format", types.I8Ptr),
+	)
+
+	buf := b.NewCall(lookupFunc(mod, runtimeAlloc), constant.NewInt(sizeT(s), size))
+	fmtAddr := globalString(mod, name, format)
+
+	b.NewCall(snprintf, buf, constant.NewInt(sizeT(s), size), fmtAddr, f.Params[0])
+	b.NewRet(buf)
+
+	return f
+}
+
+func builtinFormatInt(mod *ir.Module, s sizes) *ir.Func {
+	return builtinFormat(mod, s, "maqui.fmt_int", types.I64, "%lld", 21)
+}
+
+func builtinFormatFloat(mod *ir.Module, s sizes) *ir.Func {
+	return builtinFormat(mod, s, "maqui.fmt_float", types.Double, "%g", 32)
+}
+
+// builtinParseInt parses a decimal integer from a string. Invalid strings are parsed as 0.
+func builtinParseInt(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.I64, ir.NewParam("s", types.I8Ptr))
+	b := f.NewBlock("")
+
+	strtoll := externalFunc(mod, "strtoll", types.I64, false,
+		ir.NewParam("str", types.I8Ptr),
+		ir.NewParam("end", types.NewPointer(types.I8Ptr)),
+		ir.NewParam("base", types.I32),
+	)
+
+	v := b.NewCall(strtoll, f.Params[0], constant.NewNull(types.NewPointer(types.I8Ptr)), constant.NewInt(types.I32, 10))
+	b.NewRet(v)
+
+	return f
+}
+
+// builtinParseFloat parses a floating point number from a string. Invalid strings are parsed as 0.
+func builtinParseFloat(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.Double, ir.NewParam("s", types.I8Ptr))
+	b := f.NewBlock("")
+
+	strtod := externalFunc(mod, "strtod", types.Double, false,
+		ir.NewParam("str", types.I8Ptr),
+		ir.NewParam("end", types.NewPointer(types.I8Ptr)),
+	)
+
+	v := b.NewCall(strtod, f.Params[0], constant.NewNull(types.NewPointer(types.I8Ptr)))
+	b.NewRet(v)
+
+	return f
+}
+
+// builtinRuneString encodes a rune as a newly allocated UTF-8 string. Runes outside the Unicode range and surrogate
+// halves are encoded as the replacement character (U+FFFD).
+func builtinRuneString(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.I8Ptr, ir.NewParam("r", types.I32))
+	entry := f.NewBlock("")
+
+	buf := entry.NewCall(lookupFunc(mod, runtimeAlloc), constant.NewInt(sizeT(s), utf8.UTFMax+1))
+
+	i32 := func(v int64) constant.Constant {
+		return constant.NewInt(types.I32, v)
+	}
+
+	outOfRange := entry.NewICmp(enum.IPredUGT, f.Params[0], i32(utf8.MaxRune))
+	surrogateLow := entry.NewICmp(enum.IPredUGE, f.Params[0], i32(0xD800))
+	surrogateHigh := entry.NewICmp(enum.IPredULE, f.Params[0], i32(0xDFFF))
+	surrogate := entry.NewAnd(surrogateLow, surrogateHigh)
+	invalid := entry.NewOr(outOfRange, surrogate)
+	r := entry.NewSelect(invalid, i32(utf8.RuneError), f.Params[0])
+
+	// store writes the byte (prefix | (r >> shift) & mask) at the position i of the buffer
+	store := func(b *ir.Block, i int64, prefix int64, shift int64, mask int64) {
+		var v value.Value = r
+		if shift != 0 {
+			v = b.NewLShr(v, i32(shift))
+		}
+
+		v = b.NewAnd(v, i32(mask))
+		v = b.NewOr(v, i32(prefix))
+
+		ptr := b.NewGetElementPtr(types.I8, buf, constant.NewInt(types.I64, i))
+		b.NewStore(b.NewTrunc(v, types.I8), ptr)
+	}
+
+	terminate := func(b *ir.Block, i int64) {
+		ptr := b.NewGetElementPtr(types.I8, buf, constant.NewInt(types.I64, i))
+		b.NewStore(constant.NewInt(types.I8, 0), ptr)
+		b.NewRet(buf)
+	}
+
+	one, two, three, four := f.NewBlock(""), f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+	checkTwo, checkThree := f.NewBlock(""), f.NewBlock("")
+
+	entry.NewCondBr(entry.NewICmp(enum.IPredULT, r, i32(0x80)), one, checkTwo)
+	checkTwo.NewCondBr(checkTwo.NewICmp(enum.IPredULT, r, i32(0x800)), two, checkThree)
+	checkThree.NewCondBr(checkThree.NewICmp(enum.IPredULT, r, i32(0x10000)), three, four)
+
+	store(one, 0, 0, 0, 0x7F)
+	terminate(one, 1)
+
+	store(two, 0, 0xC0, 6, 0x1F)
+	store(two, 1, 0x80, 0, 0x3F)
+	terminate(two, 2)
+
+	store(three, 0, 0xE0, 12, 0x0F)
+	store(three, 1, 0x80, 6, 0x3F)
+	store(three, 2, 0x80, 0, 0x3F)
+	terminate(three, 3)
+
+	store(four, 0, 0xF0, 18, 0x07)
+	store(four, 1, 0x80, 12, 0x3F)
+	store(four, 2, 0x80, 6, 0x3F)
+	store(four, 3, 0x80, 0, 0x3F)
+	terminate(four, 4)
+
+	return f
+}
+
+// builtinConcatFunc concatenates two strings into a newly allocated string
+func builtinConcatFunc(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.I8Ptr, ir.NewParam("a", types.I8Ptr), ir.NewParam("b", types.I8Ptr))
+	b := f.NewBlock("")
 
-	fmtAddr := constant.NewGetElementPtr(types.NewArray(3, types.I8), formatGlob, zero, zero)
+	strlen := externalFunc(mod, "strlen", sizeT(s), false, ir.NewParam("s", types.I8Ptr))
+	memcpy := externalFunc(mod, "memcpy", types.I8Ptr, false,
+		ir.NewParam("dst", types.I8Ptr),
+		ir.NewParam("src", types.I8Ptr),
+		ir.NewParam("size", sizeT(s)),
+	)
 
-	b.NewCall(printf, fmtAddr, f.Params[0])
+	len1 := b.NewCall(strlen, f.Params[0])
+	len2 := b.NewCall(strlen, f.Params[1])
+	one := constant.NewInt(sizeT(s), 1)
 
-	b.NewRet(nil)
+	// The terminator of the second string is copied too
+	buf := b.NewCall(lookupFunc(mod, runtimeAlloc), b.NewAdd(b.NewAdd(len1, len2), one))
+	b.NewCall(memcpy, buf, f.Params[0], len1)
+	b.NewCall(memcpy, b.NewGetElementPtr(types.I8, buf, len1), f.Params[1], b.NewAdd(len2, one))
+	b.NewRet(buf)
 
 	return f
 }
@@ -1,51 +1,181 @@
 package maqui
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"os/exec"
-
-	"golang.org/x/sync/errgroup"
+	"path/filepath"
+	"strings"
 )
 
-type Arch string
-type Vendor string
-type OS string
+// Emit is a kind of output the Compiler can produce. Each kind is the output of a stage of the compilation pipeline.
+type Emit string
 
 const (
-	X86_64 Arch = "x86_64"
-
-	Unknown Vendor = "unknown"
-
-	Windows OS = "windows64"
-	Linux   OS = "linux"
-	Darwin  OS = "darwin"
+	// EmitTokens writes the tokens produced by the lexer, one per line
+	EmitTokens Emit = "tokens"
+	// EmitAST writes the annotated AST as an indented tree, including the resolved types
+	EmitAST Emit = "ast"
+	// EmitLLVMIR writes the generated LLVM IR in its textual form
+	EmitLLVMIR Emit = "llvm-ir"
+	// EmitLLVMBC writes the generated LLVM IR as bitcode
+	EmitLLVMBC Emit = "llvm-bc"
+	// EmitAsm writes the assembly code for the target
+	EmitAsm Emit = "asm"
+	// EmitObj writes an object file, that can be linked with other object files. Executables also link the runtime
+	// library, whose object is cached in the MAQUI_CACHE directory, see the build log of -v.
+	EmitObj Emit = "obj"
+	// EmitExe writes a linked executable. It's the default.
+	EmitExe Emit = "exe"
 )
 
-type Target struct {
-	Arch   Arch
-	Vendor Vendor
-	OS     OS
-}
+// Emits holds all the supported kinds of output, in pipeline order
+var Emits = []Emit{EmitTokens, EmitAST, EmitLLVMIR, EmitLLVMBC, EmitAsm, EmitObj, EmitExe}
 
-func (t Target) String() string {
-	return fmt.Sprintf("%s-%s-%s", t.Arch, t.Vendor, t.OS)
+// Stdout is the output path that writes to the standard output instead of a file
+const Stdout = "-"
+
+// Options configures a Compiler
+type Options struct {
+	// Target is the platform the output is built for. If empty, the DefaultTarget is used.
+	Target Target
+	// Profile holds the optimization level and the checks of the build. If empty, the ProfileDebug is used.
+	Profile Profile
+	// Debug generates the DWARF debug information, so debuggers can set breakpoints on source lines and show local
+	// variables. Stripping is disabled for debuggable builds, as it would remove the information.
+	Debug bool
+	// Emit is the kind of output produced. If empty, an executable is built.
+	Emit Emit
+	// Output is the path where the output is written, or [Stdout] for every kind but executables. If empty, the name of
+	// the source file is used, with the extension replaced by the one of the output kind.
+	Output string
+	// Log receives a description of each step of the build, such as the external commands being run. If nil, nothing
+	// is logged.
+	Log io.Writer
+	// CC is the C compiler used to build the output, see [FindToolchain]. If empty, it's searched for.
+	CC string
+	// Link holds the libraries and files linked into executables
+	Link LinkOptions
 }
 
 type Compiler struct {
-	target Target
+	options Options
+	// toolchain is found the first time it's needed
+	toolchain *Toolchain
 }
 
-func NewCompiler(target Target) *Compiler {
+func NewCompiler(options Options) *Compiler {
+	if options.Emit == "" {
+		options.Emit = EmitExe
+	}
+
+	if options.Target == (Target{}) {
+		options.Target = DefaultTarget
+	}
+
+	if options.Profile == (Profile{}) {
+		options.Profile = ProfileDebug
+	}
+
+	if options.Debug {
+		options.Profile.Strip = false
+	}
+
 	return &Compiler{
-		target: target,
+		options: options,
+	}
+}
+
+// Check analyzes the source file without building it. The returned error is only set if the file couldn't be read,
+// problems in the source code are reported as compile errors.
+func (c *Compiler) Check(filename string) ([]CompileError, error) {
+	ast, err := c.analyze(filename)
+	if err != nil {
+		return nil, err
 	}
+
+	return ast.Errors, nil
 }
 
+// Compile runs the compilation pipeline over the source file until the stage of the output kind, and writes its
+// output. Tokens and the AST are written even if the source code has errors, the rest of the outputs are only written
+// if there are no compile errors.
 func (c *Compiler) Compile(filename string) ([]CompileError, error) {
+	output := c.output(filename)
+	if output == Stdout && c.options.Emit == EmitExe {
+		return nil, errors.New("executables can't be written to the standard output")
+	}
+
+	if c.options.Emit == EmitTokens {
+		return c.tokens(filename, output)
+	}
+
+	ast, err := c.analyze(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.options.Emit == EmitAST {
+		return ast.Errors, c.write(output, func(w io.Writer) error {
+			return DumpAST(w, ast)
+		})
+	}
+
+	if HasErrors(ast.Errors) {
+		return ast.Errors, nil
+	}
+
+	c.logf("profile %s", c.options.Profile)
+
+	gen := NewLLVMGenerator(ast)
+	gen.SetProfile(c.options.Profile)
+	gen.SetDebugInfo(c.options.Debug)
+	ir := gen.Do()
+
+	if c.options.Emit == EmitLLVMIR {
+		return ast.Errors, c.write(output, func(w io.Writer) error {
+			_, err := io.WriteString(w, ir.String())
+			return err
+		})
+	}
+
+	errs, err := c.build(ir, output)
+	return append(ast.Errors, errs...), err
+}
+
+// tokens writes the tokens of the source file. Lexer errors are returned as compile errors.
+func (c *Compiler) tokens(filename string, output string) ([]CompileError, error) {
+	lexer, err := NewLexer(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	go lexer.Do()
+
+	var tokens []Token
+	var errs []CompileError
+	for tok := lexer.Get(); tok.Typ != TokenEOF; tok = lexer.Get() {
+		tokens = append(tokens, tok)
+
+		if tok.Typ == TokenError {
+			errs = append(errs, &BadExprError{
+				Loc:  tok.Loc,
+				Expr: &BadExpr{Location: tok.Loc, Error: tok.Value},
+			})
+		}
+	}
+
+	return errs, c.write(output, func(w io.Writer) error {
+		return DumpTokens(w, tokens)
+	})
+}
+
+// analyze runs the lexer, parser and semantic analysis over the source file
+func (c *Compiler) analyze(filename string) (*AST, error) {
 	lexer, err := NewLexer(filename)
 	if err != nil {
 		return nil, err
@@ -53,66 +183,198 @@ func (c *Compiler) Compile(filename string) ([]CompileError, error) {
 
 	parser := NewParser(lexer)
 	analyzer := NewContextAnalyser(parser)
+	analyzer.SetTarget(c.options.Target)
 
 	global := NewGlobalSymbolTable()
 	analyzer.DefineInto(global)
 
-	ast := analyzer.Do(global)
-	if len(ast.Errors) != 0 {
-		return ast.Errors, nil
+	return analyzer.Do(global), nil
+}
+
+// output returns the path of the output built from the source file
+func (c *Compiler) output(filename string) string {
+	if c.options.Output != "" {
+		return c.options.Output
 	}
 
-	gen := NewLLVMGenerator(ast)
-	ir := gen.Do()
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)) + c.extension()
+}
+
+// extension returns the file extension of the output kind for the target
+func (c *Compiler) extension() string {
+	windows := c.options.Target.OS == Windows
+
+	switch c.options.Emit {
+	case EmitTokens:
+		return ".tokens"
+	case EmitAST:
+		return ".ast"
+	case EmitLLVMIR:
+		return ".ll"
+	case EmitLLVMBC:
+		return ".bc"
+	case EmitAsm:
+		return ".s"
+	case EmitObj:
+		if windows {
+			return ".obj"
+		}
 
-	return nil, c.build(ir)
+		return ".o"
+	default:
+		if windows {
+			return ".exe"
+		}
+
+		return ""
+	}
 }
 
-func (c *Compiler) build(ir IR) error {
-	// TODO: DEVELOPMENT ONLY
-	saveIR(ir)
+// write creates the output file, or uses the standard output, and writes to it
+func (c *Compiler) write(output string, content func(w io.Writer) error) error {
+	c.logf("write %s", output)
+
+	if output == Stdout {
+		return content(os.Stdout)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+
+	if err := content(f); err != nil {
+		f.Close()
+		return err
+	}
 
-	outName := "main"
-	if c.target.OS == Windows {
-		outName += ".exe"
+	return f.Close()
+}
+
+// logf writes a message to the build log, if there's one
+func (c *Compiler) logf(format string, args ...interface{}) {
+	if c.options.Log != nil {
+		fmt.Fprintf(c.options.Log, format+"\n", args...)
 	}
+}
 
-	cmd := exec.Command("clang",
-		"-x",
-		"ir",
-		"--target="+c.target.String(),
-		"-o", outName,
-		"-",
-	)
+// HasErrors returns true if any of the compile errors is reported with [SeverityError]. Warnings don't stop the
+// compilation.
+func HasErrors(errs []CompileError) bool {
+	for _, err := range errs {
+		if err.Diagnostic().Severity == SeverityError {
+			return true
+		}
+	}
 
-	r, w := io.Pipe()
-	cmd.Stdin = r
+	return false
+}
 
-	errs := errgroup.Group{}
-	errs.Go(func() error {
-		_, err := w.Write([]byte(ir.String()))
+// build passes the IR to the toolchain, to produce a bitcode, assembly, object or executable file. Failures of the
+// toolchain are returned as compile errors.
+func (c *Compiler) build(ir IR, output string) ([]CompileError, error) {
+	if c.toolchain == nil {
+		t, err := FindToolchain(c.options.CC)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		return w.Close()
-	})
+		c.toolchain = t
+	}
 
-	errs.Go(func() error {
-		if cmdOut, err := cmd.CombinedOutput(); err != nil {
-			return errors.New(fmt.Sprintf("%v: %s", err, cmdOut))
+	link := c.options.Link
+	if c.options.Emit == EmitExe {
+		runtime, errs, err := c.runtime()
+		if err != nil || len(errs) > 0 {
+			return errs, err
 		}
 
-		return nil
-	})
+		link.Inputs = append([]string{runtime}, link.Inputs...)
+	}
 
-	return errs.Wait()
+	cmds, cleanup, err := c.toolchain.commands(c.options.Target, c.options.Profile, c.options.Emit, output, link)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return c.run(cmds, ir.String(), output)
 }
 
-// TODO: DEVELOPMENT ONLY
-func saveIR(ir IR) {
-	err := os.WriteFile("main.ll", []byte(ir.String()), fs.ModePerm)
+// runtimeProfile builds the runtime library, which is the same for every profile as it has no checks of its own
+var runtimeProfile = Profile{Name: "runtime", Opt: O2}
+
+// runtime returns the object file of the runtime library for the target, building it if it's not cached
+func (c *Compiler) runtime() (string, []CompileError, error) {
+	path, code := runtimeObject(c.options.Target)
+	if _, err := os.Stat(path); err == nil {
+		c.logf("runtime %s", path)
+		return path, nil, nil
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", nil, err
+	}
+
+	// The object is built aside and renamed, so concurrent builds never link a partial object
+	tmp, err := os.CreateTemp(dir, "runtime-*.o")
 	if err != nil {
-		panic(err.Error())
+		return "", nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	c.logf("build runtime %s", path)
+	cmds, cleanup, err := c.toolchain.commands(c.options.Target, runtimeProfile, EmitObj, tmp.Name(), LinkOptions{})
+	if err != nil {
+		return "", nil, err
+	}
+	defer cleanup()
+
+	if errs, err := c.run(cmds, code, tmp.Name()); err != nil || len(errs) > 0 {
+		return "", errs, err
 	}
+
+	return path, nil, os.Rename(tmp.Name(), path)
+}
+
+// run runs the commands, feeding the IR to the first one. If the output is [Stdout], the output of the last command is
+// written to the standard output. When a command fails the rest are not run, and its output is returned as compile
+// errors. The returned error is only set if a command couldn't be started.
+func (c *Compiler) run(cmds []*exec.Cmd, ir string, output string) ([]CompileError, error) {
+	for i, cmd := range cmds {
+		if i == 0 {
+			cmd.Stdin = strings.NewReader(ir)
+		}
+
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		cmd.Stderr = &out
+		if output == Stdout && i == len(cmds)-1 {
+			cmd.Stdout = os.Stdout
+		}
+
+		c.logf("%s", strings.Join(cmd.Args, " "))
+		if err := cmd.Run(); err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				return nil, err
+			}
+
+			tool := strings.TrimSuffix(filepath.Base(cmd.Path), ".exe")
+			return parseToolchainOutput(tool, err, out.Bytes()), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// runtimeObject returns the path of the cached object of the runtime library for the target, and the code it's built
+// from. The objects are named after the target and a hash of their code, so they're rebuilt when the runtime changes.
+func runtimeObject(target Target) (string, string) {
+	code := newRuntime(target).String()
+	sum := sha256.Sum256([]byte(code))
+
+	return filepath.Join(runtimeCacheDir(), fmt.Sprintf("runtime-%s-%x.o", target, sum[:8])), code
 }
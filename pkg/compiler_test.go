@@ -0,0 +1,259 @@
+package maqui
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilerOutput(t *testing.T) {
+	cases := []struct {
+		name     string
+		options  Options
+		filename string
+		expect   string
+	}{
+		{"SourceName", Options{Target: DefaultTarget}, "dir/hello.mq", "hello"},
+		{"Windows", Options{Target: Target{Arch: X86_64, Vendor: Unknown, OS: Windows}}, "hello.mq", "hello.exe"},
+		{"Explicit", Options{Target: DefaultTarget, Output: "bin/app"}, "hello.mq", "bin/app"},
+		{"Object", Options{Target: DefaultTarget, Emit: EmitObj}, "hello.mq", "hello.o"},
+		{"WindowsObject", Options{Target: Target{Arch: X86_64, Vendor: Unknown, OS: Windows}, Emit: EmitObj}, "hello.mq",
+			"hello.obj"},
+		{"IR", Options{Target: DefaultTarget, Emit: EmitLLVMIR}, "hello.mq", "hello.ll"},
+		{"Assembly", Options{Target: DefaultTarget, Emit: EmitAsm}, "hello.mq", "hello.s"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, NewCompiler(c.options).output(c.filename))
+		})
+	}
+}
+
+func TestCompilerCheck(t *testing.T) {
+	c := NewCompiler(Options{Target: DefaultTarget})
+
+	_, err := c.Check("does-not-exist.mq")
+	assert.Error(t, err)
+}
+
+func TestCompilerEmit(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.mq")
+	assert.NoError(t, os.WriteFile(source, []byte("func main() {\n    print(1)\n}\n"), 0o644))
+
+	cases := []struct {
+		emit   Emit
+		output string
+		expect string
+	}{
+		{EmitTokens, "main.tokens", "1:1\tFunc\t\"func\"\n"},
+		{EmitAST, "main.ast", "FuncDecl main <1:1>\n"},
+		{EmitLLVMIR, "main.ll", "define i32 @maqui.main()"},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.emit), func(t *testing.T) {
+			wd, _ := os.Getwd()
+			assert.NoError(t, os.Chdir(dir))
+			defer os.Chdir(wd)
+
+			errs, err := NewCompiler(Options{Target: DefaultTarget, Emit: c.emit}).Compile(source)
+			assert.NoError(t, err)
+			assert.Empty(t, errs)
+
+			out, err := os.ReadFile(filepath.Join(dir, c.output))
+			assert.NoError(t, err)
+			assert.Contains(t, string(out), c.expect)
+		})
+	}
+
+	_, err := os.Stat(filepath.Join(dir, "main.ll"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "main"))
+	assert.True(t, os.IsNotExist(err), "no executable should be built")
+}
+
+func TestCompilerProfile(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.mq")
+	output := filepath.Join(dir, "main.ll")
+	assert.NoError(t, os.WriteFile(source, []byte("func main() {\n    assert(1 == 1)\n}\n"), 0o644))
+
+	errs, err := NewCompiler(Options{Profile: ProfileRelease, Emit: EmitLLVMIR, Output: output}).Compile(source)
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+
+	out, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `!{!"maqui release -O2 checks=off assertions=off overflow=wrap strip=on"}`)
+	assert.NotContains(t, string(out), "call void @assert")
+}
+
+func TestCompilerEmitWithErrors(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.mq")
+	assert.NoError(t, os.WriteFile(source, []byte("func main() {\n    print(x)\n}\n"), 0o644))
+
+	cases := []struct {
+		emit    Emit
+		written bool
+	}{
+		{EmitAST, true},
+		{EmitLLVMIR, false},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.emit), func(t *testing.T) {
+			output := filepath.Join(dir, "out."+string(c.emit))
+			errs, err := NewCompiler(Options{Target: DefaultTarget, Emit: c.emit, Output: output}).Compile(source)
+			assert.NoError(t, err)
+			assert.True(t, HasErrors(errs))
+
+			_, err = os.Stat(output)
+			assert.Equal(t, c.written, err == nil)
+		})
+	}
+}
+
+func TestCompilerRuntimeCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MAQUI_CACHE", dir)
+
+	path, _ := runtimeObject(DefaultTarget)
+	other, _ := runtimeObject(Target{Arch: AArch64, Vendor: Unknown, OS: Linux})
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.NotEqual(t, path, other, "each target has its own runtime")
+
+	again, _ := runtimeObject(DefaultTarget)
+	assert.Equal(t, path, again, "the runtime is the same in every build")
+
+	// Cached runtimes are linked without building them, so no toolchain is needed
+	assert.NoError(t, os.WriteFile(path, nil, 0o644))
+	runtime, errs, err := NewCompiler(Options{}).runtime()
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Equal(t, path, runtime)
+}
+
+// runSource builds the source code as an executable and runs it, returning its output and exit code. The test is
+// skipped if there's no toolchain to build it.
+func runSource(t *testing.T, options Options, source string) (string, int) {
+	t.Helper()
+
+	if _, err := FindToolchain(options.CC); err != nil {
+		t.Skip(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.mq")
+	options.Output = filepath.Join(dir, "main")
+	assert.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+
+	errs, err := NewCompiler(options).Compile(path)
+	if !assert.NoError(t, err) || !assert.Empty(t, errs) {
+		return "", -1
+	}
+
+	out, err := exec.Command(options.Output).Output()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return string(out), exit.ExitCode()
+	}
+
+	assert.NoError(t, err)
+	return string(out), 0
+}
+
+func TestCompilerRun(t *testing.T) {
+	cases := []struct {
+		name    string
+		profile Profile
+		source  string
+		expect  string
+	}{
+		{
+			"DivisionByMinusOneWraps",
+			ProfileRelease,
+			"func main() {\n" +
+				"    d := int8(parseInt(\"-1\"))\n" +
+				"    println(int8(-128) / d, int8(-128) % d, int8(7) / d, int8(7) % d)\n" +
+				"}\n",
+			"-128 0 -7 0\n",
+		},
+		{
+			"StringConcatenation",
+			ProfileDebug,
+			"func main() {\n" +
+				"    s := \"foo\" + formatInt(12)\n" +
+				"    println(s + \"\" + \"bar\", \"x\" + \"y\")\n" +
+				"}\n",
+			"foo12bar xy\n",
+		},
+		{
+			"DeclaredInBothBranches",
+			ProfileDebug,
+			"func main() {\n" +
+				"    y := parseInt(\"3\")\n" +
+				"    if y == 3 {\n" +
+				"        x := 1\n" +
+				"        z := y + 1\n" +
+				"    } else {\n" +
+				"        x := 2\n" +
+				"        z := y + 2\n" +
+				"    }\n" +
+				"    println(x, z)\n" +
+				"}\n",
+			"1 4\n",
+		},
+		{
+			"DeclaredInNestedBranches",
+			ProfileRelease,
+			"func main() {\n" +
+				"    y := parseInt(\"3\")\n" +
+				"    z := 0\n" +
+				"    if y == 3 {\n" +
+				"        if y == 4 {\n" +
+				"            z := 1\n" +
+				"        } else {\n" +
+				"            z := y + 2\n" +
+				"        }\n" +
+				"    }\n" +
+				"    println(z)\n" +
+				"}\n",
+			"5\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, exit := runSource(t, Options{Profile: c.profile}, c.source)
+			assert.Equal(t, 0, exit)
+			assert.Equal(t, c.expect, out)
+		})
+	}
+}
+
+func TestCompilerExecutableToStdout(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.mq")
+	assert.NoError(t, os.WriteFile(source, []byte("func main() {\n    print(1)\n}\n"), 0o644))
+
+	wd, _ := os.Getwd()
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	_, err := NewCompiler(Options{Output: Stdout}).Compile(source)
+	assert.EqualError(t, err, "executables can't be written to the standard output")
+
+	_, err = os.Stat(filepath.Join(dir, Stdout))
+	assert.True(t, os.IsNotExist(err), "no executable named - should be written")
+}
+
+func TestCompilerRunPanic(t *testing.T) {
+	out, exit := runSource(t, Options{}, "func main() {\n    print(1)\n    panic(\"boom\")\n}\n")
+	assert.Equal(t, PanicExitCode, exit)
+	assert.Equal(t, "1", out)
+}
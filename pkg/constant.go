@@ -0,0 +1,288 @@
+package maqui
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// constValue holds the value of an expression that can be evaluated at compile time. Values are kept exact, so the
+// analyzer is able to tell whether a constant fits in a type before committing to it.
+type constValue struct {
+	// val is the exact value of the constant
+	val *big.Rat
+	// float is true if the constant is a floating point number, even if its value is integral (for example 1.0)
+	float bool
+	// rune is true if the constant is built from a rune literal, and it's not a floating point number
+	rune bool
+	// typ is the type of the constant. Constants built only from literals are untyped, and typ is nil.
+	typ *BasicType
+}
+
+// evalConstant evaluates an expression at compile time. It returns false if the expression is not constant, or if it
+// can't be evaluated (for example a division by zero). Only numeric constants are supported. The sizes of the target
+// bound the bitwise operations on word sized integers.
+func evalConstant(expr Expr, s sizes) (*constValue, bool) {
+	switch e := expr.(type) {
+	case *LiteralExpr:
+		switch e.Typ {
+		case LiteralNumber:
+			val, ok := new(big.Rat).SetString(e.Value)
+			if !ok {
+				return nil, false
+			}
+
+			return &constValue{val: val, float: isFloatLiteral(e.Value)}, true
+		case LiteralRune:
+			r, _ := utf8.DecodeRuneInString(e.Value)
+			return &constValue{val: new(big.Rat).SetInt64(int64(r)), rune: true}, true
+		}
+
+		return nil, false
+	case *UnaryExpr:
+		v, ok := evalConstant(e.Operand, s)
+		if !ok {
+			return nil, false
+		}
+
+		switch e.Operation {
+		case UnaryNegative:
+			return &constValue{val: new(big.Rat).Neg(v.val), float: v.float, rune: v.rune, typ: v.typ}, true
+		case UnaryBitwiseNot:
+			if v.float || !v.isIntegral() {
+				return nil, false
+			}
+
+			not := new(big.Int).Not(v.int())
+			if v.typ != nil && !isSigned(v.typ) {
+				// Unsigned values only flip the bits inside their size
+				not.And(not, mask(s.of(v.typ.Typ)))
+			}
+
+			return &constValue{val: new(big.Rat).SetInt(not), rune: v.rune, typ: v.typ}, true
+		}
+
+		return nil, false
+	case *BinaryExpr:
+		return evalBinaryConstant(e, s)
+	case *ConversionExpr:
+		v, ok := evalConstant(e.Value, s)
+		if !ok {
+			return nil, false
+		}
+
+		to := &BasicType{e.Type}
+		if !isNumeric(to) {
+			return nil, false
+		}
+
+		val := new(big.Rat).Set(v.val)
+		if isFloat(to) {
+			val = roundFloat(val, basicTypes[e.Type].size)
+		}
+
+		return &constValue{val: val, float: isFloat(to), typ: to}, true
+	}
+
+	return nil, false
+}
+
+// maxConstantShift is the largest shift count evaluated at compile time. Larger counts always overflow any type.
+const maxConstantShift = 1024
+
+// evalBinaryConstant evaluates a binary operation between two constants. Integer divisions are truncated towards zero.
+func evalBinaryConstant(e *BinaryExpr, s sizes) (*constValue, bool) {
+	v1, ok1 := evalConstant(e.Op1, s)
+	v2, ok2 := evalConstant(e.Op2, s)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+
+	if e.Operation == BinaryShiftLeft || e.Operation == BinaryShiftRight {
+		return evalShiftConstant(e.Operation, v1, v2)
+	}
+
+	if v1.typ != nil && v2.typ != nil && !v1.typ.Equals(v2.typ) {
+		return nil, false
+	}
+
+	res := &constValue{val: new(big.Rat), float: v1.float || v2.float, typ: v1.typ}
+	res.rune = !res.float && (v1.rune || v2.rune)
+	if res.typ == nil {
+		res.typ = v2.typ
+	}
+
+	if res.typ != nil {
+		res.float = isFloat(res.typ)
+	}
+
+	switch e.Operation {
+	case BinaryAddition:
+		res.val.Add(v1.val, v2.val)
+	case BinarySubtraction:
+		res.val.Sub(v1.val, v2.val)
+	case BinaryMultiplication:
+		res.val.Mul(v1.val, v2.val)
+	case BinaryDivision:
+		if v2.val.Sign() == 0 {
+			return nil, false
+		}
+
+		res.val.Quo(v1.val, v2.val)
+		if !res.float {
+			res.val.SetInt(new(big.Int).Quo(res.val.Num(), res.val.Denom()))
+		}
+	default:
+		if res.float || !v1.isIntegral() || !v2.isIntegral() {
+			return nil, false
+		}
+
+		x, y := v1.int(), v2.int()
+		switch e.Operation {
+		case BinaryModulo:
+			if y.Sign() == 0 {
+				return nil, false
+			}
+
+			res.val.SetInt(new(big.Int).Rem(x, y))
+		case BinaryAnd:
+			res.val.SetInt(new(big.Int).And(x, y))
+		case BinaryOr:
+			res.val.SetInt(new(big.Int).Or(x, y))
+		case BinaryXor:
+			res.val.SetInt(new(big.Int).Xor(x, y))
+		case BinaryAndNot:
+			res.val.SetInt(new(big.Int).AndNot(x, y))
+		default:
+			return nil, false
+		}
+	}
+
+	return res, true
+}
+
+// evalShiftConstant evaluates a shift between two constants. The result keeps the type of the shifted value.
+func evalShiftConstant(op BinaryOp, v *constValue, count *constValue) (*constValue, bool) {
+	if !v.isIntegral() || !count.isIntegral() || (v.typ != nil && !isInteger(v.typ)) {
+		return nil, false
+	}
+
+	n := count.int()
+	if n.Sign() < 0 || n.Cmp(big.NewInt(maxConstantShift)) > 0 {
+		return nil, false
+	}
+
+	res := new(big.Int)
+	if op == BinaryShiftLeft {
+		res.Lsh(v.int(), uint(n.Uint64()))
+	} else {
+		res.Rsh(v.int(), uint(n.Uint64()))
+	}
+
+	return &constValue{val: new(big.Rat).SetInt(res), rune: v.rune, typ: v.typ}, true
+}
+
+// mask returns an integer with the lowest size bits set
+func mask(size int) *big.Int {
+	m := new(big.Int).Lsh(big.NewInt(1), uint(size))
+	return m.Sub(m, big.NewInt(1))
+}
+
+// isFloatLiteral returns true if the numeric literal is written as a floating point number. Numbers with a base prefix
+// are always integers.
+func isFloatLiteral(lit string) bool {
+	if len(lit) > 1 && lit[0] == '0' && strings.ContainsRune("xXoObB", rune(lit[1])) {
+		return false
+	}
+
+	for _, r := range lit {
+		if r == '.' || r == 'e' || r == 'E' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// roundFloat rounds the value to the closest floating point number of the provided size (32 or 64 bits)
+func roundFloat(val *big.Rat, size int) *big.Rat {
+	if size == 32 {
+		f, _ := val.Float32()
+		if r := new(big.Rat).SetFloat64(float64(f)); r != nil {
+			return r
+		}
+	}
+
+	f, _ := val.Float64()
+	if r := new(big.Rat).SetFloat64(f); r != nil {
+		return r
+	}
+
+	return val // Infinite values are reported as overflows
+}
+
+// defaultType returns the type an untyped constant takes when no other type is expected
+func (v *constValue) defaultType() *BasicType {
+	if v.typ != nil {
+		return v.typ
+	}
+
+	if v.float {
+		return &BasicType{"float64"}
+	}
+
+	if v.rune {
+		return &BasicType{"int32"}
+	}
+
+	return &BasicType{"int"}
+}
+
+// isZero returns true if the value of the constant is zero
+func (v *constValue) isZero() bool {
+	return v.val.Sign() == 0
+}
+
+// isIntegral returns true if the value of the constant has no fractional part
+func (v *constValue) isIntegral() bool {
+	return v.val.IsInt()
+}
+
+// fits returns true if the value of the constant is inside the range of values of the numeric type on the target
+func (v *constValue) fits(t *BasicType, s sizes) bool {
+	info := basicTypes[t.Typ]
+	size := s.of(t.Typ)
+
+	switch info.kind {
+	case kindFloat:
+		f, _ := v.val.Float64()
+		if size == 32 {
+			return math.Abs(f) <= math.MaxFloat32
+		}
+
+		return !math.IsInf(f, 0)
+	case kindSigned:
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(size-1))
+		return v.val.Num().Cmp(new(big.Int).Neg(limit)) >= 0 && v.val.Num().Cmp(limit) < 0
+	case kindUnsigned:
+		limit := new(big.Int).Lsh(big.NewInt(1), uint(size))
+		return v.val.Num().Sign() >= 0 && v.val.Num().Cmp(limit) < 0
+	}
+
+	return false
+}
+
+// int returns the integer value of the constant, truncating any fractional part
+func (v *constValue) int() *big.Int {
+	return new(big.Int).Quo(v.val.Num(), v.val.Denom())
+}
+
+// String returns the constant formatted as it would be written in source code
+func (v *constValue) String() string {
+	if v.isIntegral() && !v.float {
+		return v.val.Num().String()
+	}
+
+	return new(big.Float).SetRat(v.val).Text('g', 10)
+}
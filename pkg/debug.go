@@ -0,0 +1,254 @@
+package maqui
+
+import (
+	"path/filepath"
+	"reflect"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/metadata"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// dwarfVersion is the version of the DWARF debug information emitted
+const dwarfVersion = 4
+
+// debugInfo builds the DWARF debug information of a module from the locations of the expressions. Debuggers use it to
+// map the machine code back to the source file, to set breakpoints on lines and to show the local variables.
+type debugInfo struct {
+	mod   *ir.Module
+	file  *metadata.DIFile
+	unit  *metadata.DICompileUnit
+	sizes sizes
+	// scope is the subprogram of the function being built
+	scope *metadata.DISubprogram
+	// types and locations hold the metadata already defined, so it's shared by all its uses
+	types     map[string]metadata.Field
+	locations map[locationKey]*metadata.DILocation
+	// value is the llvm.dbg.value intrinsic, which tells the value of a local variable
+	value *ir.Func
+}
+
+// locationKey identifies a location inside a scope
+type locationKey struct {
+	line, col uint64
+	scope     *metadata.DISubprogram
+}
+
+// newDebugInfo defines the compile unit of the source file in the module
+func newDebugInfo(mod *ir.Module, filename string, profile Profile, sizes sizes) *debugInfo {
+	dir, _ := filepath.Abs(filepath.Dir(filename))
+
+	d := &debugInfo{
+		mod:       mod,
+		sizes:     sizes,
+		types:     make(map[string]metadata.Field),
+		locations: make(map[locationKey]*metadata.DILocation),
+	}
+
+	d.file = &metadata.DIFile{MetadataID: -1, Filename: filepath.Base(filename), Directory: dir}
+	d.unit = &metadata.DICompileUnit{
+		MetadataID: -1,
+		Distinct:   true,
+		// Maqui has no language code of its own, and debuggers evaluate expressions with the rules of C
+		Language:     enum.DwarfLangC99,
+		File:         d.file,
+		Producer:     "maqui " + profile.String(),
+		IsOptimized:  profile.Opt != O0,
+		EmissionKind: enum.EmissionKindFullDebug,
+	}
+
+	d.def(d.file, d.unit)
+
+	flag := func(behavior int64, name string, v int64) *metadata.Tuple {
+		return &metadata.Tuple{MetadataID: -1, Fields: []metadata.Field{
+			constant.NewInt(types.I32, behavior),
+			&metadata.String{Value: name},
+			constant.NewInt(types.I32, v),
+		}}
+	}
+
+	// The behaviors tell how the flags are merged when modules are linked: 7 keeps the highest version, 2 warns about
+	// different versions
+	dwarf, version := flag(7, "Dwarf Version", dwarfVersion), flag(2, "Debug Info Version", 3)
+	d.def(dwarf, version)
+
+	mod.NamedMetadataDefs["llvm.dbg.cu"] = &metadata.NamedDef{Name: "llvm.dbg.cu", Nodes: []metadata.Node{d.unit}}
+	mod.NamedMetadataDefs["llvm.module.flags"] = &metadata.NamedDef{
+		Name:  "llvm.module.flags",
+		Nodes: []metadata.Node{dwarf, version},
+	}
+
+	d.value = mod.NewFunc("llvm.dbg.value", types.Void,
+		ir.NewParam("value", types.Metadata),
+		ir.NewParam("variable", types.Metadata),
+		ir.NewParam("expression", types.Metadata),
+	)
+
+	return d
+}
+
+// def adds the metadata to the definitions of the module
+func (d *debugInfo) def(defs ...metadata.Definition) {
+	d.mod.MetadataDefs = append(d.mod.MetadataDefs, defs...)
+}
+
+// function defines the subprogram of a function, and makes it the scope of the following locations
+func (d *debugInfo) function(f *ir.Func, expr *FuncDecl) {
+	ret := metadata.Field(&metadata.NullLit{})
+	if expr.Name == "main" {
+		ret = d.typ(&BasicType{"int32"})
+	}
+
+	signature := &metadata.DISubroutineType{
+		MetadataID: -1,
+		Types:      &metadata.Tuple{MetadataID: -1, Fields: []metadata.Field{ret}},
+	}
+
+	d.scope = &metadata.DISubprogram{
+		MetadataID:  -1,
+		Distinct:    true,
+		Scope:       d.file,
+		Name:        expr.Name,
+		File:        d.file,
+		Line:        int64(expr.Location.Line),
+		Type:        signature,
+		ScopeLine:   int64(expr.Location.Line),
+		Flags:       enum.DIFlagPrototyped,
+		SPFlags:     enum.DISPFlagDefinition,
+		IsOptimized: d.unit.IsOptimized,
+		Unit:        d.unit,
+	}
+
+	if f.Name() != expr.Name {
+		// The symbol of main is renamed, as the entry point is defined by the runtime library
+		d.scope.LinkageName = f.Name()
+	}
+
+	d.def(signature, d.scope)
+	f.Metadata = append(f.Metadata, &metadata.Attachment{Name: "dbg", Node: d.scope})
+}
+
+// location returns the location of a position in the current scope
+func (d *debugInfo) location(loc *Location) *metadata.DILocation {
+	key := locationKey{loc.Line, loc.Col, d.scope}
+	if l, ok := d.locations[key]; ok {
+		return l
+	}
+
+	l := &metadata.DILocation{MetadataID: -1, Line: int64(loc.Line), Column: int64(loc.Col), Scope: d.scope}
+	d.locations[key] = l
+	d.def(l)
+
+	return l
+}
+
+// attach sets the location of the instructions that don't have one yet. Instructions built for nested expressions keep
+// their own location.
+func (d *debugInfo) attach(loc *Location, ins ...interface{}) {
+	if loc == nil {
+		return
+	}
+
+	for _, i := range ins {
+		// The instructions and terminators of llir hold their attachments in an embedded ir.Metadata, which has no
+		// setter in their interfaces
+		field := reflect.ValueOf(i).Elem().FieldByName("Metadata")
+		if !field.IsValid() {
+			continue
+		}
+
+		mds := field.Interface().(ir.Metadata)
+		if hasDebugLocation(mds) {
+			continue
+		}
+
+		field.Set(reflect.ValueOf(append(mds, &metadata.Attachment{Name: "dbg", Node: d.location(loc)})))
+	}
+}
+
+// closingLocation returns the location of the last rune of the span, such as the closing brace of a block
+func closingLocation(loc *Location) *Location {
+	if loc == nil || loc.EndCol == 0 {
+		return loc
+	}
+
+	return &Location{Line: loc.EndLine, Col: loc.EndCol - 1, File: loc.File}
+}
+
+// hasDebugLocation returns true if the attachments include a location
+func hasDebugLocation(mds ir.Metadata) bool {
+	for _, md := range mds {
+		if md.Name == "dbg" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// variable describes a local variable, and returns the call that tells the debugger its value
+func (d *debugInfo) variable(expr *VariableDecl, v value.Value) ir.Instruction {
+	variable := &metadata.DILocalVariable{
+		MetadataID: -1,
+		Scope:      d.scope,
+		Name:       expr.Name,
+		File:       d.file,
+		Line:       int64(expr.Location.Line),
+		Type:       d.typ(expr.ResolvedType),
+	}
+
+	d.def(variable)
+
+	call := ir.NewCall(d.value,
+		&metadata.Value{Value: v},
+		&metadata.Value{Value: variable},
+		&metadata.Value{Value: &metadata.DIExpression{MetadataID: -1}},
+	)
+
+	d.attach(expr.Location, call)
+	return call
+}
+
+// typ returns the debug type of a Maqui type
+func (d *debugInfo) typ(t Type) metadata.Field {
+	name := t.String()
+	if md, ok := d.types[name]; ok {
+		return md
+	}
+
+	var md metadata.Definition
+	switch kind, _ := basicKindOf(t); kind {
+	case kindString:
+		// Strings are pointers to null-terminated characters, which debuggers print as text
+		char := &metadata.DIBasicType{MetadataID: -1, Name: "char", Size: 8, Encoding: enum.DwarfAttEncodingSignedChar}
+		d.def(char)
+
+		md = &metadata.DIDerivedType{
+			MetadataID: -1,
+			Tag:        enum.DwarfTagPointerType,
+			Name:       name,
+			BaseType:   char,
+			Size:       uint64(d.sizes.word),
+		}
+	case kindBool:
+		md = &metadata.DIBasicType{MetadataID: -1, Name: name, Size: 8, Encoding: enum.DwarfAttEncodingBoolean}
+	default:
+		encoding := enum.DwarfAttEncodingSigned
+		switch kind {
+		case kindUnsigned:
+			encoding = enum.DwarfAttEncodingUnsigned
+		case kindFloat:
+			encoding = enum.DwarfAttEncodingFloat
+		}
+
+		md = &metadata.DIBasicType{MetadataID: -1, Name: name, Size: uint64(d.sizes.of(name)), Encoding: encoding}
+	}
+
+	d.def(md)
+	d.types[name] = md
+
+	return md
+}
@@ -0,0 +1,79 @@
+package maqui
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugInfo(t *testing.T) {
+	source := "func main() {\n" +
+		"    x := parseInt(\"5\")\n" +
+		"    y := int(x)\n" +
+		"    if y == 5 {\n" +
+		"        print(int32(1))\n" +
+		"    }\n" +
+		"}\n"
+
+	ast := analyzeSource(source)
+	if !assert.Empty(t, ast.Errors) {
+		return
+	}
+
+	gen := NewLLVMGenerator(ast)
+	gen.SetDebugInfo(true)
+	out := gen.Do().String()
+
+	expect := []string{
+		"!llvm.dbg.cu = !{",
+		`!{i32 2, !"Debug Info Version", i32 3}`,
+		"define i32 @maqui.main() !dbg ",
+		`distinct !DISubprogram(name: "main", linkageName: "maqui.main", scope: `,
+		"call void @llvm.dbg.value(metadata i64 %",
+		"!DILocation(line: 2, column: 5, scope: ",
+		"!DILocation(line: 3, column: 5, scope: ",
+		"!DILocation(line: 4, column: 8, scope: ",
+		"!DILocation(line: 5, column: 9, scope: ",
+		"!DILocation(line: 7, column: 1, scope: ",
+	}
+
+	for _, e := range expect {
+		assert.Contains(t, out, e)
+	}
+
+	// Variables are described with the name of their Maqui type, so int and int64 have their own types
+	variables := map[string]string{"x": "int64", "y": "int"}
+	for name, typ := range variables {
+		basic := regexp.MustCompile(`(![0-9]+) = !DIBasicType\(name: "` + typ + `", size: 64, encoding: DW_ATE_signed\)`)
+		match := basic.FindStringSubmatch(out)
+		if assert.NotNil(t, match, typ) {
+			variable := regexp.MustCompile(`!DILocalVariable\(name: "` + name + `", .*type: ` + match[1] + `\)`)
+			assert.Regexp(t, variable, out, name)
+		}
+	}
+
+	// Every instruction of main must be located, as calls without location are rejected by LLVM
+	body := out[strings.Index(out, "define i32 @maqui.main()"):]
+	body = body[:strings.Index(body, "\n}")]
+	for _, line := range strings.Split(body, "\n")[1:] {
+		if strings.HasPrefix(line, "\t") {
+			assert.Contains(t, line, ", !dbg !", line)
+		}
+	}
+}
+
+func TestDebugInfoDisabled(t *testing.T) {
+	ast := analyzeSource("func main() {\n    print(int32(1))\n}\n")
+	out := NewLLVMGenerator(ast).Do().String()
+
+	assert.NotContains(t, out, "!dbg")
+	assert.NotContains(t, out, "llvm.dbg.cu")
+}
+
+func TestClosingLocation(t *testing.T) {
+	loc := &Location{Line: 1, Col: 1, EndLine: 3, EndCol: 2}
+	assert.Equal(t, &Location{Line: 3, Col: 1}, closingLocation(loc))
+	assert.Nil(t, closingLocation(nil))
+}
@@ -0,0 +1,513 @@
+package maqui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity tells how serious a [Diagnostic] is. Only errors stop the compilation.
+type Severity int
+
+const (
+	// SeverityError marks code that can't be compiled
+	SeverityError Severity = iota
+	// SeverityWarning marks code that compiles, but is likely a mistake
+	SeverityWarning
+	// SeverityNote gives additional information, and it's usually attached to another diagnostic
+	SeverityNote
+)
+
+// String returns the name of the severity, as shown to the user
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	}
+
+	return "error"
+}
+
+// Diagnostic is a message about the source code reported to the user. Besides its primary location, a diagnostic might
+// point to related code (for example a previous declaration), give notes with further details, and suggest fixes.
+type Diagnostic struct {
+	// Severity tells if the diagnostic is an error or a warning
+	Severity Severity
+	// Code is a stable identifier of the kind of diagnostic, as in "E0003"
+	Code string
+	// Message describes the problem found
+	Message string
+	// Loc points to the source code that caused the diagnostic. It might be nil if the location is unknown.
+	Loc *Location
+	// Related holds other locations involved in the diagnostic
+	Related []Related
+	// Notes hold further details or hints about the diagnostic
+	Notes []string
+	// Fixes hold edits that might solve the problem
+	Fixes []Fix
+}
+
+// Related is a location of source code involved in a [Diagnostic], other than its primary location
+type Related struct {
+	// Loc points to the related source code
+	Loc *Location
+	// Message explains how the location is related to the diagnostic
+	Message string
+}
+
+// Fix is an edit of the source code suggested to solve a [Diagnostic]
+type Fix struct {
+	// Message describes the fix
+	Message string
+	// Loc is the source code to be replaced
+	Loc *Location
+	// Replacement is the text that replaces the source code at Loc
+	Replacement string
+}
+
+// newError creates an error diagnostic with a formatted message
+func newError(code string, loc *Location, format string, args ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Loc:      loc,
+	}
+}
+
+// related adds a related location with a formatted message. Missing locations are ignored.
+func (d *Diagnostic) related(loc *Location, format string, args ...interface{}) *Diagnostic {
+	if loc != nil {
+		d.Related = append(d.Related, Related{Loc: loc, Message: fmt.Sprintf(format, args...)})
+	}
+
+	return d
+}
+
+// note adds a formatted note
+func (d *Diagnostic) note(format string, args ...interface{}) *Diagnostic {
+	d.Notes = append(d.Notes, fmt.Sprintf(format, args...))
+	return d
+}
+
+// fix adds a fix that replaces the source code at loc. Missing locations are ignored.
+func (d *Diagnostic) fix(loc *Location, replacement string, message string) *Diagnostic {
+	if loc != nil {
+		d.Fixes = append(d.Fixes, Fix{Message: message, Loc: loc, Replacement: replacement})
+	}
+
+	return d
+}
+
+// suggest returns the candidate closest to the name, to be suggested when the name is not found. Only candidates
+// within a small edit distance are considered, proportional to the length of the name, so short names get no
+// suggestions. Ties are broken alphabetically. An empty string is returned if no candidate is close enough.
+func suggest(name string, candidates []string) string {
+	best, bestDist := "", len([]rune(name))/3+1
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if d < bestDist || (d == bestDist && best != "" && c < best) {
+			best, bestDist = c, d
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the amount of single rune insertions, deletions, substitutions and transpositions of adjacent
+// runes needed to turn one string into the other (optimal string alignment distance).
+func editDistance(a string, b string) int {
+	r1, r2 := []rune(a), []rune(b)
+
+	// Only the last three rows are needed to find transpositions
+	prev2 := make([]int, len(r2)+1)
+	prev := make([]int, len(r2)+1)
+	curr := make([]int, len(r2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(r1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && r1[i-1] == r2[j-2] && r1[i-2] == r2[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+
+		prev2, prev, curr = prev, curr, prev2
+	}
+
+	return prev[len(r2)]
+}
+
+// min returns the smallest of the values
+func min(v int, values ...int) int {
+	for _, v2 := range values {
+		if v2 < v {
+			v = v2
+		}
+	}
+
+	return v
+}
+
+// String formats the diagnostic in a single line, as in "main.mq:3:5: error[E0002]: undefined: x". Diagnostics
+// without a code, like the ones reported by the toolchain, omit the brackets.
+func (d *Diagnostic) String() string {
+	header := fmt.Sprintf("%s[%s]: %s", d.Severity, d.Code, d.Message)
+	if d.Code == "" {
+		header = fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+
+	if d.Loc == nil {
+		return header
+	}
+
+	return fmt.Sprintf("%s: %s", d.Loc, header)
+}
+
+// Format formats the diagnostic with the source code it points to (see [Location.Snippet]), followed by its related
+// locations, notes and fixes.
+func (d *Diagnostic) Format(source []byte) string {
+	var b strings.Builder
+	b.WriteString(d.String())
+	writeSnippet(&b, d.Loc, source)
+
+	for _, r := range d.Related {
+		fmt.Fprintf(&b, "\n%s: %s: %s", r.Loc, SeverityNote, r.Message)
+		writeSnippet(&b, r.Loc, source)
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(&b, "\n  = note: %s", note)
+	}
+
+	for _, fix := range d.Fixes {
+		fmt.Fprintf(&b, "\n  = help: %s", fix.Message)
+	}
+
+	return b.String()
+}
+
+// writeSnippet writes the snippet of source code at the location in a new line, if there is any
+func writeSnippet(b *strings.Builder, loc *Location, source []byte) {
+	if loc == nil {
+		return
+	}
+
+	if snippet := loc.Snippet(source); snippet != "" {
+		b.WriteString("\n")
+		b.WriteString(snippet)
+	}
+}
+
+// DiagnosticFormat is the format used to write diagnostics (see [WriteDiagnostics])
+type DiagnosticFormat string
+
+const (
+	// FormatText writes diagnostics for humans, with the source code they point to
+	FormatText DiagnosticFormat = "text"
+	// FormatJSON writes one JSON object per line and diagnostic
+	FormatJSON DiagnosticFormat = "json"
+	// FormatSARIF writes a SARIF 2.1.0 log holding all diagnostics, as used by code scanning tools
+	FormatSARIF DiagnosticFormat = "sarif"
+)
+
+// DiagnosticFormats holds all supported diagnostic formats
+var DiagnosticFormats = []DiagnosticFormat{FormatText, FormatJSON, FormatSARIF}
+
+// WriteDiagnostics writes the diagnostics of the compile errors in the provided format. The source code the errors
+// were found in is only used by the text format, to show the code the diagnostics point to.
+func WriteDiagnostics(w io.Writer, format DiagnosticFormat, errs []CompileError, source []byte) error {
+	diags := make([]*Diagnostic, len(errs))
+	for i, err := range errs {
+		diags[i] = err.Diagnostic()
+	}
+
+	switch format {
+	case FormatText:
+		for _, d := range diags {
+			if _, err := fmt.Fprintln(w, d.Format(source)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		for _, d := range diags {
+			if err := enc.Encode(newDiagnosticRecord(d)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case FormatSARIF:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(newSarifLog(diags))
+	}
+
+	return fmt.Errorf("unknown diagnostics format %q", format)
+}
+
+// diagnosticRecord is the JSON representation of a [Diagnostic]
+type diagnosticRecord struct {
+	File      string          `json:"file,omitempty"`
+	Line      uint64          `json:"line,omitempty"`
+	Column    uint64          `json:"column,omitempty"`
+	EndLine   uint64          `json:"end_line,omitempty"`
+	EndColumn uint64          `json:"end_column,omitempty"`
+	Span      *spanRecord     `json:"span,omitempty"`
+	Severity  string          `json:"severity"`
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	Related   []relatedRecord `json:"related,omitempty"`
+	Notes     []string        `json:"notes,omitempty"`
+	Fixes     []fixRecord     `json:"fixes,omitempty"`
+}
+
+// spanRecord holds the byte offsets of a location
+type spanRecord struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// locationRecord is the JSON representation of a [Location]
+type locationRecord struct {
+	File      string     `json:"file"`
+	Line      uint64     `json:"line"`
+	Column    uint64     `json:"column"`
+	EndLine   uint64     `json:"end_line"`
+	EndColumn uint64     `json:"end_column"`
+	Span      spanRecord `json:"span"`
+}
+
+type relatedRecord struct {
+	locationRecord
+	Message string `json:"message"`
+}
+
+type fixRecord struct {
+	locationRecord
+	Message     string `json:"message"`
+	Replacement string `json:"replacement"`
+}
+
+func newLocationRecord(loc *Location) locationRecord {
+	return locationRecord{
+		File:      loc.File,
+		Line:      loc.Line,
+		Column:    loc.Col,
+		EndLine:   loc.EndLine,
+		EndColumn: loc.EndCol,
+		Span:      spanRecord{Start: loc.Start, End: loc.End},
+	}
+}
+
+func newDiagnosticRecord(d *Diagnostic) diagnosticRecord {
+	r := diagnosticRecord{
+		Severity: d.Severity.String(),
+		Code:     d.Code,
+		Message:  d.Message,
+		Notes:    d.Notes,
+	}
+
+	if d.Loc != nil {
+		loc := newLocationRecord(d.Loc)
+		r.File, r.Line, r.Column, r.EndLine, r.EndColumn = loc.File, loc.Line, loc.Column, loc.EndLine, loc.EndColumn
+		r.Span = &loc.Span
+	}
+
+	for _, rel := range d.Related {
+		r.Related = append(r.Related, relatedRecord{newLocationRecord(rel.Loc), rel.Message})
+	}
+
+	for _, fix := range d.Fixes {
+		r.Fixes = append(r.Fixes, fixRecord{newLocationRecord(fix.Loc), fix.Message, fix.Replacement})
+	}
+
+	return r
+}
+
+// sarifVersion is the version of the SARIF specification written by [WriteDiagnostics]
+const sarifVersion = "2.1.0"
+
+// sarifSchema points to the JSON schema of SARIF logs
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// The following types hold the subset of the SARIF specification used to report diagnostics. Field names follow the
+// specification.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID           string          `json:"ruleId,omitempty"`
+	Level            string          `json:"level"`
+	Message          sarifMessage    `json:"message"`
+	Locations        []sarifLocation `json:"locations,omitempty"`
+	RelatedLocations []sarifLocation `json:"relatedLocations,omitempty"`
+	Fixes            []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                  `json:"id,omitempty"`
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage         `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   uint64 `json:"startLine"`
+	StartColumn uint64 `json:"startColumn"`
+	EndLine     uint64 `json:"endLine"`
+	EndColumn   uint64 `json:"endColumn"`
+	ByteOffset  uint64 `json:"byteOffset"`
+	ByteLength  uint64 `json:"byteLength"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+func newSarifRegion(loc *Location) sarifRegion {
+	return sarifRegion{
+		StartLine:   loc.Line,
+		StartColumn: loc.Col,
+		EndLine:     loc.EndLine,
+		EndColumn:   loc.EndCol,
+		ByteOffset:  loc.Start,
+		ByteLength:  loc.End - loc.Start,
+	}
+}
+
+func newSarifLocation(loc *Location) sarifLocation {
+	return sarifLocation{
+		PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: loc.File},
+			Region:           newSarifRegion(loc),
+		},
+	}
+}
+
+// newSarifLog builds a SARIF log with a single run holding the diagnostics. Each diagnostic code is a rule of the run.
+func newSarifLog(diags []*Diagnostic) sarifLog {
+	run := sarifRun{
+		Tool:       sarifTool{Driver: sarifDriver{Name: "maqui", Rules: []sarifRule{}}},
+		ColumnKind: "unicodeCodePoints", // Columns count runes
+		Results:    []sarifResult{},
+	}
+
+	rules := make(map[string]bool)
+	for _, d := range diags {
+		if d.Code != "" && !rules[d.Code] {
+			rules[d.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: d.Code})
+		}
+
+		text := d.Message
+		for _, note := range d.Notes {
+			text += "\n" + note
+		}
+
+		res := sarifResult{
+			RuleID:  d.Code,
+			Level:   d.Severity.String(),
+			Message: sarifMessage{Text: text},
+		}
+
+		if d.Loc != nil {
+			res.Locations = []sarifLocation{newSarifLocation(d.Loc)}
+		}
+
+		for i, rel := range d.Related {
+			id := i
+			loc := newSarifLocation(rel.Loc)
+			loc.ID = &id
+			loc.Message = &sarifMessage{Text: rel.Message}
+			res.RelatedLocations = append(res.RelatedLocations, loc)
+		}
+
+		for _, fix := range d.Fixes {
+			res.Fixes = append(res.Fixes, sarifFix{
+				Description: sarifMessage{Text: fix.Message},
+				ArtifactChanges: []sarifArtifactChange{{
+					ArtifactLocation: sarifArtifactLocation{URI: fix.Loc.File},
+					Replacements: []sarifReplacement{{
+						DeletedRegion:   newSarifRegion(fix.Loc),
+						InsertedContent: sarifMessage{Text: fix.Replacement},
+					}},
+				}},
+			})
+		}
+
+		run.Results = append(run.Results, res)
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}
+}
@@ -0,0 +1,264 @@
+package maqui
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticFormat(t *testing.T) {
+	source := "func main() {\n    print(x)\n    x := 1\n}"
+	use := &Location{Start: 24, End: 25, Line: 2, Col: 11, EndLine: 2, EndCol: 12, File: "main.mq"}
+	decl := &Location{Start: 31, End: 37, Line: 3, Col: 5, EndLine: 3, EndCol: 11, File: "main.mq"}
+
+	cases := []struct {
+		name   string
+		diag   *Diagnostic
+		expect string
+	}{
+		{
+			"WithoutLocation",
+			newError(CodeSyntax, nil, "bad expression: %s", "unexpected ')'"),
+			"error[E0001]: bad expression: unexpected ')'",
+		},
+		{
+			"NoteWithoutLocation",
+			ShiftCountOverflowError{Count: "8", Type: &BasicType{"uint8"}}.Diagnostic(),
+			"error[E0013]: invalid shift count 8 for 'uint8'\n" +
+				"  = note: the count of a shift must be less than the size in bits of the shifted type",
+		},
+		{
+			"Snippet",
+			newError(CodeUndefined, use, "undefined: x"),
+			"main.mq:2:11: error[E0002]: undefined: x\n" +
+				"    print(x)\n" +
+				"          ^",
+		},
+		{
+			"RelatedAndNotes",
+			UseBeforeDeclarationError{Loc: use, Name: "x", Decl: decl}.Diagnostic().note("declare x first"),
+			"main.mq:2:11: error[E0005]: used before declaration: x\n" +
+				"    print(x)\n" +
+				"          ^\n" +
+				"main.mq:3:5: note: x is declared here\n" +
+				"    x := 1\n" +
+				"    ^^^^^^\n" +
+				"  = note: declare x first",
+		},
+		{
+			"Fix",
+			UnusedVariableError{Loc: decl, Name: "x"}.Diagnostic(),
+			"main.mq:3:5: error[E0007]: declared and not used: x\n" +
+				"    x := 1\n" +
+				"    ^\n" +
+				"  = help: assign the value to _ to discard it",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.diag.Format([]byte(source)))
+		})
+	}
+}
+
+func TestDiagnosticCodes(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    CompileError
+		expect string
+	}{
+		{"BadExpr", BadExprError{Expr: &BadExpr{}}, "E0001"},
+		{"Undefined", UndefinedError{}, "E0002"},
+		{"IncompatibleTypes", IncompatibleTypesError{}, "E0003"},
+		{"UndefinedOperation", UndefinedOperationError{}, "E0004"},
+		{"UndefinedUnitary", UndefinedUnitaryError{}, "E0004"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := c.err.Diagnostic()
+			assert.Equal(t, c.expect, d.Code)
+			assert.Equal(t, SeverityError, d.Severity)
+		})
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	cases := []struct {
+		name       string
+		input      string
+		candidates []string
+		expect     string
+	}{
+		{"Deletion", "prnt", []string{"print", "parseInt"}, "print"},
+		{"Transposition", "fucn", []string{"func", "if", "else"}, "func"},
+		{"Case", "Print", []string{"print"}, "print"},
+		{"TooFar", "prt", []string{"print"}, ""},
+		{"ShortName", "x", []string{"y", "xy"}, ""},
+		{"Tie", "abcd", []string{"abce", "abcf", "abcc"}, "abcc"},
+		{"ClosestWins", "formatIn", []string{"formatFloat", "formatInt"}, "formatInt"},
+		{"SameName", "print", []string{"print"}, ""},
+		{"NoCandidates", "print", nil, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, suggest(c.input, c.candidates))
+		})
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		expect int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "abc", 0},
+		{"abc", "abd", 1},
+		{"esle", "else", 1},
+		{"kitten", "sitting", 3},
+		{"ñandú", "nandu", 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.a+"/"+c.b, func(t *testing.T) {
+			assert.Equal(t, c.expect, editDistance(c.a, c.b))
+			assert.Equal(t, c.expect, editDistance(c.b, c.a))
+		})
+	}
+}
+
+func TestErrorsSortedByPosition(t *testing.T) {
+	data := "func main() {\n    y := 1\n    print(1 + \"a\")\n    print(undefinedName)\n}"
+
+	p := NewParser(NewLexerFromReader(strings.NewReader(data)))
+	analyzer := NewContextAnalyser(p)
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+	ast := analyzer.Do(global)
+
+	var codes []string
+	for _, err := range ast.Errors {
+		codes = append(codes, err.Diagnostic().Code)
+	}
+
+	assert.Equal(t, []string{CodeUnusedVariable, CodeIncompatibleTypes, CodeUndefined}, codes)
+}
+
+func TestSortErrorsWithoutLocation(t *testing.T) {
+	loc := func(start uint64) *Location {
+		return &Location{Start: start, End: start + 1}
+	}
+
+	errs := []CompileError{
+		&UndefinedError{Name: "a"},
+		&UndefinedError{Loc: loc(9), Name: "b"},
+		&UndefinedError{Name: "c"},
+		&UndefinedError{Loc: loc(1), Name: "d"},
+	}
+	sortErrors(errs)
+
+	var names []string
+	for _, err := range errs {
+		names = append(names, err.(*UndefinedError).Name)
+	}
+
+	assert.Equal(t, []string{"d", "b", "a", "c"}, names)
+}
+
+func TestIncompatibleTypesNote(t *testing.T) {
+	cases := []struct {
+		name   string
+		err    IncompatibleTypesError
+		expect []string
+	}{
+		{
+			"Numbers",
+			IncompatibleTypesError{Type1: &BasicType{"int"}, Type2: &BasicType{"float64"}},
+			[]string{"values of different types are never converted implicitly, convert one of them as in int(x)"},
+		},
+		{"String", IncompatibleTypesError{Type1: &BasicType{"int"}, Type2: &BasicType{"string"}}, nil},
+		{"Bool", IncompatibleTypesError{Type1: &BasicType{"bool"}, Type2: &BasicType{"int"}}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.err.Diagnostic().Notes)
+		})
+	}
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	source := []byte("func main() {\n    x := 1\n    print(1 + \"a\")\n}")
+	errs := []CompileError{
+		&UnusedVariableError{
+			Loc:  &Location{Start: 18, End: 24, Line: 2, Col: 5, EndLine: 2, EndCol: 11, File: "main.mq"},
+			Name: "x",
+		},
+		&IncompatibleTypesError{
+			Loc:   &Location{Start: 35, End: 42, Line: 3, Col: 11, EndLine: 3, EndCol: 18, File: "main.mq"},
+			Type1: &BasicType{"int"},
+			Type2: &BasicType{"string"},
+		},
+	}
+
+	t.Run("Text", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, WriteDiagnostics(&out, FormatText, errs, source))
+		assert.Contains(t, out.String(), "main.mq:3:11: error[E0003]: incompatible types: 'int' and 'string'\n")
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, WriteDiagnostics(&out, FormatJSON, errs, source))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		assert.Len(t, lines, 2)
+
+		var got diagnosticRecord
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &got))
+		assert.Equal(t, "main.mq", got.File)
+		assert.Equal(t, uint64(3), got.Line)
+		assert.Equal(t, uint64(11), got.Column)
+		assert.Equal(t, &spanRecord{Start: 35, End: 42}, got.Span)
+		assert.Equal(t, "error", got.Severity)
+		assert.Equal(t, "E0003", got.Code)
+		assert.Equal(t, "incompatible types: 'int' and 'string'", got.Message)
+	})
+
+	t.Run("SARIF", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, WriteDiagnostics(&out, FormatSARIF, errs, source))
+
+		var got sarifLog
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &got))
+		assert.Equal(t, "2.1.0", got.Version)
+		assert.Len(t, got.Runs, 1)
+
+		run := got.Runs[0]
+		assert.Equal(t, []sarifRule{{ID: "E0007"}, {ID: "E0003"}}, run.Tool.Driver.Rules)
+		assert.Len(t, run.Results, 2)
+		assert.Equal(t, "E0003", run.Results[1].RuleID)
+		assert.Equal(t, "error", run.Results[1].Level)
+		assert.Equal(t, sarifRegion{
+			StartLine:   3,
+			StartColumn: 11,
+			EndLine:     3,
+			EndColumn:   18,
+			ByteOffset:  35,
+			ByteLength:  7,
+		}, run.Results[1].Locations[0].PhysicalLocation.Region)
+		assert.Len(t, run.Results[0].Fixes, 1)
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		assert.Error(t, WriteDiagnostics(&bytes.Buffer{}, "xml", errs, source))
+	})
+}
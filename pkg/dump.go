@@ -0,0 +1,146 @@
+package maqui
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DumpTokens writes one token per line, with its position, type and value. Lexer errors are written as any other
+// token.
+func DumpTokens(w io.Writer, tokens []Token) error {
+	for _, tok := range tokens {
+		pos := "-"
+		if tok.Loc != nil {
+			pos = fmt.Sprintf("%d:%d", tok.Loc.Line, tok.Loc.Col)
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%q\n", pos, tok.Typ, tok.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DumpAST writes the annotated AST as an indented tree, one expression per line. Each line holds the kind of the
+// expression, its details, the resolved type when there's one and its position.
+func DumpAST(w io.Writer, ast *AST) error {
+	d := &astDumper{w: w}
+	for _, stmt := range ast.Statements {
+		d.stab = stmt.Stab
+		d.expr(stmt.Expr, 0)
+	}
+
+	return d.err
+}
+
+// astDumper holds the state of [DumpAST]. The first write error is kept, and the rest of the writes are skipped.
+type astDumper struct {
+	w    io.Writer
+	err  error
+	stab *SymbolTable
+}
+
+// line writes a single expression
+func (d *astDumper) line(depth int, loc *Location, t Type, format string, args ...interface{}) {
+	if d.err != nil {
+		return
+	}
+
+	text := fmt.Sprintf(format, args...)
+	if t != nil {
+		text += ": " + t.String()
+	}
+
+	if loc != nil {
+		text += fmt.Sprintf(" <%d:%d>", loc.Line, loc.Col)
+	}
+
+	_, d.err = fmt.Fprintf(d.w, "%s%s\n", strings.Repeat("  ", depth), text)
+}
+
+// expr writes the expression and its children, indented one level deeper
+func (d *astDumper) expr(expr Expr, depth int) {
+	switch e := expr.(type) {
+	case *BadExpr:
+		d.line(depth, e.Location, nil, "BadExpr %q", e.Error)
+	case *FuncDecl:
+		d.line(depth, e.Location, nil, "FuncDecl %s", e.Name)
+		d.exprs(e.Body, depth+1)
+	case *VariableDecl:
+		d.line(depth, e.Location, e.ResolvedType, "VariableDecl %s", e.Name)
+		d.expr(e.Value, depth+1)
+	case *FuncCall:
+		var t Type
+		if f, ok := d.stab.Get(e.Name).(*FuncType); ok && len(f.Returns) > 0 {
+			t = f.Returns[0]
+		}
+
+		d.line(depth, e.Location, t, "FuncCall %s", e.Name)
+		d.exprs(e.Args, depth+1)
+	case *Identifier:
+		d.line(depth, e.Location, d.stab.Get(e.Name), "Identifier %s", e.Name)
+	case *BinaryExpr:
+		d.line(depth, e.Location, e.ResolvedType, "BinaryExpr %s", e.Operation)
+		d.expr(e.Op1, depth+1)
+		d.expr(e.Op2, depth+1)
+	case *BooleanExpr:
+		d.line(depth, e.Location, e.ResolvedType, "BooleanExpr %s", e.Operation)
+		d.expr(e.Op1, depth+1)
+		d.expr(e.Op2, depth+1)
+	case *UnaryExpr:
+		d.line(depth, e.Location, e.ResolvedType, "UnaryExpr %s", e.Operation)
+		d.expr(e.Operand, depth+1)
+	case *LiteralExpr:
+		d.line(depth, e.Location, nil, "LiteralExpr %s", literalText(e))
+	case *InterpolationExpr:
+		d.line(depth, e.Location, &BasicType{"string"}, "InterpolationExpr")
+		for i, v := range e.Values {
+			d.line(depth+1, nil, nil, "Text %q", e.Texts[i])
+			d.expr(v.Value, depth+1)
+			if v.Format != "" {
+				d.line(depth+1, v.FormatLoc, nil, "Format %q", v.Format)
+			}
+		}
+		d.line(depth+1, nil, nil, "Text %q", e.Texts[len(e.Values)])
+	case *IfExpr:
+		d.line(depth, e.Location, nil, "IfExpr")
+		d.expr(e.Condition, depth+1)
+		d.line(depth+1, nil, nil, "Then")
+		d.exprs(e.Consequent, depth+2)
+		if len(e.Else) > 0 {
+			d.line(depth+1, nil, nil, "Else")
+			d.exprs(e.Else, depth+2)
+		}
+	case *ConversionExpr:
+		d.line(depth, e.Location, e.ResolvedType, "ConversionExpr %s", e.Type)
+		d.expr(e.Value, depth+1)
+	case nil:
+		d.line(depth, nil, nil, "<nil>")
+	default:
+		d.line(depth, expr.GetLocation(), nil, "%T", expr)
+	}
+}
+
+// exprs writes a list of expressions at the same depth
+func (d *astDumper) exprs(exprs []Expr, depth int) {
+	for _, e := range exprs {
+		d.expr(e, depth)
+	}
+}
+
+// literalText returns the literal as written in the source code, quoting strings and runes
+func literalText(e *LiteralExpr) string {
+	switch e.Typ {
+	case LiteralString:
+		return fmt.Sprintf("%q", e.Value)
+	case LiteralRune:
+		r, _ := utf8.DecodeRuneInString(e.Value)
+		return strconv.QuoteRune(r)
+	default:
+		return e.Value
+	}
+}
@@ -0,0 +1,51 @@
+package maqui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpTokens(t *testing.T) {
+	tokens := []Token{
+		{TokenIdentifier, "x", &Location{Line: 1, Col: 1}},
+		{TokenDeclaration, ":=", &Location{Line: 1, Col: 3}},
+		{TokenString, "a\tb", &Location{Line: 1, Col: 6}},
+		{TokenSemicolon, "\n", &Location{Line: 1, Col: 12}},
+		{TokenEOF, "", nil},
+	}
+
+	var b strings.Builder
+	assert.NoError(t, DumpTokens(&b, tokens))
+	assert.Equal(t, "1:1\tIdentifier\t\"x\"\n"+
+		"1:3\tDeclaration\t\":=\"\n"+
+		"1:6\tString\t\"a\\tb\"\n"+
+		"1:12\tSemicolon\t\"\\n\"\n"+
+		"-\tEOF\t\"\"\n", b.String())
+}
+
+func TestDumpAST(t *testing.T) {
+	ast := analyzeSource("func main() {\n    x := 1 + 2\n    if x == 3 {\n        print(-x)\n    } else {\n        print(int32('a'))\n    }\n}")
+
+	var b strings.Builder
+	assert.NoError(t, DumpAST(&b, ast))
+	assert.Equal(t, `FuncDecl main <1:1>
+  VariableDecl x: int <2:5>
+    BinaryExpr +: int <2:10>
+      LiteralExpr 1 <2:10>
+      LiteralExpr 2 <2:14>
+  IfExpr <3:5>
+    BooleanExpr ==: int <3:8>
+      Identifier x: int <3:8>
+      LiteralExpr 3 <3:13>
+    Then
+      FuncCall print <4:9>
+        UnaryExpr -: int <4:15>
+          Identifier x: int <4:16>
+    Else
+      FuncCall print <6:9>
+        ConversionExpr int32: int32 <6:15>
+          LiteralExpr 'a' <6:21>
+`, b.String())
+}
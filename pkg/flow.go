@@ -0,0 +1,339 @@
+package maqui
+
+// flowEventKind defines what happened to a local variable at a given point of the control flow.
+type flowEventKind int
+
+const (
+	// flowRead marks a read of a variable, for example when it's used as an operand or argument
+	flowRead flowEventKind = iota
+	// flowDeclare marks a variable declaration (:=), after which the variable is considered initialized
+	flowDeclare
+)
+
+// flowEvent is a read or declaration of a variable, in the order it's evaluated inside a [flowBlock].
+type flowEvent struct {
+	// kind is the type of event
+	kind flowEventKind
+	// name is the name of the variable being read or declared
+	name string
+	// loc points to the source code that generated the event
+	loc *Location
+}
+
+// flowBlock is a basic block of the control-flow graph. Events inside a block are always evaluated sequentially, and
+// control can only enter the block from its predecessors and leave it through its successors.
+type flowBlock struct {
+	// events are the reads and declarations in evaluation order
+	events []flowEvent
+	// preds are the blocks that might transfer control to this block
+	preds []*flowBlock
+	// succs are the blocks this block might transfer control to
+	succs []*flowBlock
+}
+
+// flowGraph is a control-flow graph built over the body of a function. It's used to run flow-sensitive checks over
+// local variables, such as reads before their declaration or reads of variables that are only declared on some paths.
+type flowGraph struct {
+	// entry is the first block to run once the function is called
+	entry *flowBlock
+	// blocks holds all blocks of the graph. The entry block is always the first one.
+	blocks []*flowBlock
+	// locals is the set of variables declared inside the function
+	locals map[string]bool
+}
+
+// newFlowGraph builds the control-flow graph of a function body.
+func newFlowGraph(body []Expr) *flowGraph {
+	g := &flowGraph{
+		locals: make(map[string]bool),
+	}
+
+	g.entry = g.newBlock()
+	g.statements(g.entry, body)
+
+	return g
+}
+
+// newBlock creates an empty block and adds it to the graph
+func (g *flowGraph) newBlock() *flowBlock {
+	b := &flowBlock{}
+	g.blocks = append(g.blocks, b)
+
+	return b
+}
+
+// link adds an edge between two blocks, so control can flow from the first into the second one
+func (g *flowGraph) link(from *flowBlock, to *flowBlock) {
+	from.succs = append(from.succs, to)
+	to.preds = append(to.preds, from)
+}
+
+// statements adds a list of statements to the graph starting at the provided block. It returns the block where control
+// continues once all statements were evaluated.
+func (g *flowGraph) statements(b *flowBlock, exprs []Expr) *flowBlock {
+	for _, expr := range exprs {
+		b = g.statement(b, expr)
+	}
+
+	return b
+}
+
+// statement adds a single statement to the graph and returns the block where control continues afterwards. Branching
+// statements will create new blocks, while any other statement is appended to the current block.
+func (g *flowGraph) statement(b *flowBlock, expr Expr) *flowBlock {
+	e, isIf := expr.(*IfExpr)
+	if !isIf {
+		g.expr(b, expr)
+		return b
+	}
+
+	g.expr(b, e.Condition)
+
+	consequent := g.newBlock()
+	g.link(b, consequent)
+	exits := []*flowBlock{g.statements(consequent, e.Consequent)}
+
+	if e.Else == nil {
+		exits = append(exits, b)
+	} else {
+		alternative := g.newBlock()
+		g.link(b, alternative)
+		exits = append(exits, g.statements(alternative, e.Else))
+	}
+
+	// The join block is created last, so blocks are kept in source order
+	join := g.newBlock()
+	for _, exit := range exits {
+		g.link(exit, join)
+	}
+
+	return join
+}
+
+// expr appends the events of an expression to the block in the same order the expression is evaluated
+func (g *flowGraph) expr(b *flowBlock, expr Expr) {
+	switch e := expr.(type) {
+	case *VariableDecl:
+		g.expr(b, e.Value)
+
+		g.locals[e.Name] = true
+		b.events = append(b.events, flowEvent{flowDeclare, e.Name, e.GetLocation()})
+	case *Identifier:
+		b.events = append(b.events, flowEvent{flowRead, e.Name, e.GetLocation()})
+	case *FuncCall:
+		// The callee is read too, a local called by mistake is reported by the context analyzer
+		b.events = append(b.events, flowEvent{flowRead, e.Name, e.GetLocation()})
+
+		for _, arg := range e.Args {
+			g.expr(b, arg)
+		}
+	case *BinaryExpr:
+		g.expr(b, e.Op1)
+		g.expr(b, e.Op2)
+	case *BooleanExpr:
+		g.expr(b, e.Op1)
+		g.expr(b, e.Op2)
+	case *UnaryExpr:
+		g.expr(b, e.Operand)
+	case *ConversionExpr:
+		g.expr(b, e.Value)
+	case *InterpolationExpr:
+		for _, v := range e.Values {
+			g.expr(b, v.Value)
+		}
+	}
+}
+
+// flowState holds the variables that are initialized at a point of the control flow. Definite variables are
+// initialized on every path that reaches the point, while possible variables are initialized on at least one path.
+type flowState struct {
+	definite map[string]bool
+	possible map[string]bool
+}
+
+// newFlowState creates a state where no variable is initialized
+func newFlowState() flowState {
+	return flowState{
+		definite: make(map[string]bool),
+		possible: make(map[string]bool),
+	}
+}
+
+// copy creates a new state with the same initialized variables
+func (s flowState) copy() flowState {
+	s2 := newFlowState()
+	for k := range s.definite {
+		s2.definite[k] = true
+	}
+
+	for k := range s.possible {
+		s2.possible[k] = true
+	}
+
+	return s2
+}
+
+// equals returns true if both states have the same initialized variables
+func (s flowState) equals(s2 flowState) bool {
+	return sameKeys(s.definite, s2.definite) && sameKeys(s.possible, s2.possible)
+}
+
+// sameKeys returns true if both sets contain the same keys
+func sameKeys(a map[string]bool, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// in computes the state at the start of a block by merging the states at the end of its predecessors. A variable is
+// definitely initialized only if it's initialized at the end of every predecessor.
+func (g *flowGraph) in(b *flowBlock, out map[*flowBlock]flowState) flowState {
+	state := newFlowState()
+
+	merged := false
+	for _, pred := range b.preds {
+		predOut, visited := out[pred]
+		if !visited {
+			continue // Not reached yet, it will be merged on the next iteration
+		}
+
+		for k := range predOut.possible {
+			state.possible[k] = true
+		}
+
+		if !merged {
+			for k := range predOut.definite {
+				state.definite[k] = true
+			}
+
+			merged = true
+			continue
+		}
+
+		for k := range state.definite {
+			if !predOut.definite[k] {
+				delete(state.definite, k)
+			}
+		}
+	}
+
+	return state
+}
+
+// transfer applies the declarations of a block over the state at its start, returning the state at its end
+func (g *flowGraph) transfer(b *flowBlock, state flowState) flowState {
+	state = state.copy()
+	for _, ev := range b.events {
+		if ev.kind == flowDeclare {
+			state.definite[ev.name] = true
+			state.possible[ev.name] = true
+		}
+	}
+
+	return state
+}
+
+// solve runs the data-flow analysis until a fixed point is reached, and returns the state at the start of each block
+func (g *flowGraph) solve() map[*flowBlock]flowState {
+	in := make(map[*flowBlock]flowState)
+	out := make(map[*flowBlock]flowState)
+
+	for changed := true; changed; {
+		changed = false
+
+		for _, b := range g.blocks {
+			if b != g.entry && len(b.preds) == 0 {
+				continue // Unreachable
+			}
+
+			bIn := g.in(b, out)
+			bOut := g.transfer(b, bIn)
+
+			if prev, visited := out[b]; !visited || !prev.equals(bOut) {
+				changed = true
+			}
+
+			in[b] = bIn
+			out[b] = bOut
+		}
+	}
+
+	return in
+}
+
+// check runs the flow-sensitive checks over the graph. It reports reads of local variables before they are declared,
+// reads of variables that are not declared on every path, and local variables that are never read. Reads before the
+// declaration of a local that shadows a name of the outer scope are reads of the outer name, so they're not reported.
+func (g *flowGraph) check(outer *SymbolTable) []CompileError {
+	var errs []CompileError
+
+	used := make(map[string]bool)
+	in := g.solve()
+
+	// Blocks are kept in source order, so the first declaration found is the first one in the code
+	decls := make(map[string]*Location)
+	for _, b := range g.blocks {
+		for _, ev := range b.events {
+			if _, found := decls[ev.name]; ev.kind == flowDeclare && !found {
+				decls[ev.name] = ev.loc
+			}
+		}
+	}
+
+	for _, b := range g.blocks {
+		state, reachable := in[b]
+		if !reachable {
+			continue
+		}
+
+		state = state.copy()
+		for _, ev := range b.events {
+			if ev.kind == flowDeclare {
+				state.definite[ev.name] = true
+				state.possible[ev.name] = true
+				continue
+			}
+
+			if !g.locals[ev.name] {
+				continue // Not a local, the context analyzer is in charge of resolving it
+			}
+
+			if !state.possible[ev.name] && outer.Get(ev.name) != nil {
+				continue // Not declared yet, so it's the name of the outer scope
+			}
+
+			used[ev.name] = true
+
+			switch {
+			case state.definite[ev.name]:
+				continue
+			case state.possible[ev.name]:
+				errs = append(errs, &UninitializedError{Loc: ev.loc, Name: ev.name, Decl: decls[ev.name]})
+			default:
+				errs = append(errs, &UseBeforeDeclarationError{Loc: ev.loc, Name: ev.name, Decl: decls[ev.name]})
+			}
+		}
+	}
+
+	// Blocks are kept in source order, so unused variables are reported at their first declaration
+	for _, b := range g.blocks {
+		for _, ev := range b.events {
+			if ev.kind != flowDeclare || used[ev.name] || ev.name == "_" {
+				continue
+			}
+
+			used[ev.name] = true // Report only once
+			errs = append(errs, &UnusedVariableError{Loc: ev.loc, Name: ev.name})
+		}
+	}
+
+	return errs
+}
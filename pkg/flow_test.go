@@ -0,0 +1,204 @@
+package maqui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowCheck(t *testing.T) {
+	one := &LiteralExpr{Typ: LiteralNumber, Value: "1"}
+	cond := &BooleanExpr{Operation: BooleanEquals, Op1: one, Op2: one}
+	use := func(name string) Expr {
+		return &FuncCall{Name: "print", Args: []Expr{&Identifier{Name: name}}}
+	}
+
+	cases := []struct {
+		name   string
+		body   []Expr
+		expect []CompileError
+	}{
+		{
+			"DeclaredAndUsed",
+			[]Expr{
+				&VariableDecl{Name: "x", Value: one},
+				use("x"),
+			},
+			nil,
+		},
+		{
+			"UseBeforeDeclaration",
+			[]Expr{
+				use("x"),
+				&VariableDecl{Name: "x", Value: one},
+			},
+			[]CompileError{
+				&UseBeforeDeclarationError{Name: "x"},
+			},
+		},
+		{
+			"SelfReferencingDeclaration",
+			[]Expr{
+				&VariableDecl{Name: "x", Value: &Identifier{Name: "x"}},
+			},
+			[]CompileError{
+				&UseBeforeDeclarationError{Name: "x"},
+			},
+		},
+		{
+			"DeclaredInOneBranch",
+			[]Expr{
+				&IfExpr{
+					Condition:  cond,
+					Consequent: []Expr{&VariableDecl{Name: "x", Value: one}},
+				},
+				use("x"),
+			},
+			[]CompileError{
+				&UninitializedError{Name: "x"},
+			},
+		},
+		{
+			"DeclaredOnlyInElse",
+			[]Expr{
+				&IfExpr{
+					Condition:  cond,
+					Consequent: []Expr{use("y")},
+					Else:       []Expr{&VariableDecl{Name: "x", Value: one}},
+				},
+				use("x"),
+			},
+			[]CompileError{
+				&UninitializedError{Name: "x"},
+			},
+		},
+		{
+			"DeclaredInBothBranches",
+			[]Expr{
+				&IfExpr{
+					Condition:  cond,
+					Consequent: []Expr{&VariableDecl{Name: "x", Value: one}},
+					Else:       []Expr{&VariableDecl{Name: "x", Value: one}},
+				},
+				use("x"),
+			},
+			nil,
+		},
+		{
+			"DeclaredInNestedBranches",
+			[]Expr{
+				&IfExpr{
+					Condition: cond,
+					Consequent: []Expr{
+						&IfExpr{
+							Condition:  cond,
+							Consequent: []Expr{&VariableDecl{Name: "x", Value: one}},
+							Else:       []Expr{&VariableDecl{Name: "x", Value: one}},
+						},
+					},
+					Else: []Expr{&VariableDecl{Name: "x", Value: one}},
+				},
+				use("x"),
+			},
+			nil,
+		},
+		{
+			"Unused",
+			[]Expr{
+				&VariableDecl{Name: "x", Value: one},
+				&VariableDecl{Name: "y", Value: one},
+				use("y"),
+			},
+			[]CompileError{
+				&UnusedVariableError{Name: "x"},
+			},
+		},
+		{
+			"UnusedBlank",
+			[]Expr{
+				&VariableDecl{Name: "_", Value: one},
+			},
+			nil,
+		},
+		{
+			"NonLocal",
+			[]Expr{
+				use("global"),
+			},
+			nil,
+		},
+		{
+			"ShadowsGlobal",
+			[]Expr{
+				&VariableDecl{
+					Name:  "global",
+					Value: &BinaryExpr{Operation: BinaryAddition, Op1: &Identifier{Name: "global"}, Op2: one},
+				},
+				use("global"),
+			},
+			nil,
+		},
+		{
+			"UnusedShadowingGlobal",
+			[]Expr{
+				use("global"),
+				&VariableDecl{Name: "global", Value: one},
+			},
+			[]CompileError{
+				&UnusedVariableError{Name: "global"},
+			},
+		},
+		{
+			"Called",
+			[]Expr{
+				&VariableDecl{Name: "x", Value: one},
+				&FuncCall{Name: "x"},
+			},
+			nil,
+		},
+		{
+			"CalledBeforeDeclaration",
+			[]Expr{
+				&FuncCall{Name: "x"},
+				&VariableDecl{Name: "x", Value: one},
+			},
+			[]CompileError{
+				&UseBeforeDeclarationError{Name: "x"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			outer := NewGlobalSymbolTable()
+			outer.Add("global", &BasicType{"int"})
+
+			assert.Equal(t, c.expect, newFlowGraph(c.body).check(outer))
+		})
+	}
+}
+
+func TestFlowCheckSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect []string
+	}{
+		{"ShadowsGlobal", "x := 1\nfunc main() {\n    x := x + 1\n    print(x)\n}", nil},
+		{"ShadowsBuiltin", "func main() {\n    formatInt := formatInt(1)\n    print(formatInt)\n}", nil},
+		{"CalledLocal", "func main() {\n    x := 1\n    print(x())\n}", []string{CodeNotCallable}},
+		{"UseBeforeDeclaration", "func main() {\n    y := x + 1\n    x := y\n    print(x)\n}",
+			[]string{CodeUseBeforeDeclaration}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var codes []string
+			for _, err := range analyzeSource(c.input).Errors {
+				codes = append(codes, err.Diagnostic().Code)
+			}
+
+			assert.Equal(t, c.expect, codes)
+		})
+	}
+}
@@ -0,0 +1,482 @@
+package maqui
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// formatSpec is a directive of a format string, such as the %08x of printf. It formats a value with a verb, optionally
+// preceded by flags, a width and a precision.
+type formatSpec struct {
+	// flags are any of '+', '-', '#', ' ' and '0'
+	flags string
+	// width is the minimum width in characters, empty if not set
+	width string
+	// precision includes the leading dot, as in ".2". It's empty if not set.
+	precision string
+	// verb chooses how the value is formatted, see formatVerbs
+	verb rune
+}
+
+func (s *formatSpec) String() string {
+	return "%" + s.flags + s.width + s.precision + string(s.verb)
+}
+
+// formatVerb describes the values a verb can format
+type formatVerb struct {
+	// accepts returns true if the verb can format a value of the type
+	accepts func(t Type) bool
+	// expects describes the values accepted, for error messages
+	expects string
+}
+
+// formatVerbs holds the verbs of the format strings. They are a subset of the verbs of Go, which can be translated to
+// the conversions of C.
+var formatVerbs = map[rune]formatVerb{
+	'v': {func(t Type) bool { return true }, "any value"},
+	'd': {isInteger, "an integer"},
+	'x': {isInteger, "an integer"},
+	'X': {isInteger, "an integer"},
+	'o': {isInteger, "an integer"},
+	'c': {isInteger, "a rune"},
+	'e': {isFloat, "a floating point number"},
+	'E': {isFloat, "a floating point number"},
+	'f': {isFloat, "a floating point number"},
+	'F': {isFloat, "a floating point number"},
+	'g': {isFloat, "a floating point number"},
+	'G': {isFloat, "a floating point number"},
+	's': {isString, "a string"},
+	't': {isBool, "a bool"},
+}
+
+// formatPart is a piece of a format string. It's either literal text, or a directive that formats the next argument.
+type formatPart struct {
+	text string
+	spec *formatSpec
+}
+
+// parseFormat splits a format string into literal text and directives. A percent sign starts a directive, and %%
+// stands for a literal percent sign.
+func parseFormat(format string) ([]formatPart, error) {
+	var parts []formatPart
+	var text strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			text.WriteByte(format[i])
+			continue
+		}
+
+		if i+1 < len(format) && format[i+1] == '%' {
+			text.WriteByte('%')
+			i++
+
+			continue
+		}
+
+		end := i + 1 + strings.IndexFunc(format[i+1:], func(r rune) bool {
+			return !strings.ContainsRune(formatFlags+"0123456789.", r)
+		})
+		if end == i {
+			return nil, fmt.Errorf("missing verb at end of '%s'", format[i:])
+		}
+
+		_, size := utf8.DecodeRuneInString(format[end:])
+		spec, err := parseSpec(format[i+1 : end+size])
+		if err != nil {
+			return nil, fmt.Errorf("%s in '%s'", err, format[i:end+size])
+		}
+
+		if text.Len() != 0 {
+			parts = append(parts, formatPart{text: text.String()})
+			text.Reset()
+		}
+
+		parts = append(parts, formatPart{spec: spec})
+		i = end + size - 1
+	}
+
+	if text.Len() != 0 {
+		parts = append(parts, formatPart{text: text.String()})
+	}
+
+	return parts, nil
+}
+
+// formatFlags are the characters accepted as flags of a directive
+const formatFlags = "+-# 0"
+
+// parseSpec parses a directive without its percent sign, such as 08x
+func parseSpec(s string) (*formatSpec, error) {
+	spec := &formatSpec{}
+	rest := s
+
+	flags := strings.IndexFunc(rest, func(r rune) bool { return !strings.ContainsRune(formatFlags, r) })
+	if flags < 0 {
+		flags = len(rest)
+	}
+	spec.flags, rest = rest[:flags], rest[flags:]
+
+	digits := func(s string) int {
+		n := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+		if n < 0 {
+			return len(s)
+		}
+
+		return n
+	}
+
+	width := digits(rest)
+	spec.width, rest = rest[:width], rest[width:]
+
+	if strings.HasPrefix(rest, ".") {
+		precision := 1 + digits(rest[1:])
+		spec.precision, rest = rest[:precision], rest[precision:]
+	}
+
+	if rest == "" {
+		return nil, fmt.Errorf("missing verb")
+	}
+
+	verb, size := utf8.DecodeRuneInString(rest)
+	if _, ok := formatVerbs[verb]; !ok {
+		return nil, fmt.Errorf("unknown verb '%c'", verb)
+	}
+
+	if size != len(rest) {
+		return nil, fmt.Errorf("unexpected '%s' after the verb", rest[size:])
+	}
+
+	spec.verb = verb
+
+	return spec, nil
+}
+
+// formatArgs returns the number of arguments formatted by the parts
+func formatArgs(parts []formatPart) int {
+	n := 0
+	for _, p := range parts {
+		if p.spec != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// defaultSpec is the directive used by print and println, which format every value in its default format
+var defaultSpec = &formatSpec{verb: 'v'}
+
+// printParts returns the parts of a call to print or println with n arguments. print writes the arguments one after
+// the other, while println separates them with spaces and ends the line.
+func printParts(name string, n int) []formatPart {
+	var parts []formatPart
+	for i := 0; i < n; i++ {
+		if name == "println" && i != 0 {
+			parts = append(parts, formatPart{text: " "})
+		}
+
+		parts = append(parts, formatPart{spec: defaultSpec})
+	}
+
+	if name == "println" {
+		parts = append(parts, formatPart{text: "\n"})
+	}
+
+	return parts
+}
+
+// formatted is the kind of the values taken by the formatters of the runtime. Every value is converted to one of
+// them, see formatArg.
+type formatted int
+
+const (
+	formattedInt formatted = iota
+	formattedFloat
+	formattedString
+)
+
+// printers holds the function of the runtime that prints each kind of value
+var printers = [...]string{builtinPrintInt, builtinPrintFloat, builtinPrintString}
+
+// appenders holds the function of the runtime that appends each kind of value to a string builder
+var appenders = [...]string{builtinAppendInt, builtinAppendFloat, builtinAppendString}
+
+// print emits a call to print, println or printf. The arguments are evaluated first, and then every part is written by
+// the printer of the runtime for its kind of value.
+func (b *LLVMIRBuilder) print(expr *FuncCall) []ir.Instruction {
+	args := expr.Args
+	parts := printParts(expr.Name, len(args))
+	typs := expr.ResolvedTypes
+
+	if expr.Name == "printf" {
+		// The format was validated by the semantic analysis
+		parts, _ = parseFormat(expr.Args[0].(*LiteralExpr).Value)
+		args, typs = args[1:], typs[1:]
+	}
+
+	var ins []ir.Instruction
+	var vals []value.Value
+	for i, arg := range args {
+		v, argIns := b.loadAs(arg, typs[i])
+
+		ins = append(ins, argIns...)
+		vals = append(vals, v)
+	}
+
+	for _, part := range parts {
+		if part.spec == nil {
+			ins = append(ins, ir.NewCall(b.values.Get(builtinPrintString), b.message("%s"), b.message(part.text)))
+			continue
+		}
+
+		v, format, kind, argIns := b.formatArg(vals[0], typs[0], part.spec)
+		ins = append(ins, argIns...)
+		ins = append(ins, ir.NewCall(b.values.Get(printers[kind]), b.message(format), v))
+
+		vals, typs = vals[1:], typs[1:]
+	}
+
+	return ins
+}
+
+// interpolation builds the string of an *InterpolationExpr with a string builder of the runtime. The embedded
+// expressions are evaluated first, and then the text and the values are appended in order.
+func (b *LLVMIRBuilder) interpolation(expr *InterpolationExpr) (value.Value, []ir.Instruction) {
+	var ins []ir.Instruction
+	var vals []value.Value
+	for _, v := range expr.Values {
+		val, valIns := b.loadAs(v.Value, v.ResolvedType)
+
+		ins = append(ins, valIns...)
+		vals = append(vals, val)
+	}
+
+	// The builder starts with room for the text, and a few characters for each value
+	size := 1 + builderValueSize*len(expr.Values)
+	for _, text := range expr.Texts {
+		size += len(text)
+	}
+
+	builder := ir.NewCall(b.values.Get(builtinNewBuilder), constant.NewInt(sizeT(b.sizes), int64(size)))
+	ins = append(ins, builder)
+
+	appendText := func(text string) {
+		if text != "" {
+			ins = append(ins, ir.NewCall(b.values.Get(builtinAppendString), builder, b.message("%s"), b.message(text)))
+		}
+	}
+
+	for i, v := range expr.Values {
+		appendText(expr.Texts[i])
+
+		spec := defaultSpec
+		if v.Format != "" {
+			// The specifier was validated by the semantic analysis
+			spec, _ = parseSpec(v.Format)
+		}
+
+		arg, format, kind, argIns := b.formatArg(vals[i], v.ResolvedType, spec)
+		ins = append(ins, argIns...)
+		ins = append(ins, ir.NewCall(b.values.Get(appenders[kind]), builder, b.message(format), arg))
+	}
+
+	appendText(expr.Texts[len(expr.Values)])
+
+	str := ir.NewCall(b.values.Get(builtinBuilderString), builder)
+	return str, append(ins, str)
+}
+
+// formatArg converts a value to the argument of a formatter of the runtime, and returns the format of C that writes
+// it with the directive. Integers are widened to 64 bits, float32 to float64, and runes and bools are written as
+// strings, so the runtime has a single formatter for each kind of value.
+func (b *LLVMIRBuilder) formatArg(v value.Value, t Type, spec *formatSpec) (value.Value, string, formatted,
+	[]ir.Instruction) {
+	var ins []ir.Instruction
+	format := "%" + spec.flags + spec.width + spec.precision
+
+	switch {
+	case isInteger(t) && spec.verb == 'c':
+		v, ins = b.runeToString(v, t, nil)
+		return v, format + "s", formattedString, ins
+	case isInteger(t):
+		// Signed integers are only extended with their sign in decimal, other bases write the bits of the value
+		signed := isSigned(t) && (spec.verb == 'd' || spec.verb == 'v')
+
+		switch size := b.sizes.of(t.(*BasicType).Typ); {
+		case size < 64 && signed:
+			ext := ir.NewSExt(v, types.I64)
+
+			v = ext
+			ins = append(ins, ext)
+		case size < 64:
+			ext := ir.NewZExt(v, types.I64)
+
+			v = ext
+			ins = append(ins, ext)
+		}
+
+		conversion := map[rune]string{'x': "llx", 'X': "llX", 'o': "llo"}[spec.verb]
+		switch {
+		case conversion != "":
+		case signed:
+			conversion = "lld"
+		default:
+			conversion = "llu"
+		}
+
+		return v, format + conversion, formattedInt, ins
+	case isFloat(t):
+		if b.sizes.of(t.(*BasicType).Typ) < 64 {
+			ext := ir.NewFPExt(v, types.Double)
+
+			v = ext
+			ins = append(ins, ext)
+		}
+
+		verb := spec.verb
+		if verb == 'v' {
+			verb = 'g'
+		}
+
+		return v, format + string(verb), formattedFloat, ins
+	case isBool(t):
+		sel := ir.NewSelect(v, b.message("true"), b.message("false"))
+		return sel, format + "s", formattedString, append(ins, sel)
+	default:
+		return v, format + "s", formattedString, ins
+	}
+}
+
+// builtinPrinter defines a printer of the runtime, which writes a value of the type to the standard output with a
+// format of C
+func builtinPrinter(param types.Type) funcDefinition {
+	return func(mod *ir.Module, s sizes) *ir.Func {
+		f := mod.NewFunc("", types.Void, ir.NewParam("format", types.I8Ptr), ir.NewParam("v", param))
+		b := f.NewBlock("")
+
+		printf := externalFunc(mod, "printf", types.I32, true, ir.NewParam("format", types.I8Ptr))
+		b.NewCall(printf, f.Params[0], f.Params[1])
+		b.NewRet(nil)
+
+		return f
+	}
+}
+
+// builderValueSize is the room reserved in a string builder for each embedded value
+const builderValueSize = 16
+
+// builderType returns the type of the string builders of the runtime. They hold the string being built, which is
+// always null-terminated, its length and the size of its buffer. The generated code handles them as opaque pointers.
+func builderType(s sizes) *types.StructType {
+	return types.NewStruct(types.I8Ptr, sizeT(s), sizeT(s))
+}
+
+// builderFields returns pointers to the buffer, the length and the size of a string builder
+func builderFields(b *ir.Block, s sizes, builder value.Value) (value.Value, value.Value, value.Value) {
+	typ := builderType(s)
+	sb := b.NewBitCast(builder, types.NewPointer(typ))
+
+	field := func(i int64) value.Value {
+		return b.NewGetElementPtr(typ, sb, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, i))
+	}
+
+	return field(0), field(1), field(2)
+}
+
+// builtinNewBuilderFunc allocates an empty string builder with a buffer of the size
+func builtinNewBuilderFunc(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.I8Ptr, ir.NewParam("size", sizeT(s)))
+	b := f.NewBlock("")
+
+	alloc := lookupFunc(mod, runtimeAlloc)
+	builder := b.NewCall(alloc, constant.NewInt(sizeT(s), int64(3*s.word/8)))
+	buf := b.NewCall(alloc, f.Params[0])
+	b.NewStore(constant.NewInt(types.I8, 0), buf)
+
+	bufPtr, lenPtr, sizePtr := builderFields(b, s, builder)
+	b.NewStore(buf, bufPtr)
+	b.NewStore(constant.NewInt(sizeT(s), 0), lenPtr)
+	b.NewStore(f.Params[0], sizePtr)
+	b.NewRet(builder)
+
+	return f
+}
+
+// builtinAppender defines a function of the runtime that appends a value of the type to a string builder with a
+// format of C. If the buffer is too small, it's replaced by one twice as large as needed, and the value is written
+// again.
+func builtinAppender(param types.Type) funcDefinition {
+	return func(mod *ir.Module, s sizes) *ir.Func {
+		f := mod.NewFunc("", types.Void,
+			ir.NewParam("builder", types.I8Ptr),
+			ir.NewParam("format", types.I8Ptr),
+			ir.NewParam("v", param),
+		)
+		entry, grow, done := f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+
+		snprintf := externalFunc(mod, "snprintf", types.I32, true,
+			ir.NewParam("buf", types.I8Ptr),
+			ir.NewParam("size", sizeT(s)),
+			ir.NewParam("format", types.I8Ptr),
+		)
+		memcpy := externalFunc(mod, "memcpy", types.I8Ptr, false,
+			ir.NewParam("dst", types.I8Ptr),
+			ir.NewParam("src", types.I8Ptr),
+			ir.NewParam("size", sizeT(s)),
+		)
+		free := externalFunc(mod, "free", types.Void, false, ir.NewParam("ptr", types.I8Ptr))
+
+		// write formats the value at the end of the string, and returns the length of the formatted value
+		write := func(b *ir.Block, buf value.Value, length value.Value, size value.Value) value.Value {
+			end := b.NewGetElementPtr(types.I8, buf, length)
+			n := b.NewCall(snprintf, end, b.NewSub(size, length), f.Params[1], f.Params[2])
+
+			if s.word == 32 {
+				return n
+			}
+
+			return b.NewSExt(n, sizeT(s))
+		}
+
+		bufPtr, lenPtr, sizePtr := builderFields(entry, s, f.Params[0])
+		buf := entry.NewLoad(types.I8Ptr, bufPtr)
+		length := entry.NewLoad(sizeT(s), lenPtr)
+		size := entry.NewLoad(sizeT(s), sizePtr)
+
+		newLength := entry.NewAdd(length, write(entry, buf, length, size))
+		entry.NewCondBr(entry.NewICmp(enum.IPredULT, newLength, size), done, grow)
+
+		newSize := grow.NewMul(grow.NewAdd(newLength, constant.NewInt(sizeT(s), 1)), constant.NewInt(sizeT(s), 2))
+		newBuf := grow.NewCall(lookupFunc(mod, runtimeAlloc), newSize)
+		grow.NewCall(memcpy, newBuf, buf, length)
+		grow.NewCall(free, buf)
+		grow.NewStore(newBuf, bufPtr)
+		grow.NewStore(newSize, sizePtr)
+		write(grow, newBuf, length, newSize)
+		grow.NewBr(done)
+
+		done.NewStore(newLength, lenPtr)
+		done.NewRet(nil)
+
+		return f
+	}
+}
+
+// builtinBuilderStringFunc returns the string built by a string builder
+func builtinBuilderStringFunc(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.I8Ptr, ir.NewParam("builder", types.I8Ptr))
+	b := f.NewBlock("")
+
+	bufPtr, _, _ := builderFields(b, s, f.Params[0])
+	b.NewRet(b.NewLoad(types.I8Ptr, bufPtr))
+
+	return f
+}
@@ -0,0 +1,160 @@
+package maqui
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		format string
+		expect []formatPart
+		err    string
+	}{
+		{"Text", "hello 100%%\n", []formatPart{{text: "hello 100%\n"}}, ""},
+		{"Verb", "x = %d\n", []formatPart{{text: "x = "}, {spec: &formatSpec{verb: 'd'}}, {text: "\n"}}, ""},
+		{"Flags", "%-08.3f%v", []formatPart{
+			{spec: &formatSpec{flags: "-0", width: "8", precision: ".3", verb: 'f'}},
+			{spec: &formatSpec{verb: 'v'}},
+		}, ""},
+		{"UnknownVerb", "%y", nil, "unknown verb 'y' in '%y'"},
+		{"MissingVerb", "x = %08", nil, "missing verb at end of '%08'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			parts, err := parseFormat(c.format)
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, parts)
+		})
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	spec, err := parseSpec("+10x")
+	assert.NoError(t, err)
+	assert.Equal(t, &formatSpec{flags: "+", width: "10", verb: 'x'}, spec)
+	assert.Equal(t, "%+10x", spec.String())
+
+	_, err = parseSpec("dd")
+	assert.EqualError(t, err, "unexpected 'd' after the verb")
+}
+
+func TestPrintDispatch(t *testing.T) {
+	call := func(name string, args ...Type) *FuncCall {
+		e := &FuncCall{Name: name, ResolvedTypes: args}
+		for range args {
+			e.Args = append(e.Args, &Identifier{Name: "x"})
+		}
+
+		return e
+	}
+
+	printf := call("printf", &BasicType{"string"}, &BasicType{"int8"})
+	printf.Args[0] = &LiteralExpr{Typ: LiteralString, Value: "%x|%c\n"}
+	printf.Args = append(printf.Args, &Identifier{Name: "x"})
+	printf.ResolvedTypes = append(printf.ResolvedTypes, &BasicType{"int8"})
+
+	cases := []struct {
+		name   string
+		expr   *FuncCall
+		expect []string
+	}{
+		{"Integer", call("print", &BasicType{"int8"}), []string{"maqui.printInt %lld"}},
+		{"Unsigned", call("print", &BasicType{"uint8"}), []string{"maqui.printInt %llu"}},
+		{"Float", call("print", &BasicType{"float32"}), []string{"maqui.printFloat %g"}},
+		{"Bool", call("print", &BasicType{"bool"}), []string{"maqui.printString %s"}},
+		{"String", call("print", &BasicType{"string"}), []string{"maqui.printString %s"}},
+		{"Println", call("println", &BasicType{"int8"}, &BasicType{"string"}), []string{
+			"maqui.printInt %lld",
+			"maqui.printString %s",
+			"maqui.printString %s",
+			"maqui.printString %s",
+		}},
+		{"Printf", printf, []string{
+			"maqui.printInt %llx",
+			"maqui.printString %s",
+			"maqui.runeToString",
+			"maqui.printString %s",
+			"maqui.printString %s",
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewLLVMIRBuilder(DefaultTarget)
+			b.values.Set("x", ir.NewParam("x", b.llvmType(c.expr.ResolvedTypes[len(c.expr.ResolvedTypes)-1])))
+
+			var calls []string
+			for _, i := range b.instructions(c.expr) {
+				if call, ok := i.(*ir.InstCall); ok {
+					calls = append(calls, callWithFormat(call))
+				}
+			}
+
+			assert.Equal(t, c.expect, calls)
+		})
+	}
+}
+
+// callWithFormat returns the name of the called function, followed by its format if the first argument is a global
+// string
+func callWithFormat(call *ir.InstCall) string {
+	name := call.Callee.(*ir.Func).Name()
+	if len(call.Args) == 0 {
+		return name
+	}
+
+	gep, ok := call.Args[0].(*constant.ExprGetElementPtr)
+	if !ok {
+		return name
+	}
+
+	format := gep.Src.(*ir.Global).Init.(*constant.CharArray).X
+	return name + " " + string(format[:len(format)-1])
+}
+
+func TestInterpolationBuilder(t *testing.T) {
+	expr := &InterpolationExpr{
+		Texts: []string{"x = ", "", "!"},
+		Values: []*Interpolation{
+			{Value: &Identifier{Name: "x"}, Format: "08x", ResolvedType: &BasicType{"int32"}},
+			{Value: &Identifier{Name: "y"}, ResolvedType: &BasicType{"float32"}},
+		},
+	}
+
+	b := NewLLVMIRBuilder(DefaultTarget)
+	b.values.Set("x", ir.NewParam("x", types.I32))
+	b.values.Set("y", ir.NewParam("y", types.Float))
+
+	v, ins := b.interpolation(expr)
+
+	var calls []string
+	for _, i := range ins {
+		if call, ok := i.(*ir.InstCall); ok {
+			calls = append(calls, call.Callee.(*ir.Func).Name())
+		}
+	}
+
+	// Empty texts are not appended
+	assert.Equal(t, []string{
+		"maqui.newBuilder",
+		"maqui.appendString",
+		"maqui.appendInt",
+		"maqui.appendFloat",
+		"maqui.appendString",
+		"maqui.builderString",
+	}, calls)
+	assert.Equal(t, ins[len(ins)-1], v)
+	assert.Contains(t, b.mod.String(), `c"%08llx\00"`)
+}
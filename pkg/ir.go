@@ -3,10 +3,14 @@ package maqui
 import (
 	"fmt"
 	"github.com/llir/llvm/ir/enum"
-	"strconv"
+	"math"
+	"math/big"
+	"sort"
+	"unicode/utf8"
 
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/metadata"
 	"github.com/llir/llvm/ir/types"
 	"github.com/llir/llvm/ir/value"
 )
@@ -49,24 +53,71 @@ type IR interface {
 type LLVMIRBuilder struct {
 	mod    *ir.Module
 	values ValueLookup
+	// sizes holds the size of the basic types on the target of the module
+	sizes sizes
+	// profile decides the runtime checks added to the code
+	profile Profile
+	// debug builds the debug information of the module. It's nil if there's none.
+	debug *debugInfo
+	// strings counts the string literals defined as globals, and it's used to name them
+	strings int
+	// messages holds the strings defined for the runtime, so each one is defined once
+	messages map[string]constant.Constant
+	// builtins holds the names of the built-in functions, whose calls are not recorded in the stack traces
+	builtins map[string]bool
 }
 
-func NewLLVMIRBuilder() *LLVMIRBuilder {
+// NewLLVMIRBuilder creates a builder for a module that targets the provided platform. The zero Target builds for the
+// DefaultTarget.
+func NewLLVMIRBuilder(target Target) *LLVMIRBuilder {
+	if target == (Target{}) {
+		target = DefaultTarget
+	}
+
 	builder := &LLVMIRBuilder{
-		mod:    ir.NewModule(),
-		values: NewValueLookup(),
+		mod:      ir.NewModule(),
+		values:   NewValueLookup(),
+		sizes:    target.sizes(),
+		profile:  ProfileDebug,
+		messages: make(map[string]constant.Constant),
+		builtins: make(map[string]bool),
 	}
 
-	defineBuiltins(builder)
+	builder.mod.TargetTriple = target.String()
+	builder.mod.DataLayout = target.DataLayout()
+
+	declareBuiltins(builder, newRuntime(target))
+	defineChecks(builder)
 	return builder
 }
 
 func (b *LLVMIRBuilder) function(expr *FuncDecl) {
 	// TODO: Allow arguments and returns
-	f := b.mod.NewFunc(expr.Name, types.Void)
+	ret := types.Type(types.Void)
+	if expr.Name == "main" {
+		// The program's entry point returns the process exit code
+		ret = types.I32
+	}
+
+	name := expr.Name
+	if name == "main" {
+		// The runtime library defines the entry point of the program, which calls main
+		name = runtimeMain
+	}
+
+	f := b.mod.NewFunc(name, ret)
 	b.values.Set(expr.Name, f)
 
+	if b.debug != nil {
+		b.debug.function(f, expr)
+	}
+
 	block := f.NewBlock("")
+	if b.profile.Checks {
+		// The frames of the stack traces are pushed when entering the functions, and popped when returning
+		enter := block.NewCall(b.values.Get(runtimeEnter), b.message(expr.Name))
+		b.locate(expr, enter)
+	}
 
 	prevVals := b.values
 	b.values = NewValueLookup()
@@ -76,25 +127,80 @@ func (b *LLVMIRBuilder) function(expr *FuncDecl) {
 		b.values = prevVals
 	}()
 
-	for _, stmt := range expr.Body {
+	blocks, block := b.body(expr.Body, block)
+	f.Blocks = append(f.Blocks, blocks...)
+
+	var leave *ir.InstCall
+	if b.profile.Checks {
+		leave = block.NewCall(b.values.Get(runtimeLeave))
+	}
+
+	// TODO: Allow returns
+	var term *ir.TermRet
+	if expr.Name == "main" {
+		term = block.NewRet(constant.NewInt(types.I32, 0))
+	} else {
+		term = block.NewRet(nil)
+	}
+
+	if b.debug != nil {
+		// Functions return at their closing brace
+		b.debug.attach(closingLocation(expr.Location), term)
+		if leave != nil {
+			b.debug.attach(closingLocation(expr.Location), leave)
+		}
+	}
+}
+
+// body appends the statements to the block. Statements with blocks of their own, such as ifs, continue in a new block.
+// It returns the new blocks, and the block where control continues once all statements were run.
+func (b *LLVMIRBuilder) body(stmts []Expr, block *ir.Block) ([]*ir.Block, *ir.Block) {
+	var blocks []*ir.Block
+	for _, stmt := range stmts {
 		if isBlockExpr(stmt) {
 			continueBlock := ir.NewBlock("")
 
-			blocks := b.blocks(stmt, continueBlock)
-			block.NewBr(blocks[0])
+			stmtBlocks := b.blocks(stmt, continueBlock)
+			b.locate(stmt, block.NewBr(stmtBlocks[0]))
 
-			f.Blocks = append(f.Blocks, blocks...)
-			f.Blocks = append(f.Blocks, continueBlock)
+			blocks = append(blocks, stmtBlocks...)
+			blocks = append(blocks, continueBlock)
 
 			block = continueBlock
 			continue
 		}
 
-		block.Insts = append(block.Insts, b.instructions(stmt)...)
+		block.Insts = append(block.Insts, b.statement(stmt)...)
 	}
 
-	// TODO: Allow returns
-	block.NewRet(nil)
+	return blocks, block
+}
+
+// statement returns the instructions of a statement, located at the statement when there's debug information
+func (b *LLVMIRBuilder) statement(expr Expr) []ir.Instruction {
+	ins := b.instructions(expr)
+	for _, i := range ins {
+		b.locate(expr, i)
+	}
+
+	return ins
+}
+
+// lastExpr returns the last expression of a block, or the fallback if the block is empty. Jumps out of a block are
+// located at its last expression, so debuggers don't step back to the start of the block.
+func lastExpr(exprs []Expr, fallback Expr) Expr {
+	if len(exprs) == 0 {
+		return fallback
+	}
+
+	return exprs[len(exprs)-1]
+}
+
+// locate sets the location of the expression to the instruction or terminator, if there's debug information
+func (b *LLVMIRBuilder) locate(expr Expr, i interface{}) {
+	if b.debug != nil {
+		b.debug.attach(expr.GetLocation(), i)
+	}
 }
 
 func isBlockExpr(expr Expr) bool {
@@ -126,6 +232,12 @@ func (b *LLVMIRBuilder) instructions(expr Expr) []ir.Instruction {
 	case *FuncCall:
 		_, ins := b.functionCall(e)
 		return ins
+	case *ConversionExpr:
+		_, ins := b.conversion(e)
+		return ins
+	case *InterpolationExpr:
+		_, ins := b.interpolation(e)
+		return ins
 	}
 
 	return []ir.Instruction{}
@@ -135,29 +247,70 @@ func (b *LLVMIRBuilder) ifBranch(expr *IfExpr, exit *ir.Block) []*ir.Block {
 	block := ir.NewBlock("")
 
 	condVal, condIns := b.recursiveLoad(expr.Condition)
+	for _, i := range condIns {
+		b.locate(expr.Condition, i)
+	}
+
 	block.Insts = append(block.Insts, condIns...)
 
-	trueBlock := ir.NewBlock("")
-	for _, cExpr := range expr.Consequent {
-		trueBlock.Insts = append(trueBlock.Insts, b.instructions(cExpr)...)
+	outer := b.values
+	blocks := []*ir.Block{block}
+
+	// branch lowers the statements of a branch, with the variables it declares kept apart from the outer ones
+	branch := func(stmts []Expr) (*ir.Block, *ir.Block, ValueLookup) {
+		b.values = NewValueLookup()
+		b.values.Inherit(outer)
+
+		first := ir.NewBlock("")
+		inner, last := b.body(stmts, first)
+		b.locate(lastExpr(stmts, expr), last.NewBr(exit))
+
+		blocks = append(blocks, first)
+		blocks = append(blocks, inner...)
+
+		return first, last, b.values
 	}
 
-	trueBlock.NewBr(exit)
+	trueBlock, trueEnd, trueValues := branch(expr.Consequent)
 
-	if len(expr.Else) == 0 {
-		block.NewCondBr(condVal, trueBlock, exit)
-		return []*ir.Block{block, trueBlock}
+	falseBlock, falseEnd, falseValues := exit, block, outer
+	if len(expr.Else) != 0 {
+		falseBlock, falseEnd, falseValues = branch(expr.Else)
 	}
 
-	falseBlock := ir.NewBlock("")
-	for _, eExpr := range expr.Else {
-		falseBlock.Insts = append(falseBlock.Insts, b.instructions(eExpr)...)
+	b.locate(expr.Condition, block.NewCondBr(condVal, trueBlock, falseBlock))
+
+	b.values = outer
+	b.merge(expr, exit, trueEnd, trueValues, falseEnd, falseValues)
+
+	return blocks
+}
+
+// merge joins the values of the variables at the end of both branches of an if, with a phi at the start of the exit
+// block for each variable whose value depends on the branch taken. Variables declared in only one branch are left out,
+// as the flow analysis rejects their reads after the if.
+func (b *LLVMIRBuilder) merge(expr *IfExpr, exit *ir.Block, trueEnd *ir.Block, trueValues ValueLookup,
+	falseEnd *ir.Block, falseValues ValueLookup) {
+	names := make([]string, 0, len(trueValues))
+	for name := range trueValues {
+		names = append(names, name)
 	}
 
-	falseBlock.NewBr(exit)
+	// Sorted, so the generated code is always the same
+	sort.Strings(names)
+
+	for _, name := range names {
+		v1, v2 := trueValues[name], falseValues[name]
+		if v2 == nil || v1 == v2 {
+			continue
+		}
 
-	block.NewCondBr(condVal, trueBlock, falseBlock)
-	return []*ir.Block{block, trueBlock, falseBlock}
+		phi := ir.NewPhi(ir.NewIncoming(v1, trueEnd), ir.NewIncoming(v2, falseEnd))
+		b.locate(expr, phi)
+
+		exit.Insts = append(exit.Insts, phi)
+		b.values.Set(name, phi)
+	}
 }
 
 func (b *LLVMIRBuilder) recursiveLoad(expr Expr) (value.Value, []ir.Instruction) {
@@ -174,44 +327,362 @@ func (b *LLVMIRBuilder) recursiveLoad(expr Expr) (value.Value, []ir.Instruction)
 		return b.values.Get(e.Name), []ir.Instruction{}
 	case *FuncCall:
 		return b.functionCall(e)
+	case *ConversionExpr:
+		return b.conversion(e)
+	case *InterpolationExpr:
+		return b.interpolation(e)
 	default:
 		// TODO: Handle gracefully
 		panic("not implemented")
 	}
 }
 
+// loadAs loads an expression that's expected to be of the provided type. Constant expressions are folded and emitted
+// as a single constant of that type, while any other expression is loaded normally.
+func (b *LLVMIRBuilder) loadAs(expr Expr, typ Type) (value.Value, []ir.Instruction) {
+	if v, isConst := evalConstant(expr, b.sizes); isConst && isNumeric(typ) {
+		return b.constant(v, typ), []ir.Instruction{}
+	}
+
+	return b.recursiveLoad(expr)
+}
+
+// constant emits a constant value of the provided numeric type
+func (b *LLVMIRBuilder) constant(v *constValue, typ Type) constant.Constant {
+	t := b.llvmType(typ)
+
+	if isFloat(typ) {
+		f, _ := v.val.Float64()
+		return constant.NewFloat(t.(*types.FloatType), f)
+	}
+
+	c := constant.NewInt(t.(*types.IntType), 0)
+	c.X = v.int()
+
+	return c
+}
+
+// llvmType maps a Maqui type to the LLVM type used to represent it
+func (b *LLVMIRBuilder) llvmType(typ Type) types.Type {
+	basic, isBasic := typ.(*BasicType)
+	if !isBasic {
+		// TODO: Handle gracefully
+		panic("unexpected type: " + typ.String())
+	}
+
+	size := b.sizes.of(basic.Typ)
+	switch basicTypes[basic.Typ].kind {
+	case kindFloat:
+		if size == 32 {
+			return types.Float
+		}
+
+		return types.Double
+	case kindString:
+		return types.I8Ptr
+	default:
+		return types.NewInt(uint64(size))
+	}
+}
+
 func (b *LLVMIRBuilder) binaryExpression(expr *BinaryExpr) (value.Value, []ir.Instruction) {
-	v1, i1 := b.recursiveLoad(expr.Op1)
-	v2, i2 := b.recursiveLoad(expr.Op2)
+	if b.isConst(expr) {
+		return b.loadAs(expr, expr.ResolvedType)
+	}
+
+	if expr.Operation == BinaryShiftLeft || expr.Operation == BinaryShiftRight {
+		return b.shift(expr)
+	}
+
+	v1, i1 := b.loadAs(expr.Op1, expr.ResolvedType)
+	v2, i2 := b.loadAs(expr.Op2, expr.ResolvedType)
 	ins := append(i1, i2...)
 
-	switch expr.Operation {
-	case BinaryAddition:
-		op := ir.NewAdd(v1, v2)
-		return op, append(ins, op)
-	case BinarySubtraction:
-		op := ir.NewSub(v1, v2)
-		return op, append(ins, op)
-	case BinaryMultiplication:
-		op := ir.NewMul(v1, v2)
-		return op, append(ins, op)
+	isDivision := expr.Operation == BinaryDivision || expr.Operation == BinaryModulo
+	if isDivision && !isFloat(expr.ResolvedType) && !b.isConst(expr.Op2) {
+		ins = append(ins, b.check(expr, ir.NewICmp(enum.IPredNE, v2, constant.NewInt(v2.Type().(*types.IntType), 0)),
+			"integer divide by zero")...)
+	}
+
+	if isDivision && isSigned(expr.ResolvedType) {
+		if b.profile.Overflow == OverflowWrap {
+			return b.wrappingDivision(expr, v1, v2, ins)
+		}
+
+		ins = append(ins, b.divisionOverflow(expr, v1, v2)...)
+	}
+
+	var op ir.Instruction
+	switch float := isFloat(expr.ResolvedType); expr.Operation {
+	case BinaryAddition, BinarySubtraction, BinaryMultiplication:
+		if isString(expr.ResolvedType) {
+			op = ir.NewCall(b.values.Get(builtinConcat), v1, v2)
+			break
+		}
+
+		if !float {
+			v, arith := b.arithmetic(expr, expr.Operation, isSigned(expr.ResolvedType), v1, v2, b.profile.Overflow)
+			return v, append(ins, arith...)
+		}
+
+		switch expr.Operation {
+		case BinaryAddition:
+			op = ir.NewFAdd(v1, v2)
+		case BinarySubtraction:
+			op = ir.NewFSub(v1, v2)
+		default:
+			op = ir.NewFMul(v1, v2)
+		}
 	case BinaryDivision:
-		// TODO: Use fdiv and udiv when appropriate
-		op := ir.NewSDiv(v1, v2)
-		return op, append(ins, op)
+		switch {
+		case float:
+			op = ir.NewFDiv(v1, v2)
+		case isSigned(expr.ResolvedType):
+			op = ir.NewSDiv(v1, v2)
+		default:
+			op = ir.NewUDiv(v1, v2)
+		}
+	case BinaryModulo:
+		if isSigned(expr.ResolvedType) {
+			op = ir.NewSRem(v1, v2)
+		} else {
+			op = ir.NewURem(v1, v2)
+		}
+	case BinaryAnd:
+		op = ir.NewAnd(v1, v2)
+	case BinaryOr:
+		op = ir.NewOr(v1, v2)
+	case BinaryXor:
+		op = ir.NewXor(v1, v2)
+	case BinaryAndNot:
+		not := ir.NewXor(v2, constant.NewInt(v2.Type().(*types.IntType), -1))
+		ins = append(ins, not)
+		op = ir.NewAnd(v1, not)
 	default:
 		// TODO: Handle gracefully
 		panic("unexpected binary op: " + expr.Operation)
 	}
+
+	return op.(value.Value), append(ins, op)
+}
+
+// arithmetic emits an integer addition, subtraction or multiplication that overflows following the mode. Wrapping
+// operations are plain instructions, and the rest call the LLVM intrinsics that also tell if the result overflowed.
+func (b *LLVMIRBuilder) arithmetic(expr Expr, operation BinaryOp, signed bool, v1, v2 value.Value,
+	mode Overflow) (value.Value, []ir.Instruction) {
+	name := map[BinaryOp]string{BinaryAddition: "add", BinarySubtraction: "sub", BinaryMultiplication: "mul"}[operation]
+
+	if mode == OverflowWrap {
+		var op ir.Instruction
+		switch operation {
+		case BinaryAddition:
+			op = ir.NewAdd(v1, v2)
+		case BinarySubtraction:
+			op = ir.NewSub(v1, v2)
+		default:
+			op = ir.NewMul(v1, v2)
+		}
+
+		return op.(value.Value), []ir.Instruction{op}
+	}
+
+	sign := "u"
+	if signed {
+		sign = "s"
+	}
+
+	typ := v1.Type()
+	intrinsic := externalFunc(b.mod, fmt.Sprintf("llvm.%s%s.with.overflow.%s", sign, name, typ),
+		types.NewStruct(typ, types.I1), false, ir.NewParam("", typ), ir.NewParam("", typ))
+
+	call := ir.NewCall(intrinsic, v1, v2)
+	result, overflowed := ir.NewExtractValue(call, 0), ir.NewExtractValue(call, 1)
+	ins := []ir.Instruction{call, result, overflowed}
+
+	return result, append(ins, b.overflow(expr, overflowed, mode)...)
+}
+
+// divisionOverflow handles the only signed division that overflows, the smallest integer divided by -1, which the
+// processors don't wrap around but trap on
+func (b *LLVMIRBuilder) divisionOverflow(expr *BinaryExpr, v1, v2 value.Value) []ir.Instruction {
+	if v, isConst := evalConstant(expr.Op2, b.sizes); isConst && v.val.Cmp(big.NewRat(-1, 1)) != 0 {
+		return nil
+	}
+
+	typ := v1.Type().(*types.IntType)
+	min := &constant.Int{Typ: typ, X: new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), uint(typ.BitSize-1)))}
+
+	isMin := ir.NewICmp(enum.IPredEQ, v1, min)
+	isMinusOne := ir.NewICmp(enum.IPredEQ, v2, constant.NewInt(typ, -1))
+	overflowed := ir.NewAnd(isMin, isMinusOne)
+
+	ins := []ir.Instruction{isMin, isMinusOne, overflowed}
+	return append(ins, b.overflow(expr, overflowed, b.profile.Overflow)...)
+}
+
+// wrappingDivision emits a signed division or modulo whose overflow wraps around. Dividing by -1 never runs the
+// division, as the processors trap on the smallest integer divided by -1, and instead negates the dividend for the
+// quotient, which wraps the smallest integer around to itself, or results in 0 for the remainder.
+func (b *LLVMIRBuilder) wrappingDivision(expr *BinaryExpr, v1, v2 value.Value,
+	ins []ir.Instruction) (value.Value, []ir.Instruction) {
+	if v, isConst := evalConstant(expr.Op2, b.sizes); isConst && v.val.Cmp(big.NewRat(-1, 1)) != 0 {
+		var op ir.Instruction = ir.NewSDiv(v1, v2)
+		if expr.Operation == BinaryModulo {
+			op = ir.NewSRem(v1, v2)
+		}
+
+		return op.(value.Value), append(ins, op)
+	}
+
+	typ := v1.Type().(*types.IntType)
+	isMinusOne := ir.NewICmp(enum.IPredEQ, v2, constant.NewInt(typ, -1))
+	divisor := ir.NewSelect(isMinusOne, constant.NewInt(typ, 1), v2)
+	ins = append(ins, isMinusOne, divisor)
+
+	var op, result ir.Instruction
+	if expr.Operation == BinaryModulo {
+		op = ir.NewSRem(v1, divisor)
+		ins = append(ins, op)
+		result = ir.NewSelect(isMinusOne, constant.NewInt(typ, 0), op.(value.Value))
+	} else {
+		op = ir.NewSDiv(v1, divisor)
+		neg := ir.NewSub(constant.NewInt(typ, 0), v1)
+		ins = append(ins, op, neg)
+		result = ir.NewSelect(isMinusOne, neg, op.(value.Value))
+	}
+
+	return result.(value.Value), append(ins, result)
+}
+
+// overflow stops the program following the mode when the condition, which tells an operation overflowed, is true
+func (b *LLVMIRBuilder) overflow(expr Expr, overflowed value.Value, mode Overflow) []ir.Instruction {
+	switch mode {
+	case OverflowTrap:
+		return []ir.Instruction{ir.NewCall(b.values.Get(runtimeTrap), overflowed)}
+	case OverflowCheck:
+		return b.guard(expr, ir.NewXor(overflowed, constant.True), "integer overflow")
+	default:
+		return nil
+	}
+}
+
+// check emits a runtime safety check, that panics with the message at the expression when the condition is false. The
+// condition must be the last instruction of those that compute it. If the profile has no checks, nothing is emitted.
+func (b *LLVMIRBuilder) check(expr Expr, cond ir.Instruction, message string) []ir.Instruction {
+	if !b.profile.Checks {
+		return nil
+	}
+
+	return b.guard(expr, cond, message)
+}
+
+// guard emits a check that panics with the message at the expression when the condition is false, whatever the
+// profile. The condition must be the last instruction of those that compute it.
+func (b *LLVMIRBuilder) guard(expr Expr, cond ir.Instruction, message string) []ir.Instruction {
+	call := ir.NewCall(b.values.Get(builtinCheck), cond.(value.Value), b.message(message), b.site(expr))
+	return []ir.Instruction{cond, call}
+}
+
+// site returns the location of the expression as a string of the runtime, as in "main.mq:7:9"
+func (b *LLVMIRBuilder) site(expr Expr) constant.Constant {
+	loc := expr.GetLocation()
+	if loc == nil {
+		return b.message("<unknown>")
+	}
+
+	return b.message(loc.String())
+}
+
+// message defines a string constant for a message of the runtime
+func (b *LLVMIRBuilder) message(text string) constant.Constant {
+	if c, ok := b.messages[text]; ok {
+		return c
+	}
+
+	name := fmt.Sprintf(".str.%d", b.strings)
+	b.strings++
+
+	c := globalString(b.mod, name, text)
+	b.messages[text] = c
+
+	return c
+}
+
+// shift emits a shift of the first operand by the second one. The count is resized to the type of the shifted value.
+// Counts equal or bigger than the size of the type shift out all bits, which LLVM leaves undefined, so the result is
+// selected explicitly: 0 for left and logical right shifts, and the sign for arithmetic right shifts.
+func (b *LLVMIRBuilder) shift(expr *BinaryExpr) (value.Value, []ir.Instruction) {
+	v, ins := b.loadAs(expr.Op1, expr.ResolvedType)
+
+	if b.isConst(expr.Op2) {
+		count, _ := b.loadAs(expr.Op2, expr.ResolvedType)
+		return b.shiftBy(expr, v, count, ins)
+	}
+
+	count, countIns := b.recursiveLoad(expr.Op2)
+	ins = append(ins, countIns...)
+
+	typ := v.Type().(*types.IntType)
+	countTyp := count.Type().(*types.IntType)
+
+	// The comparison is done before resizing the count, so truncated counts are not mistaken as being in range
+	width := new(big.Int).SetUint64(typ.BitSize)
+	tooBig := ir.NewICmp(enum.IPredUGE, count, &constant.Int{Typ: countTyp, X: width})
+	ins = append(ins, tooBig)
+
+	var resized value.Value = count
+	switch {
+	case countTyp.BitSize < typ.BitSize:
+		zext := ir.NewZExt(count, typ)
+		ins = append(ins, zext)
+		resized = zext
+	case countTyp.BitSize > typ.BitSize:
+		trunc := ir.NewTrunc(count, typ)
+		ins = append(ins, trunc)
+		resized = trunc
+	}
+
+	if expr.Operation == BinaryShiftRight && isSigned(expr.ResolvedType) {
+		// Shifting by the size minus one leaves only the sign
+		clamped := ir.NewSelect(tooBig, constant.NewInt(typ, int64(typ.BitSize-1)), resized)
+		ins = append(ins, clamped)
+
+		return b.shiftBy(expr, v, clamped, ins)
+	}
+
+	shifted, ins := b.shiftBy(expr, v, resized, ins)
+	op := ir.NewSelect(tooBig, constant.NewInt(typ, 0), shifted)
+
+	return op, append(ins, op)
+}
+
+// shiftBy emits the shift instruction of the expression's operation, with an already resized count
+func (b *LLVMIRBuilder) shiftBy(expr *BinaryExpr, v value.Value, count value.Value, ins []ir.Instruction) (value.Value, []ir.Instruction) {
+	var op ir.Instruction
+	switch {
+	case expr.Operation == BinaryShiftLeft:
+		op = ir.NewShl(v, count)
+	case isSigned(expr.ResolvedType):
+		op = ir.NewAShr(v, count)
+	default:
+		op = ir.NewLShr(v, count)
+	}
+
+	return op.(value.Value), append(ins, op)
 }
 
 func (b *LLVMIRBuilder) booleanExpression(expr *BooleanExpr) (value.Value, []ir.Instruction) {
-	v1, i1 := b.recursiveLoad(expr.Op1)
-	v2, i2 := b.recursiveLoad(expr.Op2)
+	v1, i1 := b.loadAs(expr.Op1, expr.ResolvedType)
+	v2, i2 := b.loadAs(expr.Op2, expr.ResolvedType)
 	ins := append(i1, i2...)
 
 	switch expr.Operation {
 	case BooleanEquals:
+		if isFloat(expr.ResolvedType) {
+			op := ir.NewFCmp(enum.FPredOEQ, v1, v2)
+			return op, append(ins, op)
+		}
+
 		// TODO Add more data types
 		op := ir.NewICmp(enum.IPredEQ, v1, v2)
 		return op, append(ins, op)
@@ -222,12 +693,31 @@ func (b *LLVMIRBuilder) booleanExpression(expr *BooleanExpr) (value.Value, []ir.
 }
 
 func (b *LLVMIRBuilder) unaryExpression(expr *UnaryExpr) (value.Value, []ir.Instruction) {
+	if b.isConst(expr) {
+		return b.loadAs(expr, expr.ResolvedType)
+	}
+
 	v, ins := b.recursiveLoad(expr.Operand)
 
 	switch expr.Operation {
 	case UnaryNegative:
-		minusOne := constant.NewInt(types.I32, -1)
-		op := ir.NewMul(v, minusOne)
+		if isFloat(expr.ResolvedType) {
+			op := ir.NewFNeg(v)
+			return op, append(ins, op)
+		}
+
+		// Negating unsigned integers always wraps around, as only zero has a negation in their range
+		mode := b.profile.Overflow
+		if !isSigned(expr.ResolvedType) {
+			mode = OverflowWrap
+		}
+
+		zero := constant.NewInt(v.Type().(*types.IntType), 0)
+		op, neg := b.arithmetic(expr, BinarySubtraction, true, zero, v, mode)
+		return op, append(ins, neg...)
+	case UnaryBitwiseNot:
+		allOnes := constant.NewInt(v.Type().(*types.IntType), -1)
+		op := ir.NewXor(v, allOnes)
 		return op, append(ins, op)
 	default:
 		// TODO: Handle gracefully
@@ -235,66 +725,253 @@ func (b *LLVMIRBuilder) unaryExpression(expr *UnaryExpr) (value.Value, []ir.Inst
 	}
 }
 
+// conversion converts a value between two types, picking the instruction based on the size and signedness of both.
+// Integers converted to strings are encoded as the UTF-8 representation of the rune they hold.
+func (b *LLVMIRBuilder) conversion(expr *ConversionExpr) (value.Value, []ir.Instruction) {
+	to := &BasicType{expr.Type}
+	if b.isConst(expr) {
+		return b.loadAs(expr, to)
+	}
+
+	from := expr.ResolvedType
+	v, ins := b.loadAs(expr.Value, from)
+
+	if from.Equals(to) {
+		return v, ins
+	}
+
+	fromSize := b.sizes.of(from.(*BasicType).Typ)
+	toSize := b.sizes.of(expr.Type)
+	toType := b.llvmType(to)
+
+	var op ir.Instruction
+	switch {
+	case isInteger(from) && isInteger(to):
+		switch {
+		case fromSize > toSize:
+			op = ir.NewTrunc(v, toType)
+		case fromSize == toSize:
+			return v, ins // Only the signedness changes, which LLVM types don't track
+		case isSigned(from):
+			op = ir.NewSExt(v, toType)
+		default:
+			op = ir.NewZExt(v, toType)
+		}
+	case isInteger(from) && isFloat(to):
+		if isSigned(from) {
+			op = ir.NewSIToFP(v, toType)
+		} else {
+			op = ir.NewUIToFP(v, toType)
+		}
+	case isFloat(from) && isInteger(to):
+		ins = append(ins, b.rangeCheck(expr, v, to)...)
+		if isSigned(to) {
+			op = ir.NewFPToSI(v, toType)
+		} else {
+			op = ir.NewFPToUI(v, toType)
+		}
+	case isFloat(from) && isFloat(to):
+		if fromSize > toSize {
+			op = ir.NewFPTrunc(v, toType)
+		} else {
+			op = ir.NewFPExt(v, toType)
+		}
+	case isInteger(from):
+		return b.runeToString(v, from, ins)
+	default:
+		// TODO: Handle gracefully
+		panic("unexpected conversion: " + from.String() + " to " + expr.Type)
+	}
+
+	return op.(value.Value), append(ins, op)
+}
+
+// rangeCheck checks the float value fits in the integer type, as LLVM leaves undefined the conversions of values out of
+// its range. The fraction is truncated, so the values are compared with the bounds of the integer part.
+func (b *LLVMIRBuilder) rangeCheck(expr *ConversionExpr, v value.Value, to Type) []ir.Instruction {
+	if !b.profile.Checks {
+		return nil
+	}
+
+	// The bounds are powers of 2, which floats represent exactly. Values must be greater or equal than -2^(n-1) and
+	// less than 2^(n-1) for signed integers, and greater than -1 and less than 2^n for unsigned ones.
+	size := b.sizes.of(to.(*BasicType).Typ)
+	low, lowPred := -1.0, enum.FPredOGT
+	high := math.Ldexp(1, size)
+	if isSigned(to) {
+		low, lowPred = -math.Ldexp(1, size-1), enum.FPredOGE
+		high = math.Ldexp(1, size-1)
+	}
+
+	typ := v.Type().(*types.FloatType)
+
+	// The comparisons are ordered, so NaN is out of range too
+	above := ir.NewFCmp(lowPred, v, constant.NewFloat(typ, low))
+	below := ir.NewFCmp(enum.FPredOLT, v, constant.NewFloat(typ, high))
+	inRange := ir.NewAnd(above, below)
+
+	check := b.check(expr, inRange, "value out of range in conversion to "+to.String())
+	return append([]ir.Instruction{above, below}, check...)
+}
+
+// runeToString calls the built-in encoder that turns a rune into a string. Runes are first converted to a 32-bit
+// integer, mapping any value that doesn't fit to the replacement character (U+FFFD).
+func (b *LLVMIRBuilder) runeToString(v value.Value, from Type, ins []ir.Instruction) (value.Value, []ir.Instruction) {
+	switch size := b.sizes.of(from.(*BasicType).Typ); {
+	case size > 32:
+		invalid := ir.NewICmp(enum.IPredUGT, v, constant.NewInt(types.I64, utf8.MaxRune))
+		trunc := ir.NewTrunc(v, types.I32)
+		sel := ir.NewSelect(invalid, constant.NewInt(types.I32, utf8.RuneError), trunc)
+
+		v = sel
+		ins = append(ins, invalid, trunc, sel)
+	case size < 32 && isSigned(from):
+		ext := ir.NewSExt(v, types.I32)
+
+		v = ext
+		ins = append(ins, ext)
+	case size < 32:
+		ext := ir.NewZExt(v, types.I32)
+
+		v = ext
+		ins = append(ins, ext)
+	}
+
+	call := ir.NewCall(b.values.Get(builtinRuneToString), v)
+	return call, append(ins, call)
+}
+
+// isConst returns true if the expression can be evaluated at compile time
+func (b *LLVMIRBuilder) isConst(expr Expr) bool {
+	_, ok := evalConstant(expr, b.sizes)
+	return ok
+}
+
 func (b *LLVMIRBuilder) variableDecl(expr *VariableDecl) (value.Value, []ir.Instruction) {
-	v, ins := b.recursiveLoad(expr.Value)
+	v, ins := b.loadAs(expr.Value, expr.ResolvedType)
 	b.values.Set(expr.Name, v)
 
+	if b.debug != nil {
+		ins = append(ins, b.debug.variable(expr, v))
+	}
+
 	return v, ins
 }
 
 func (b *LLVMIRBuilder) loadLiteral(expr *LiteralExpr) (value.Value, []ir.Instruction) {
 	switch expr.Typ {
 	case LiteralString:
-		// TODO: Implement
-		panic("not implemented")
+		name := fmt.Sprintf(".str.%d", b.strings)
+		b.strings++
+
+		return globalString(b.mod, name, expr.Value), []ir.Instruction{}
 	case LiteralNumber:
-		return b.loadLiteralInt(expr)
+		return b.loadLiteralNumber(expr)
+	case LiteralRune:
+		r, _ := utf8.DecodeRuneInString(expr.Value)
+		return constant.NewInt(types.I32, int64(r)), []ir.Instruction{}
 	default:
 		// TODO: Handle gracefully
 		panic("unknown type")
 	}
 }
 
-func (b *LLVMIRBuilder) loadLiteralInt(expr *LiteralExpr) (value.Value, []ir.Instruction) {
-	v, err := strconv.ParseInt(expr.Value, 10, 32)
-	if err != nil {
+// loadLiteralNumber loads a numeric literal as a constant of its default type (int or float64)
+func (b *LLVMIRBuilder) loadLiteralNumber(expr *LiteralExpr) (value.Value, []ir.Instruction) {
+	v, isConst := evalConstant(expr, b.sizes)
+	if !isConst {
 		// TODO: Handle gracefully
-		panic(err)
+		panic("invalid number: " + expr.Value)
 	}
 
-	c := constant.NewInt(types.I32, v)
-	return c, []ir.Instruction{}
+	return b.constant(v, v.defaultType()), []ir.Instruction{}
 }
 
 func (b *LLVMIRBuilder) functionCall(expr *FuncCall) (value.Value, []ir.Instruction) {
+	if expr.Name == "assert" && !b.profile.Assertions {
+		// Stripped assertions don't evaluate their arguments
+		return nil, nil
+	}
+
+	if expr.Name == "print" || expr.Name == "println" || expr.Name == "printf" {
+		return nil, b.print(expr)
+	}
+
 	var ins []ir.Instruction
 	var callVals []value.Value
-	for _, arg := range expr.Args {
-		argVal, argIns := b.recursiveLoad(arg)
+	for i, arg := range expr.Args {
+		argVal, argIns := b.loadAs(arg, expr.ResolvedTypes[i])
 
 		ins = append(ins, argIns...)
 		callVals = append(callVals, argVal)
 	}
 
-	call := ir.NewCall(b.values.Get(expr.Name), callVals...)
+	if a, ok := arithmeticBuiltins[expr.Name]; ok {
+		v, arith := b.arithmetic(expr, a.operation, isSigned(expr.ResolvedTypes[0]), callVals[0], callVals[1], a.mode)
+		return v, append(ins, arith...)
+	}
+
+	var call *ir.InstCall
+	switch {
+	case expr.Name == "assert":
+		call = ir.NewCall(b.values.Get(builtinCheck), callVals[0], b.message("assertion failed"), b.site(expr))
+	case expr.Name == "panic":
+		call = ir.NewCall(b.values.Get(runtimePanic), callVals[0], b.site(expr))
+	case b.profile.Checks && !b.builtins[expr.Name]:
+		// The caller's frame of the stack traces points to the call
+		ins = append(ins, ir.NewCall(b.values.Get(runtimeCall), b.site(expr)))
+		fallthrough
+	default:
+		call = ir.NewCall(b.values.Get(expr.Name), callVals...)
+	}
+
 	ins = append(ins, call)
 
-	// TODO: Implement function call returns
-	return nil, ins
+	return call, ins
 }
 
 type LLVMGenerator struct {
-	ast *AST
+	ast     *AST
+	profile Profile
+	// debug is true if the debug information is generated
+	debug bool
 }
 
+// NewLLVMGenerator creates a generator for the AST. The code is generated for the ProfileDebug unless SetProfile is
+// called.
 func NewLLVMGenerator(ast *AST) *LLVMGenerator {
 	return &LLVMGenerator{
-		ast: ast,
+		ast:     ast,
+		profile: ProfileDebug,
 	}
 }
 
+// SetProfile sets the build profile, which decides the runtime checks and assertions added to the code
+func (g *LLVMGenerator) SetProfile(profile Profile) {
+	g.profile = profile
+}
+
+// SetDebugInfo sets whether the DWARF debug information is generated, so debuggers can map the code to the source file
+func (g *LLVMGenerator) SetDebugInfo(enabled bool) {
+	g.debug = enabled
+}
+
 func (g LLVMGenerator) Do() IR {
-	builder := NewLLVMIRBuilder()
+	builder := NewLLVMIRBuilder(g.ast.Target)
+	builder.profile = g.profile
+	if g.debug {
+		builder.debug = newDebugInfo(builder.mod, g.ast.Filename, g.profile, builder.sizes)
+	}
+
+	// The profile is recorded in the identification of the module, which ends in the .comment section of object files
+	ident := &metadata.Tuple{
+		MetadataID: -1,
+		Fields:     []metadata.Field{&metadata.String{Value: "maqui " + g.profile.String()}},
+	}
+
+	builder.mod.MetadataDefs = append(builder.mod.MetadataDefs, ident)
+	builder.mod.NamedMetadataDefs["llvm.ident"] = &metadata.NamedDef{Name: "llvm.ident", Nodes: []metadata.Node{ident}}
+
 	for _, stmt := range g.ast.Statements {
 		g.visit(builder, stmt)
 	}
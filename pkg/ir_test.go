@@ -1,10 +1,13 @@
 package maqui
 
 import (
+	"strings"
+	"testing"
+
+	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
 	"github.com/llir/llvm/ir/types"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestValueLookup(t *testing.T) {
@@ -43,3 +46,274 @@ func TestValueLookupInherit(t *testing.T) {
 	assert.Equal(t, val2, vals1.Get("id2"))
 	assert.Equal(t, val4, vals1.Get("id4"))
 }
+
+func TestConversionInstruction(t *testing.T) {
+	cases := []struct {
+		from   string
+		to     string
+		expect string
+	}{
+		{"int64", "int8", "trunc"},
+		{"int8", "int64", "sext"},
+		{"uint8", "int64", "zext"},
+		{"int", "float64", "sitofp"},
+		{"uint32", "float32", "uitofp"},
+		{"float64", "int32", "fptosi"},
+		{"float64", "uint16", "fptoui"},
+		{"float32", "float64", "fpext"},
+		{"float64", "float32", "fptrunc"},
+		{"uint8", "string", "call"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.from+"To"+c.to, func(t *testing.T) {
+			b := NewLLVMIRBuilder(DefaultTarget)
+			b.values.Set("x", ir.NewParam("x", b.llvmType(&BasicType{c.from})))
+
+			_, ins := b.conversion(&ConversionExpr{
+				Type:         c.to,
+				Value:        &Identifier{Name: "x"},
+				ResolvedType: &BasicType{c.from},
+			})
+
+			last := ins[len(ins)-1].LLString()
+			assert.True(t, strings.Contains(last, " = "+c.expect+" "), last)
+		})
+	}
+}
+
+func TestIntegerInstruction(t *testing.T) {
+	cases := []struct {
+		typ    string
+		op     BinaryOp
+		expect string
+	}{
+		{"int", BinaryModulo, "srem"},
+		{"uint8", BinaryModulo, "urem"},
+		{"int64", BinaryAnd, "and"},
+		{"int", BinaryOr, "or"},
+		{"uint16", BinaryXor, "xor"},
+		{"int", BinaryAndNot, "and"},
+		{"int32", BinaryShiftLeft, "select"},
+		{"int", BinaryShiftRight, "ashr"},
+		{"uint64", BinaryShiftRight, "select"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.typ+string(c.op), func(t *testing.T) {
+			b := NewLLVMIRBuilder(DefaultTarget)
+			b.values.Set("x", ir.NewParam("x", b.llvmType(&BasicType{c.typ})))
+			b.values.Set("y", ir.NewParam("y", b.llvmType(&BasicType{c.typ})))
+
+			_, ins := b.binaryExpression(&BinaryExpr{
+				Operation:    c.op,
+				Op1:          &Identifier{Name: "x"},
+				Op2:          &Identifier{Name: "y"},
+				ResolvedType: &BasicType{c.typ},
+			})
+
+			last := ins[len(ins)-1].LLString()
+			assert.True(t, strings.Contains(last, " = "+c.expect+" "), last)
+		})
+	}
+}
+
+func TestFunctionReturn(t *testing.T) {
+	cases := []struct {
+		name   string
+		expect string
+	}{
+		{"main", "ret i32 0"},
+		{"foo", "ret void"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewLLVMIRBuilder(DefaultTarget)
+			b.function(&FuncDecl{Name: c.name})
+
+			f := b.values.Get(c.name).(*ir.Func)
+			term := f.Blocks[len(f.Blocks)-1].Term.LLString()
+			assert.Equal(t, c.expect, term)
+		})
+	}
+}
+
+func TestModuleTarget(t *testing.T) {
+	cases := []struct {
+		target Target
+		expect string
+	}{
+		{DefaultTarget, "i64"},
+		{Target{}, "i64"},
+		{Target{Arch: I386, Vendor: PC, OS: Windows, Env: "msvc"}, "i32"},
+		{Target{Arch: Wasm32, Vendor: Unknown, OS: WASI}, "i32"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target.String(), func(t *testing.T) {
+			b := NewLLVMIRBuilder(c.target)
+
+			target := c.target
+			if target == (Target{}) {
+				target = DefaultTarget
+			}
+
+			assert.Equal(t, target.String(), b.mod.TargetTriple)
+			assert.Equal(t, target.DataLayout(), b.mod.DataLayout)
+			assert.Equal(t, c.expect, b.llvmType(&BasicType{"int"}).LLString())
+			assert.Equal(t, "i32", b.llvmType(&BasicType{"int32"}).LLString())
+		})
+	}
+}
+
+func TestProfileChecks(t *testing.T) {
+	cases := []struct {
+		name    string
+		profile Profile
+		expr    Expr
+		expect  int
+	}{
+		{
+			"DivisionChecked",
+			ProfileDebug,
+			&BinaryExpr{Operation: BinaryDivision, Op1: &Identifier{Name: "x"}, Op2: &Identifier{Name: "y"}},
+			2, // By zero, and the overflow of the smallest integer divided by -1
+		},
+		{
+			"ModuloChecked",
+			ProfileDebug,
+			&BinaryExpr{Operation: BinaryModulo, Op1: &Identifier{Name: "x"}, Op2: &Identifier{Name: "y"}},
+			2, // By zero, and the overflow of the smallest integer divided by -1
+		},
+		{
+			"ConstantDivisor",
+			ProfileDebug,
+			&BinaryExpr{
+				Operation: BinaryDivision,
+				Op1:       &Identifier{Name: "x"},
+				Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+			},
+			0,
+		},
+		{
+			"DivisionUnchecked",
+			ProfileRelease,
+			&BinaryExpr{Operation: BinaryDivision, Op1: &Identifier{Name: "x"}, Op2: &Identifier{Name: "y"}},
+			0,
+		},
+		{
+			"Assertion",
+			ProfileDebug,
+			&FuncCall{Name: "assert", Args: []Expr{&Identifier{Name: "c"}}, ResolvedTypes: []Type{&BasicType{"bool"}}},
+			1,
+		},
+		{
+			"AssertionStripped",
+			ProfileRelease,
+			&FuncCall{Name: "assert", Args: []Expr{&Identifier{Name: "c"}}, ResolvedTypes: []Type{&BasicType{"bool"}}},
+			0,
+		},
+		{
+			"ConversionChecked",
+			ProfileDebug,
+			&ConversionExpr{Type: "int32", Value: &Identifier{Name: "f"}, ResolvedType: &BasicType{"float64"}},
+			1,
+		},
+		{
+			"ConversionUnchecked",
+			ProfileRelease,
+			&ConversionExpr{Type: "uint8", Value: &Identifier{Name: "f"}, ResolvedType: &BasicType{"float64"}},
+			0,
+		},
+		{
+			"Panic",
+			ProfileRelease,
+			&FuncCall{Name: "panic", Args: []Expr{&Identifier{Name: "s"}}, ResolvedTypes: []Type{&BasicType{"string"}}},
+			1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewLLVMIRBuilder(DefaultTarget)
+			b.profile = c.profile
+			b.values.Set("x", ir.NewParam("x", types.I64))
+			b.values.Set("y", ir.NewParam("y", types.I64))
+			b.values.Set("c", ir.NewParam("c", types.I1))
+			b.values.Set("f", ir.NewParam("f", types.Double))
+			b.values.Set("s", ir.NewParam("s", types.I8Ptr))
+
+			if e, ok := c.expr.(*BinaryExpr); ok {
+				e.ResolvedType = &BasicType{"int"}
+			}
+
+			calls := 0
+			for _, i := range b.instructions(c.expr) {
+				if call, ok := i.(*ir.InstCall); ok {
+					calls++
+					assert.Contains(t, []string{builtinCheck, runtimePanic}, call.Callee.(*ir.Func).Name())
+				}
+			}
+
+			assert.Equal(t, c.expect, calls)
+		})
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	add := func() Expr {
+		return &BinaryExpr{
+			Operation:    BinaryAddition,
+			Op1:          &Identifier{Name: "x"},
+			Op2:          &Identifier{Name: "y"},
+			ResolvedType: &BasicType{"int32"},
+		}
+	}
+
+	negation := func(typ string) Expr {
+		neg := &UnaryExpr{Operation: UnaryNegative, Operand: &Identifier{Name: "x"}, ResolvedType: &BasicType{typ}}
+		return &VariableDecl{Name: "z", Value: neg, ResolvedType: &BasicType{typ}}
+	}
+
+	builtin := func(name string) Expr {
+		return &FuncCall{
+			Name:          name,
+			Args:          []Expr{&Identifier{Name: "x"}, &Identifier{Name: "y"}},
+			ResolvedTypes: []Type{&BasicType{"uint32"}, &BasicType{"uint32"}},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		overflow Overflow
+		expr     Expr
+		expect   []string
+	}{
+		{"AddWrap", OverflowWrap, add(), nil},
+		{"AddTrap", OverflowTrap, add(), []string{"llvm.sadd.with.overflow.i32", runtimeTrap}},
+		{"AddCheck", OverflowCheck, add(), []string{"llvm.sadd.with.overflow.i32", builtinCheck}},
+		{"NegationCheck", OverflowCheck, negation("int32"), []string{"llvm.ssub.with.overflow.i32", builtinCheck}},
+		{"UnsignedNegationWraps", OverflowCheck, negation("uint32"), nil},
+		{"WrappingAdd", OverflowCheck, builtin("wrappingAdd"), nil},
+		{"CheckedMul", OverflowWrap, builtin("checkedMul"), []string{"llvm.umul.with.overflow.i32", builtinCheck}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewLLVMIRBuilder(DefaultTarget)
+			b.profile.Overflow = c.overflow
+			b.values.Set("x", ir.NewParam("x", types.I32))
+			b.values.Set("y", ir.NewParam("y", types.I32))
+
+			var calls []string
+			for _, i := range b.instructions(c.expr) {
+				if call, ok := i.(*ir.InstCall); ok {
+					calls = append(calls, call.Callee.(*ir.Func).Name())
+				}
+			}
+
+			assert.Equal(t, c.expect, calls)
+		})
+	}
+}
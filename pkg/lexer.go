@@ -2,11 +2,11 @@ package maqui
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -32,9 +32,23 @@ const (
 	// TokenNumber denotes a numeric value, held inside the value of the [Token]. The token does not commit to any
 	// specific type of number, and can hold any of decimal, integer or complex numbers.
 	TokenNumber
-	// TokenString denotes a [Token] which holds a string value. The surrounding double-quotes (") are removed, and only
-	// the inner value of the string should be found inside the [Token].
+	// TokenString denotes a [Token] which holds a string value. The surrounding double-quotes (") or backticks (`) are
+	// removed, and only the inner value of the string should be found inside the [Token]. Escape sequences are already
+	// decoded in the value.
 	TokenString
+	// TokenRune denotes a single-quoted (') character. The value of the [Token] holds the character UTF-8 encoded, with
+	// escape sequences already decoded.
+	TokenRune
+	// TokenStringHead starts a string with embedded expressions, as in "x = {x}". It holds the text before the first
+	// expression, and it's followed by the tokens of the expression.
+	TokenStringHead
+	// TokenStringMiddle holds the text of a string between two embedded expressions.
+	TokenStringMiddle
+	// TokenStringTail ends a string with embedded expressions. It holds the text after the last expression.
+	TokenStringTail
+	// TokenFormatSpec holds the format specifier of an embedded expression, found after a colon, as in {x:08x}. The
+	// value holds the specifier without the colon.
+	TokenFormatSpec
 
 	// TokenIdentifier holds any identifier, that is, any non double-quoted (") text. An identifier might be a function,
 	// variable, type and so on. No assumptions are made over the identifier, and it might be invalid or undeclared. Any
@@ -52,12 +66,33 @@ const (
 	TokenMulti
 	// TokenDiv denotes the forward-slash or division (/) symbol.
 	TokenDiv
+	// TokenModulo denotes the percent or remainder (%) symbol.
+	TokenModulo
+
+	// TokenBitAnd denotes the ampersand or bitwise and (&) symbol.
+	TokenBitAnd
+	// TokenBitOr denotes the vertical bar or bitwise or (|) symbol.
+	TokenBitOr
+	// TokenBitXor denotes the caret (^) symbol. It's used both as the binary bitwise xor and the unary bitwise not.
+	TokenBitXor
+	// TokenBitClear denotes the bit clear or and not (&^) symbol.
+	TokenBitClear
+	// TokenShiftLeft denotes the left shift (<<) symbol.
+	TokenShiftLeft
+	// TokenShiftRight denotes the right shift (>>) symbol.
+	TokenShiftRight
 
 	// TokenDeclaration denotes the declaration (:=) symbol.
 	TokenDeclaration
 	// TokenLineComment matches the line comment symbol (//) and held the value of the following comment until a
 	// new-line is found.
 	TokenLineComment
+	// TokenBlockComment matches a block comment (/* */) and holds the text inside it. Block comments might be nested.
+	TokenBlockComment
+	// TokenDocComment holds a comment that documents the code right below it. Comments starting with "///" are always
+	// doc comments. Line and block comments are doc comments if they are placed on their own line and the next line
+	// is not blank. The value holds the text of the comment without the comment symbols.
+	TokenDocComment
 	// TokenOpenParentheses matches the opening parenthesis symbol.
 	TokenOpenParentheses
 	// TokenCloseParentheses matches the closing parenthesis symbol.
@@ -69,6 +104,9 @@ const (
 
 	// TokenComma denotes the comma symbol (',').
 	TokenComma
+	// TokenSemicolon terminates a statement. It's either an explicit semicolon (';'), or inserted by the lexer at the
+	// end of a line that might end a statement (see [statementEnds]). Inserted semicolons hold a new-line as value.
+	TokenSemicolon
 
 	// TokenIf denotes the 'if' keyword.
 	TokenIf
@@ -94,16 +132,37 @@ var operatorTable = map[string]TokenType{
 	"-":  TokenMinus,
 	"*":  TokenMulti,
 	"/":  TokenDiv,
+	"%":  TokenModulo,
+	"&":  TokenBitAnd,
+	"|":  TokenBitOr,
+	"^":  TokenBitXor,
+	"&^": TokenBitClear,
+	"<<": TokenShiftLeft,
+	">>": TokenShiftRight,
 	":=": TokenDeclaration,
 	"//": TokenLineComment,
+	"/*": TokenBlockComment,
 	"(":  TokenOpenParentheses,
 	")":  TokenCloseParentheses,
 	"{":  TokenOpenCurly,
 	"}":  TokenCloseCurly,
 	",":  TokenComma,
+	";":  TokenSemicolon,
 	"==": TokenBooleanEquals,
 }
 
+// statementEnds holds the tokens that might end a statement. If a line ends right after one of them, the lexer inserts
+// a [TokenSemicolon] to terminate the statement.
+var statementEnds = map[TokenType]bool{
+	TokenIdentifier:       true,
+	TokenNumber:           true,
+	TokenString:           true,
+	TokenStringTail:       true,
+	TokenRune:             true,
+	TokenCloseParentheses: true,
+	TokenCloseCurly:       true,
+}
+
 // Token contains a lexicographical token parsed from the input stream. A Token contains its type, an optional semantic
 // value and information regarding the location on which the token was found.
 //
@@ -121,11 +180,29 @@ type Token struct {
 	Loc *Location
 }
 
-// Location records a position inside a file.
+// Location records a span of source code inside a file, from Start (inclusive) to End (exclusive). Offsets are
+// measured in bytes from the beginning of the file. Lines and columns start at 1, and columns count runes.
 type Location struct {
+	// Start and End are the byte offsets where the span starts and ends
 	Start uint64
 	End   uint64
-	File  string
+	// Line and Col point to the first rune of the span
+	Line uint64
+	Col  uint64
+	// EndLine and EndCol point right after the last rune of the span
+	EndLine uint64
+	EndCol  uint64
+	// File is the path of the file, as provided to the lexer
+	File string
+}
+
+// position is a point in the stream read by the lexer
+type position struct {
+	// offset is the amount of bytes read before the position
+	offset uint64
+	// line and col are the line and column of the position, starting at 1
+	line uint64
+	col  uint64
 }
 
 // Tokenizer defines a lexer that transforms a given stream of text into a sequential series of Tokens.
@@ -154,10 +231,18 @@ type Lexer struct {
 
 	// start represents the start position of the lexer once a state begun. It's used to provide error locations for
 	// error management, and not as a marker for the stream. Once a token is emitted start is set to equal pos.
-	start uint64
+	start position
 
-	// pos is the current position of the lexer. It gets incremented every time a new rune is fetched from the stream
-	pos uint64
+	// pos is the current position of the lexer. It gets advanced every time a new rune is fetched from the stream
+	pos position
+
+	// lineStart is true while only whitespace has been found since the last new-line. It's used to tell comments on
+	// their own line apart from comments trailing code.
+	lineStart bool
+
+	// terminates is true if the last emitted token might end a statement. A new-line found while it's set is emitted as
+	// a [TokenSemicolon].
+	terminates bool
 }
 
 // NewLexer creates a lexer and sets the stream to the file at the provided path.
@@ -176,8 +261,11 @@ func NewLexer(filename string) (*Lexer, error) {
 // NewLexerFromReader creates a lexer and sets the stream to the provided reader.
 func NewLexerFromReader(reader io.Reader) *Lexer {
 	return &Lexer{
-		reader: bufio.NewReader(reader),
-		output: make(chan Token, 2),
+		reader:    bufio.NewReader(reader),
+		output:    make(chan Token, 2),
+		start:     position{line: 1, col: 1},
+		pos:       position{line: 1, col: 1},
+		lineStart: true,
 	}
 }
 
@@ -207,22 +295,31 @@ func (l *Lexer) Do() {
 	close(l.output)
 }
 
-// Run lexes the stream sequentially and blocks until the full output is ready or an error is encountered. [Do] and
-// [Get] should always be preferred for parallelizable workloads. Internally [Run] wraps these methods in a blocking
-// manner.
+// Run lexes the stream sequentially and blocks until the full output is ready. [Do] and [Get] should always be
+// preferred for parallelizable workloads. Internally [Run] wraps these methods in a blocking manner. The lexer recovers
+// from errors, so the whole stream is always consumed, but if any error is found only the first one is returned.
 func (l *Lexer) Run() ([]Token, error) {
 	go l.Do()
 
 	var tokens []Token
+	var err error
 	for {
 		select {
 		case t := <-l.Chan():
 			if t.Typ == TokenEOF {
+				if err != nil {
+					return nil, err
+				}
+
 				return tokens, nil
 			}
 
 			if t.Typ == TokenError {
-				return nil, errors.New(t.Value)
+				if err == nil {
+					err = errors.New(t.Value)
+				}
+
+				continue
 			}
 
 			tokens = append(tokens, t)
@@ -235,46 +332,314 @@ func (l *Lexer) Run() ([]Token, error) {
 func startState(l *Lexer) lexerState {
 	for {
 		switch r := l.peek(); {
+		case r == '\n' && l.terminates:
+			l.emmitNext(TokenSemicolon) // Automatic semicolon insertion
+			l.lineStart = true
+			continue
 		case unicode.IsSpace(r):
-			l.next()
+			if l.next() == '\n' {
+				l.lineStart = true
+			}
+
+			l.start = l.pos // Tokens start after the whitespace
 			continue
 		case r == EOF:
 			return endState
-		case '0' <= r && r <= '9':
-			return numberState
-		case r == '"':
-			return stringState
-		case unicode.IsLetter(r):
-			return identifierState
 		default:
-			return operatorState
+			return tokenState(r)
 		}
 	}
 }
 
+// tokenState returns the state that lexes a token starting with the rune, which must not be whitespace
+func tokenState(r rune) lexerState {
+	switch {
+	case '0' <= r && r <= '9':
+		return numberState
+	case r == '"':
+		return stringState
+	case r == '`':
+		return rawStringState
+	case r == '\'':
+		return runeState
+	case unicode.IsLetter(r) || r == '_':
+		return identifierState
+	default:
+		return operatorState
+	}
+}
+
+// numberBases maps the letter following a leading 0 to the base of the number: hexadecimal (0x), octal (0o) and
+// binary (0b). Prefixes are case-insensitive.
+var numberBases = map[rune]int{
+	'x': 16,
+	'o': 8,
+	'b': 2,
+}
+
+// baseNames holds the name of each base, used to report malformed numbers
+var baseNames = map[int]string{
+	16: "hexadecimal",
+	10: "decimal",
+	8:  "octal",
+	2:  "binary",
+}
+
 // numberState is entered once a digit is found in the stream. The state concatenates the numeric value found
-// until the next token is no longer numeric. A [Token] is then emitted as a [TokenNumber] with its value set to the
-// parsed number.
+// until the next token is no longer numeric. Decimal numbers might have a fractional part (1.5) and an exponent (1e3),
+// while integers might be written in hexadecimal (0x1F), octal (0o17) or binary (0b1010). Digits might be separated by
+// underscores (1_000_000). A [Token] is then emitted as a [TokenNumber] with its value set to the number as written.
+// Malformed numbers emit an error located at the whole literal.
 func numberState(l *Lexer) lexerState {
+	start := l.pos
+
 	var num strings.Builder
-	for r := l.peek(); '0' <= r && r <= '9'; r = l.peek() {
+	if l.peek() == '0' {
+		num.WriteRune(l.next())
+
+		if base, ok := numberBases[unicode.ToLower(l.peek())]; ok {
+			num.WriteRune(l.next())
+
+			if n, ok := l.digits(&num, base, true); n == 0 || !ok {
+				return l.malformedNumber(start, &num)
+			}
+
+			return l.endNumber(start, &num, base)
+		}
+	}
+
+	if _, ok := l.digits(&num, 10, num.Len() > 0); !ok {
+		return l.malformedNumber(start, &num)
+	}
+
+	if l.peek() == '.' {
+		num.WriteRune(l.next())
+
+		if _, ok := l.digits(&num, 10, false); !ok {
+			return l.malformedNumber(start, &num)
+		}
+	}
+
+	if r := l.peek(); r == 'e' || r == 'E' {
+		num.WriteRune(l.next())
+
+		if r := l.peek(); r == '+' || r == '-' {
+			num.WriteRune(l.next())
+		}
+
+		if n, ok := l.digits(&num, 10, false); n == 0 || !ok {
+			return l.malformedNumber(start, &num)
+		}
+	}
+
+	return l.endNumber(start, &num, 10)
+}
+
+// digits consumes the digits of the base found in the stream and writes them into the builder. Digits might be
+// separated by single underscores. afterDigit tells if a digit or a base prefix comes right before, as an underscore
+// is allowed after them. It returns the amount of digits found, and false if an underscore is misplaced.
+func (l *Lexer) digits(num *strings.Builder, base int, afterDigit bool) (int, bool) {
+	n := 0
+	valid := true
+	for r := l.peek(); isDigitOf(r, base) || r == '_'; r = l.peek() {
+		num.WriteRune(l.next())
+
+		if r == '_' {
+			valid = valid && afterDigit
+			afterDigit = false
+			continue
+		}
+
+		n++
+		afterDigit = true
+	}
+
+	return n, valid && afterDigit
+}
+
+// endNumber emits the number found, unless it's immediately followed by letters or digits that can't be part of it.
+// Digits that don't belong to the base of the number are reported at their position.
+func (l *Lexer) endNumber(start position, num *strings.Builder, base int) lexerState {
+	r := l.peek()
+	if !isIdentifierRune(r) {
+		return l.emmitValue(TokenNumber, num.String())
+	}
+
+	if unicode.IsDigit(r) {
+		at := l.pos
+		l.next()
+		end := l.pos
+
+		for isIdentifierRune(l.peek()) {
+			l.next() // Skip the rest of the literal
+		}
+
+		return l.errorAt(at, end, "invalid digit '%c' in %s literal", r, baseNames[base])
+	}
+
+	return l.malformedNumber(start, num)
+}
+
+// malformedNumber emits an error for a malformed number. Any letter or digit right after the number is consumed, so
+// the error is located at the whole literal.
+func (l *Lexer) malformedNumber(start position, num *strings.Builder) lexerState {
+	for isIdentifierRune(l.peek()) {
 		num.WriteRune(l.next())
 	}
 
-	return l.emmitValue(TokenNumber, num.String())
+	return l.errorAt(start, l.pos, "malformed number: %s", num.String())
+}
+
+// isDigitOf returns true if the rune is a digit of the base. Bases up to 16 are supported.
+func isDigitOf(r rune, base int) bool {
+	d, ok := hexDigit(r)
+	return ok && int(d) < base
 }
 
 // stringState is entered once a leading double-quote (") is found. The state builds a string, concatenating characters
-// from the stream until a closing double-quote (") is found. A token is then emitted of type [TokenString] and value
-// set to the parsed text. It might emmit an error if an unclosed string is found, in this case no [TokenString] is
-// generated.
+// from the stream until a closing double-quote (") is found, and decoding any escape sequence found (see [escape]). A
+// token is then emitted of type [TokenString] and value set to the parsed text. It might emmit an error if an unclosed
+// string or an invalid escape is found, in this case no [TokenString] is generated.
+//
+// Strings might embed expressions between braces, as in "x = {x}". Literal braces are written twice, as in "{{" and
+// "}}", although a single closing brace is also taken literally. The text
+// before the first expression is emitted as a [TokenStringHead], followed by the tokens of the expression (see
+// [Lexer.interpolation]). The text between expressions is emitted as a [TokenStringMiddle], and the text after the
+// last one as a [TokenStringTail].
 func stringState(l *Lexer) lexerState {
+	quote := l.pos
 	l.next() // Skip the leading double-quote
 
+	typ, head := TokenString, TokenStringHead
+
 	var str strings.Builder
-	for r := l.next(); r != '"'; r = l.next() {
+	for r := l.peek(); r != '"'; r = l.peek() {
+		if r == EOF || r == '\n' {
+			// The new-line is left in the stream, as it might terminate the statement
+			return l.errorAt(quote, l.pos, "unclosed string: %s", str.String())
+		}
+
+		if r == '{' {
+			l.next()
+			if l.peek() == '{' {
+				str.WriteRune(l.next())
+				continue
+			}
+
+			l.emmitValue(head, str.String())
+			str.Reset()
+
+			if !l.interpolation(quote) {
+				return startState
+			}
+
+			typ, head = TokenStringTail, TokenStringMiddle
+			continue
+		}
+
+		if r == '}' {
+			str.WriteRune(l.next())
+			if l.peek() == '}' {
+				l.next()
+			}
+
+			continue
+		}
+
+		if r != '\\' {
+			str.WriteRune(l.next())
+			continue
+		}
+
+		v, isByte, ok := l.escape('"')
+		if !ok {
+			return l.skipLiteral('"')
+		}
+
+		if isByte {
+			str.WriteByte(byte(v))
+		} else {
+			str.WriteRune(v)
+		}
+	}
+
+	l.next() // Skip the closing double-quote
+
+	return l.emmitValue(typ, str.String())
+}
+
+// interpolation lexes an expression embedded in the string starting at quote, right after its opening brace. The
+// tokens of the expression are lexed recursively by the states of the lexer, so it might hold any expression, even
+// other strings. The expression ends at the closing brace, or at a colon starting its format specifier, which is
+// emitted as a [TokenFormatSpec]. The closing brace is consumed, and it's located with the text that follows it. If
+// the line ends before the closing brace an error is emitted, and false is returned.
+func (l *Lexer) interpolation(quote position) bool {
+	for {
+		switch r := l.peek(); {
+		case r == EOF || r == '\n':
+			l.errorAt(quote, l.pos, "unclosed string: expected '}' after the embedded expression")
+			return false
+		case r == '}':
+			// The closing brace starts the text after the expression
+			l.start = l.pos
+			l.next()
+
+			return true
+		case r == ':':
+			return l.formatSpec(quote)
+		case unicode.IsSpace(r):
+			l.next()
+			l.start = l.pos
+		default:
+			// Token states emit a token before returning, while comments are entered once their opening symbol is
+			// consumed, and are run until they emit it
+			for state := tokenState(r); ; {
+				state = state(l)
+				if l.start == l.pos {
+					break
+				}
+			}
+		}
+	}
+}
+
+// formatSpec lexes the format specifier of an embedded expression, from its leading colon up to the closing brace.
+// The specifier is checked by the semantic analysis, as its verbs depend on the type of the expression.
+func (l *Lexer) formatSpec(quote position) bool {
+	l.next() // Skip the colon
+	l.start = l.pos
+
+	var spec strings.Builder
+	for r := l.peek(); r != '}'; r = l.peek() {
+		if r == EOF || r == '\n' || r == '"' {
+			l.errorAt(quote, l.pos, "unclosed string: expected '}' after the format specifier")
+
+			if r == '"' {
+				l.next() // The quote closes the string
+			}
+
+			return false
+		}
+
+		spec.WriteRune(l.next())
+	}
+
+	l.emmitValue(TokenFormatSpec, spec.String())
+	l.next() // The closing brace starts the text after the expression
+
+	return true
+}
+
+// rawStringState is entered once a leading backtick (`) is found. The state builds a string with all characters found
+// until the closing backtick, which might span multiple lines. Escape sequences are not decoded in raw strings. A token
+// of type [TokenString] is emitted, or an error if the string is unclosed.
+func rawStringState(l *Lexer) lexerState {
+	l.next() // Skip the leading backtick
+
+	var str strings.Builder
+	for r := l.next(); r != '`'; r = l.next() {
 		if r == EOF {
-			return l.errorf("unclosed string: %s", str.String())
+			return l.errorf("unclosed raw string: %s", str.String())
 		}
 
 		str.WriteRune(r)
@@ -283,13 +648,190 @@ func stringState(l *Lexer) lexerState {
 	return l.emmitValue(TokenString, str.String())
 }
 
-// identifierState is entered when a non-escaped string is found in the stream. The state builds the identifier by
-// consuming from the stream up to the moment a not valid identifier character is found. If the identifier does not
+// runeState is entered once a leading single-quote (') is found. The state reads exactly one character, which might be
+// an escape sequence, followed by the closing single-quote. A token of type [TokenRune] is emitted, or an error if the
+// literal is empty, unclosed or holds more than one character.
+func runeState(l *Lexer) lexerState {
+	start := l.pos
+	l.next() // Skip the leading single-quote
+
+	if c := l.peek(); c == EOF || c == '\n' {
+		return l.errorAt(start, l.pos, "unclosed rune literal")
+	}
+
+	var r rune
+	switch l.peek() {
+	case '\'':
+		l.next()
+		return l.errorAt(start, l.pos, "empty rune literal")
+	case '\\':
+		v, _, ok := l.escape('\'')
+		if !ok {
+			return l.skipLiteral('\'')
+		}
+
+		r = v
+	default:
+		r = l.next()
+	}
+
+	extra := false
+	for c := l.peek(); c != '\''; c = l.peek() {
+		if c == EOF || c == '\n' {
+			return l.errorAt(start, l.pos, "unclosed rune literal")
+		}
+
+		if l.next() == '\\' && l.peek() != EOF && l.peek() != '\n' {
+			l.next() // Skip the escaped character, so an escaped quote doesn't close the literal
+		}
+
+		extra = true
+	}
+
+	l.next() // Skip the closing single-quote
+
+	if extra {
+		return l.errorAt(start, l.pos, "more than one character in rune literal")
+	}
+
+	return l.emmitValue(TokenRune, string(r))
+}
+
+// isIdentifierRune returns true if the rune can be part of an identifier: Unicode letters and digits, and underscores.
+// Identifiers can't start with a digit.
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// escapeTable maps the single character escape sequences to the character they denote
+var escapeTable = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+}
+
+// escape decodes an escape sequence inside a string or rune literal delimited by quote, starting at its leading
+// backslash. Besides the sequences in [escapeTable] and the escaped quote, a byte might be written
+// in hexadecimal as \xNN, and a Unicode code point as \u{NNNN} (up to 6 hex digits). The decoded value is returned,
+// and isByte is set if the value is a single byte (\xNN) rather than a character.
+//
+// If the escape is invalid an error is emitted, located at the escape sequence, and ok is set to false.
+func (l *Lexer) escape(quote rune) (v rune, isByte bool, ok bool) {
+	start := l.pos
+	l.next() // Skip the backslash
+
+	r := l.peek()
+	if r == EOF || r == '\n' {
+		l.errorAt(start, l.pos, "unterminated escape sequence")
+		return 0, false, false
+	}
+
+	l.next()
+	if r == quote {
+		return r, false, true
+	}
+
+	if v, ok := escapeTable[r]; ok {
+		return v, false, true
+	}
+
+	switch r {
+	case 'x':
+		v, n := l.hex(2)
+		if n != 2 {
+			l.errorAt(start, l.pos, "invalid escape sequence: \\x expects 2 hex digits")
+			return 0, false, false
+		}
+
+		return v, true, true
+	case 'u':
+		if l.peek() != '{' {
+			l.errorAt(start, l.pos, "invalid escape sequence: \\u expects a code point inside braces, as in \\u{1F600}")
+			return 0, false, false
+		}
+
+		l.next()
+
+		v, n := l.hex(6)
+		if n == 0 || l.peek() != '}' {
+			l.errorAt(start, l.pos, "invalid escape sequence: \\u expects 1 to 6 hex digits inside braces")
+			return 0, false, false
+		}
+
+		l.next()
+
+		if v > unicode.MaxRune || (0xD800 <= v && v <= 0xDFFF) {
+			l.errorAt(start, l.pos, "invalid escape sequence: %U is not a valid code point", v)
+			return 0, false, false
+		}
+
+		return v, false, true
+	default:
+		l.errorAt(start, l.pos, "unknown escape sequence: \\%c", r)
+		return 0, false, false
+	}
+}
+
+// skipLiteral consumes the rest of a string or rune literal delimited by quote, up to its closing quote. It's used to
+// resume lexing after an error inside the literal. Escaped quotes don't close the literal, and as interpreted literals
+// can't span lines, a new-line ends it too.
+func (l *Lexer) skipLiteral(quote rune) lexerState {
+	for r := l.peek(); r != EOF && r != '\n'; r = l.peek() {
+		l.next()
+
+		if r == quote {
+			break
+		}
+
+		if r == '\\' && l.peek() != EOF && l.peek() != '\n' {
+			l.next() // Skip the escaped character
+		}
+	}
+
+	l.start = l.pos
+	return startState
+}
+
+// hex consumes up to max hexadecimal digits from the stream, and returns their value and the amount of digits read
+func (l *Lexer) hex(max int) (rune, int) {
+	var v rune
+	n := 0
+	for ; n < max; n++ {
+		d, ok := hexDigit(l.peek())
+		if !ok {
+			break
+		}
+
+		l.next()
+		v = v*16 + d
+	}
+
+	return v, n
+}
+
+// hexDigit returns the value of a hexadecimal digit, or false if the rune is not one
+func hexDigit(r rune) (rune, bool) {
+	switch {
+	case '0' <= r && r <= '9':
+		return r - '0', true
+	case 'a' <= r && r <= 'f':
+		return r - 'a' + 10, true
+	case 'A' <= r && r <= 'F':
+		return r - 'A' + 10, true
+	}
+
+	return 0, false
+}
+
+// identifierState is entered when a letter or an underscore is found in the stream. The state builds the identifier by
+// consuming from the stream up to the moment a not valid identifier character is found (see [isIdentifierRune]). If the identifier does not
 // match a keyword the state emits a Token of type [TokenIdentifier] and the value set to the identifier. If the
 // identifier is a keyword the keyword's type is emitted, based on the [keywordTable].
 func identifierState(l *Lexer) lexerState {
 	var id strings.Builder
-	for r := l.peek(); unicode.IsLetter(r); r = l.peek() {
+	for r := l.peek(); isIdentifierRune(r); r = l.peek() {
 		id.WriteRune(l.next())
 	}
 
@@ -305,13 +847,16 @@ func identifierState(l *Lexer) lexerState {
 // [operatorTable]), the corresponding token type is emitted, otherwise an error will be emitted.
 func operatorState(l *Lexer) lexerState {
 	r := l.next()
-	if r == ':' || r == '/' || r == '=' { // Some operators can be two runes
-		op := string(r) + string(l.peek())
-		if tok, ok := operatorTable[string(r)+string(l.peek())]; ok {
+	if next := l.peek(); next != EOF { // Some operators can be two runes
+		op := string(r) + string(next)
+		if tok, ok := operatorTable[op]; ok {
 			l.next() // Skip
 
-			if tok == TokenLineComment {
+			switch tok {
+			case TokenLineComment:
 				return lineCommentState
+			case TokenBlockComment:
+				return blockCommentState
 			}
 
 			return l.emmitValue(tok, op)
@@ -328,14 +873,100 @@ func operatorState(l *Lexer) lexerState {
 // lineCommentState is entered when a leading "//" is found. It's expected that the "//" operator is already
 // consumed when this state is entered. The state builds the comment by reading all runes from the stream until
 // the rune matches a new-line ("/n") or the end-of-file is reached. The emitted token is of type [TokenLineComment]
-// and holds the comment as a value.
+// and holds the comment as a value, or [TokenDocComment] if the comment documents the code below it.
 func lineCommentState(l *Lexer) lexerState {
+	explicitDoc := false
+	if l.peek() == '/' {
+		l.next() // Skip the third slash of a doc comment
+		explicitDoc = true
+	}
+
 	var id strings.Builder
 	for r := l.peek(); r != '\n' && r != EOF; r = l.peek() {
 		id.WriteRune(l.next())
 	}
 
-	return l.emmitValue(TokenLineComment, id.String())
+	return l.emmitComment(TokenLineComment, id.String(), explicitDoc)
+}
+
+// blockCommentState is entered when a leading "/*" is found, and it's expected to be already consumed. The state reads
+// the comment until its closing "*/". Block comments might be nested, so every "/*" inside the comment must be closed
+// before the comment ends. An error located at the opening "/*" is emitted if the comment is unterminated, otherwise
+// a [TokenBlockComment] (or [TokenDocComment]) is emitted holding the text inside the comment.
+func blockCommentState(l *Lexer) lexerState {
+	start := l.start // The opening "/*" is already consumed
+
+	var text strings.Builder
+	for depth := 1; ; {
+		r := l.next()
+		switch {
+		case r == EOF:
+			return l.errorAt(start, start.ahead(2), "unterminated comment")
+		case r == '/' && l.peek() == '*':
+			depth++
+			text.WriteRune(r)
+			r = l.next()
+		case r == '*' && l.peek() == '/':
+			l.next()
+
+			depth--
+			if depth == 0 {
+				return l.emmitComment(TokenBlockComment, text.String(), false)
+			}
+
+			text.WriteString("*/")
+			continue
+		}
+
+		text.WriteRune(r)
+	}
+}
+
+// emmitComment emits a comment of type t, or a [TokenDocComment] if the comment documents the code below it. To find
+// out, the whitespace after the comment is consumed: a comment placed on its own line and followed by code in the next
+// line is a doc comment. Explicit doc comments only need to be on their own line. Comments followed by the end of a
+// block or of the file document nothing.
+//
+// Comments are skipped by automatic semicolon insertion, so if the comment is followed by a new-line (or has one
+// inside) and the last token might end a statement, a [TokenSemicolon] is emitted after the comment.
+func (l *Lexer) emmitComment(t TokenType, text string, explicitDoc bool) lexerState {
+	loc := l.location()
+	ownLine := l.lineStart
+	end := l.pos
+
+	newlines := 0
+	for r := l.peek(); unicode.IsSpace(r); r = l.peek() {
+		if l.next() == '\n' {
+			newlines++
+		}
+	}
+
+	next := l.peek()
+	documents := next != EOF && next != '}'
+	if ownLine && documents && (newlines == 1 || explicitDoc && newlines > 0) {
+		t = TokenDocComment
+	}
+
+	l.output <- Token{
+		Typ:   t,
+		Value: text,
+		Loc:   loc,
+	}
+
+	if l.terminates && (newlines > 0 || strings.ContainsRune(text, '\n')) {
+		l.output <- Token{
+			Typ:   TokenSemicolon,
+			Value: "\n",
+			Loc:   l.span(end, end.ahead(1)),
+		}
+
+		l.terminates = false
+	}
+
+	l.start = l.pos
+	l.lineStart = newlines > 0
+
+	return startState
 }
 
 // endState emits an end-of-file token and finishes the execution by returning a nil state as a result.
@@ -344,14 +975,27 @@ func endState(l *Lexer) lexerState {
 	return nil
 }
 
-// errorf is a shorthand for emitting a [TokenError] token with its value set to formatted string.
+// errorf is a shorthand for emitting a [TokenError] token with its value set to formatted string. The error is located
+// at the text consumed since the last emitted token.
 func (l *Lexer) errorf(format string, args ...interface{}) lexerState {
+	return l.errorAt(l.start, l.pos, format, args...)
+}
+
+// errorAt emits a [TokenError] token with its value set to the formatted string, located between the start and end
+// positions. Errors don't stop the lexer: the offending runes are expected to be already consumed, and lexing resumes
+// from the current position with a [startState]. An error takes the place of a token, so it might end a statement.
+func (l *Lexer) errorAt(start position, end position, format string, args ...interface{}) lexerState {
 	l.output <- Token{
 		Typ:   TokenError,
 		Value: fmt.Sprintf(format, args...),
+		Loc:   l.span(start, end),
 	}
 
-	return endState
+	l.start = l.pos
+	l.lineStart = false
+	l.terminates = true
+
+	return startState
 }
 
 // emmitNext is a shorthand for emitting a token of the t type, and setting its value to the next token in the stream.
@@ -370,15 +1014,21 @@ func (l *Lexer) emmitValue(t TokenType, val string) lexerState {
 	}
 
 	l.start = l.pos
+	l.lineStart = false
+	l.terminates = statementEnds[t]
 
 	return startState
 }
 
 // peek returns the next rune on the stream without advancing its position.
 func (l *Lexer) peek() rune {
-	r := l.next()
-	if r != EOF && r != utf8.RuneError {
-		l.pos-- // Revert position incrementer
+	r, _, err := l.reader.ReadRune()
+	if err != nil {
+		if err == io.EOF {
+			return EOF
+		}
+
+		return utf8.RuneError
 	}
 
 	_ = l.reader.UnreadRune()
@@ -386,9 +1036,10 @@ func (l *Lexer) peek() rune {
 	return r
 }
 
-// next fetches the next rune in the stream and consumes it by advancing one position.
+// next fetches the next rune in the stream and consumes it by advancing one position. New-lines move the position to
+// the start of the next line.
 func (l *Lexer) next() rune {
-	r, _, err := l.reader.ReadRune()
+	r, size, err := l.reader.ReadRune()
 	if err != nil {
 		if err == io.EOF {
 			return EOF
@@ -397,22 +1048,106 @@ func (l *Lexer) next() rune {
 		return utf8.RuneError
 	}
 
-	l.pos++
+	l.pos.offset += uint64(size)
+	if r == '\n' {
+		l.pos.line++
+		l.pos.col = 1
+	} else {
+		l.pos.col++
+	}
+
 	return r
 }
 
-// location returns the current location data of the lexer.
+// ahead returns the position n runes ahead. It's only valid if the runes are single bytes, and are not new-lines.
+func (p position) ahead(n uint64) position {
+	return position{offset: p.offset + n, line: p.line, col: p.col + n}
+}
+
+// location returns the current location data of the lexer, from the start of the token to the current position.
 func (l *Lexer) location() *Location {
+	return l.span(l.start, l.pos)
+}
+
+// span returns the location of the source code between the start and end positions
+func (l *Lexer) span(start position, end position) *Location {
 	return &Location{
-		File:  l.filename,
-		Start: l.start,
-		End:   l.pos,
+		Start:   start.offset,
+		End:     end.offset,
+		Line:    start.line,
+		Col:     start.col,
+		EndLine: end.line,
+		EndCol:  end.col,
+		File:    l.filename,
 	}
 }
 
-// String pretty formats the location data.
+// String formats the location as "file:line:col", pointing to the start of the location.
 func (m *Location) String() string {
-	return fmt.Sprintf("%s:[%d:%d]", path.Base(m.File), m.Start, m.End)
+	file := m.File
+	if file == "" {
+		file = "<input>"
+	}
+
+	return fmt.Sprintf("%s:%d:%d", file, m.Line, m.Col)
+}
+
+// prefix returns the location of the text found at the start of the location, which must be on its first line. It's
+// used to point to a name at the start of a larger construct, such as the variable of a declaration.
+func (m *Location) prefix(text string) *Location {
+	if m == nil {
+		return nil
+	}
+
+	n := uint64(len(text))
+	return &Location{
+		Start:   m.Start,
+		End:     m.Start + n,
+		Line:    m.Line,
+		Col:     m.Col,
+		EndLine: m.Line,
+		EndCol:  m.Col + uint64(utf8.RuneCountInString(text)),
+		File:    m.File,
+	}
+}
+
+// Snippet returns the line of source code where the location starts, followed by a line with carets (^) underlining
+// the location. Locations spanning multiple lines are underlined up to the end of their first line. If the location is
+// outside the source an empty string is returned.
+func (m *Location) Snippet(source []byte) string {
+	if m.Start > uint64(len(source)) || m.Line == 0 {
+		return ""
+	}
+
+	start := bytes.LastIndexByte(source[:m.Start], '\n') + 1
+	end := len(source)
+	if i := bytes.IndexByte(source[start:], '\n'); i >= 0 {
+		end = start + i
+	}
+
+	line := strings.TrimRight(string(source[start:end]), "\r")
+
+	// Keep tabs in the underline so carets are aligned with the code
+	var underline strings.Builder
+	col, width := uint64(1), uint64(0)
+	for _, r := range line {
+		switch {
+		case col < m.Col && r == '\t':
+			underline.WriteRune('\t')
+		case col < m.Col:
+			underline.WriteRune(' ')
+		case m.EndLine > m.Line || col < m.EndCol:
+			width++
+		}
+
+		col++
+	}
+
+	if width == 0 {
+		width = 1 // Empty spans and the end of the line still get a caret
+	}
+
+	return line + "\n" + underline.String() + strings.Repeat("^", int(width))
 }
 
 // isValid will return false if the token is of type [TokenEOF] or [TokenError], and true otherwise
@@ -425,7 +1160,8 @@ func (t Token) isEmpty() bool {
 	return t.Typ != TokenEOF && t.Typ != TokenError
 }
 
-// isComment will return true only if the token is of type [TokenLineComment]
+// isComment will return true only if the token is a comment: [TokenLineComment], [TokenBlockComment] or
+// [TokenDocComment]
 func (t Token) isComment() bool {
-	return t.Typ == TokenLineComment
+	return t.Typ == TokenLineComment || t.Typ == TokenBlockComment || t.Typ == TokenDocComment
 }
@@ -51,6 +51,156 @@ func TestLexer(t *testing.T) {
 				{TokenCloseCurly, "}", nil},
 			},
 		},
+		{
+			"Identifiers",
+			"x1 my_var _ _x9 ünï2",
+			false,
+			[]Token{
+				{TokenIdentifier, "x1", nil},
+				{TokenIdentifier, "my_var", nil},
+				{TokenIdentifier, "_", nil},
+				{TokenIdentifier, "_x9", nil},
+				{TokenIdentifier, "ünï2", nil},
+			},
+		},
+		{
+			"PrefixedNumbers",
+			"0x1F 0XaB 0o17 0O7 0b1010 0B1",
+			false,
+			[]Token{
+				{TokenNumber, "0x1F", nil},
+				{TokenNumber, "0XaB", nil},
+				{TokenNumber, "0o17", nil},
+				{TokenNumber, "0O7", nil},
+				{TokenNumber, "0b1010", nil},
+				{TokenNumber, "0B1", nil},
+			},
+		},
+		{
+			"DigitSeparators",
+			"1_000_000 0x_FF_FF 0b1_0 1_0.2_5e1_0",
+			false,
+			[]Token{
+				{TokenNumber, "1_000_000", nil},
+				{TokenNumber, "0x_FF_FF", nil},
+				{TokenNumber, "0b1_0", nil},
+				{TokenNumber, "1_0.2_5e1_0", nil},
+			},
+		},
+		{"EmptyHexadecimal", "0x", true, nil},
+		{"EmptyBinary", "0b_", true, nil},
+		{"DoubleSeparator", "1__2", true, nil},
+		{"TrailingSeparator", "1_", true, nil},
+		{"SeparatorAfterDot", "1._5", true, nil},
+		{"InvalidBinaryDigit", "0b102", true, nil},
+		{"InvalidOctalDigit", "0o8", true, nil},
+		{"LettersAfterNumber", "12abc", true, nil},
+		{
+			"NestedBlockComment",
+			"x /* outer /* inner */ still a comment */ y",
+			false,
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenBlockComment, " outer /* inner */ still a comment ", nil},
+				{TokenIdentifier, "y", nil},
+			},
+		},
+		{
+			"UnterminatedBlockComment",
+			"/* outer /* inner */",
+			true,
+			nil,
+		},
+		{
+			"DocComments",
+			"// header\n\n/// explicit\n\n// leading\n/* block */\nfunc main() {\n// last\n}",
+			false,
+			[]Token{
+				{TokenLineComment, " header", nil},
+				{TokenDocComment, " explicit", nil},
+				{TokenDocComment, " leading", nil},
+				{TokenDocComment, " block ", nil},
+				{TokenFunc, "func", nil},
+				{TokenIdentifier, "main", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenOpenCurly, "{", nil},
+				{TokenLineComment, " last", nil},
+				{TokenCloseCurly, "}", nil},
+			},
+		},
+		{
+			"TrailingComment",
+			"x := 1 // trailing\ny := 2",
+			false,
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+				{TokenLineComment, " trailing", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenIdentifier, "y", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "2", nil},
+			},
+		},
+		{
+			"SemicolonInsertion",
+			"x := 1\n-2\nprint(x)\ny := x +\n2\n",
+			false,
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenMinus, "-", nil},
+				{TokenNumber, "2", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenIdentifier, "print", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenIdentifier, "y", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenPlus, "+", nil},
+				{TokenNumber, "2", nil},
+				{TokenSemicolon, "\n", nil},
+			},
+		},
+		{
+			"ExplicitSemicolons",
+			"x := 1; y := 'a';\nz := \"s\"",
+			false,
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+				{TokenSemicolon, ";", nil},
+				{TokenIdentifier, "y", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenRune, "a", nil},
+				{TokenSemicolon, ";", nil},
+				{TokenIdentifier, "z", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenString, "s", nil},
+			},
+		},
+		{
+			"SemicolonAfterBlockComment",
+			"x /* multi\nline */ y /* inline */ + 1",
+			false,
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenBlockComment, " multi\nline ", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenIdentifier, "y", nil},
+				{TokenBlockComment, " inline ", nil},
+				{TokenPlus, "+", nil},
+				{TokenNumber, "1", nil},
+			},
+		},
 		{
 			"UnicodeVarDeclaration",
 			"únicódeShouldBeVàlid := 1",
@@ -133,18 +283,22 @@ func TestLexer(t *testing.T) {
 				{TokenNumber, "2", nil},
 				{TokenMinus, "-", nil},
 				{TokenNumber, "3", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenNumber, "2", nil},
 				{TokenPlus, "+", nil},
 				{TokenNumber, "3", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenCloseCurly, "}", nil},
 				{TokenElse, "else", nil},
 				{TokenOpenCurly, "{", nil},
 				{TokenNumber, "1", nil},
 				{TokenMinus, "-", nil},
 				{TokenNumber, "2", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenNumber, "1", nil},
 				{TokenPlus, "+", nil},
 				{TokenNumber, "2", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenCloseCurly, "}", nil},
 			},
 		},
@@ -158,6 +312,144 @@ func TestLexer(t *testing.T) {
 				{TokenNumber, "1", nil},
 			},
 		},
+		{
+			"FloatNumbers",
+			"1.5 2e10 3.25E-2",
+			false,
+			[]Token{
+				{TokenNumber, "1.5", nil},
+				{TokenNumber, "2e10", nil},
+				{TokenNumber, "3.25E-2", nil},
+			},
+		},
+		{
+			"MalformedExponent",
+			"1e+",
+			true,
+			nil,
+		},
+		{
+			"Conversion",
+			"int64(x)",
+			false,
+			[]Token{
+				{TokenIdentifier, "int64", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenCloseParentheses, ")", nil},
+			},
+		},
+		{
+			"BitwiseOperators",
+			"a%b&c|d^e&^f<<g>>h",
+			false,
+			[]Token{
+				{TokenIdentifier, "a", nil},
+				{TokenModulo, "%", nil},
+				{TokenIdentifier, "b", nil},
+				{TokenBitAnd, "&", nil},
+				{TokenIdentifier, "c", nil},
+				{TokenBitOr, "|", nil},
+				{TokenIdentifier, "d", nil},
+				{TokenBitXor, "^", nil},
+				{TokenIdentifier, "e", nil},
+				{TokenBitClear, "&^", nil},
+				{TokenIdentifier, "f", nil},
+				{TokenShiftLeft, "<<", nil},
+				{TokenIdentifier, "g", nil},
+				{TokenShiftRight, ">>", nil},
+				{TokenIdentifier, "h", nil},
+			},
+		},
+		{
+			"StringEscapes",
+			`"say \"hi\"\n\t\\ \x41\u{e9}"`,
+			false,
+			[]Token{
+				{TokenString, "say \"hi\"\n\t\\ A\u00e9", nil},
+			},
+		},
+		{
+			"RawString",
+			"`first \\n\nsecond`",
+			false,
+			[]Token{
+				{TokenString, "first \\n\nsecond", nil},
+			},
+		},
+		{
+			"Runes",
+			`'a' '\'' '\n' '\x7f' '\u{1F600}' 'ñ'`,
+			false,
+			[]Token{
+				{TokenRune, "a", nil},
+				{TokenRune, "'", nil},
+				{TokenRune, "\n", nil},
+				{TokenRune, "\x7f", nil},
+				{TokenRune, "\U0001F600", nil},
+				{TokenRune, "ñ", nil},
+			},
+		},
+		{
+			"Interpolation",
+			`"x = {x}, sum = {a + f("}")}{{}}"`,
+			false,
+			[]Token{
+				{TokenStringHead, "x = ", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenStringMiddle, ", sum = ", nil},
+				{TokenIdentifier, "a", nil},
+				{TokenPlus, "+", nil},
+				{TokenIdentifier, "f", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenString, "}", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenStringTail, "{}", nil},
+			},
+		},
+		{
+			"FormatSpec",
+			`"{x:08x}{y}"`,
+			false,
+			[]Token{
+				{TokenStringHead, "", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenFormatSpec, "08x", nil},
+				{TokenStringMiddle, "", nil},
+				{TokenIdentifier, "y", nil},
+				{TokenStringTail, "", nil},
+			},
+		},
+		{
+			"UnclosedInterpolation",
+			"\"x = {x\n",
+			true,
+			nil,
+		},
+		{
+			"UnknownEscape",
+			`"\q"`,
+			true,
+			nil,
+		},
+		{
+			"NewlineInString",
+			"\"first\nsecond\"",
+			true,
+			nil,
+		},
+		{
+			"EmptyRune",
+			`''`,
+			true,
+			nil,
+		},
+		{
+			"MultipleCharacterRune",
+			`'ab'`,
+			true,
+			nil,
+		},
 	}
 
 	for _, c := range cases {
@@ -179,6 +471,120 @@ func TestLexer(t *testing.T) {
 	}
 }
 
+func TestLexerErrorLocation(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		expect *Location
+	}{
+		{"UnclosedInterpolation", `x := "a{b`, &Location{Start: 5, End: 9, Line: 1, Col: 6, EndLine: 1, EndCol: 10}},
+		{"UnknownEscape", `x := "ab\qc"`, &Location{Start: 8, End: 10, Line: 1, Col: 9, EndLine: 1, EndCol: 11}},
+		{"ShortHexEscape", `"\x4"`, &Location{Start: 1, End: 4, Line: 1, Col: 2, EndLine: 1, EndCol: 5}},
+		{"UnclosedCodePoint", `"\u{41"`, &Location{Start: 1, End: 6, Line: 1, Col: 2, EndLine: 1, EndCol: 7}},
+		{"SurrogateCodePoint", `"\u{D800}"`, &Location{Start: 1, End: 9, Line: 1, Col: 2, EndLine: 1, EndCol: 10}},
+		{"EscapedDoubleQuoteInRune", `'\"'`, &Location{Start: 1, End: 3, Line: 1, Col: 2, EndLine: 1, EndCol: 4}},
+		{"MultipleCharacterRune", `x := 'ab'`, &Location{Start: 5, End: 9, Line: 1, Col: 6, EndLine: 1, EndCol: 10}},
+		{"UnterminatedComment", "x /* a /* b */", &Location{Start: 2, End: 4, Line: 1, Col: 3, EndLine: 1, EndCol: 5}},
+		{"EmptyHexadecimal", "x := 0x", &Location{Start: 5, End: 7, Line: 1, Col: 6, EndLine: 1, EndCol: 8}},
+		{"DoubleSeparator", "x := 1__2 + 1", &Location{Start: 5, End: 9, Line: 1, Col: 6, EndLine: 1, EndCol: 10}},
+		{"InvalidBinaryDigit", "x := 0b1021", &Location{Start: 9, End: 10, Line: 1, Col: 10, EndLine: 1, EndCol: 11}},
+		{"SecondLine", "x := 1\ny := 'ab'", &Location{Start: 12, End: 16, Line: 2, Col: 6, EndLine: 2, EndCol: 10}},
+		{"MultiByteRunes", `é := "\q"`, &Location{Start: 7, End: 9, Line: 1, Col: 7, EndLine: 1, EndCol: 9}},
+		{"LettersAfterNumber", "x := 12abc", &Location{Start: 5, End: 10, Line: 1, Col: 6, EndLine: 1, EndCol: 11}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := NewLexerFromReader(strings.NewReader(c.data))
+			go l.Do()
+
+			tok := l.Get()
+			for tok.isValid() {
+				tok = l.Get()
+			}
+
+			assert.Equal(t, TokenError, tok.Typ)
+			assert.Equal(t, c.expect, tok.Loc)
+		})
+	}
+}
+
+func TestLocationSnippet(t *testing.T) {
+	source := "func main() {\n\tx := 1 + yy\n\tprint(\"é\", z)\n}"
+
+	cases := []struct {
+		name   string
+		loc    *Location
+		expect string
+	}{
+		{
+			"SingleRune",
+			&Location{Start: 10, End: 11, Line: 1, Col: 11, EndLine: 1, EndCol: 12},
+			"func main() {\n          ^",
+		},
+		{
+			"TabIndentation",
+			&Location{Start: 24, End: 26, Line: 2, Col: 11, EndLine: 2, EndCol: 13},
+			"\tx := 1 + yy\n\t         ^^",
+		},
+		{
+			"MultiByteRunes",
+			&Location{Start: 39, End: 40, Line: 3, Col: 13, EndLine: 3, EndCol: 14},
+			"\tprint(\"é\", z)\n\t           ^",
+		},
+		{
+			"MultipleLines",
+			&Location{Start: 0, End: 44, Line: 1, Col: 1, EndLine: 4, EndCol: 2},
+			"func main() {\n^^^^^^^^^^^^^",
+		},
+		{
+			"OutsideSource",
+			&Location{Start: 100, End: 101, Line: 9, Col: 1, EndLine: 9, EndCol: 2},
+			"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.loc.Snippet([]byte(source)))
+		})
+	}
+}
+
+func TestLexerRecovery(t *testing.T) {
+	data := "a := 1 @ 2\ns := \"\\q\\\"\" + 'xy'\n0b12 # b"
+
+	l := NewLexerFromReader(strings.NewReader(data))
+	go l.Do()
+
+	var got []Token
+	for tok := l.Get(); tok.Typ != TokenEOF; tok = l.Get() {
+		if tok.Typ != TokenError {
+			tok.Loc = nil // Only check the location of errors
+		}
+
+		got = append(got, tok)
+	}
+
+	assert.Equal(t, []Token{
+		{TokenIdentifier, "a", nil},
+		{TokenDeclaration, ":=", nil},
+		{TokenNumber, "1", nil},
+		{TokenError, "invalid symbol '@'", &Location{Start: 7, End: 8, Line: 1, Col: 8, EndLine: 1, EndCol: 9}},
+		{TokenNumber, "2", nil},
+		{TokenSemicolon, "\n", nil},
+		{TokenIdentifier, "s", nil},
+		{TokenDeclaration, ":=", nil},
+		{TokenError, "unknown escape sequence: \\q", &Location{Start: 17, End: 19, Line: 2, Col: 7, EndLine: 2, EndCol: 9}},
+		{TokenPlus, "+", nil},
+		{TokenError, "more than one character in rune literal", &Location{Start: 25, End: 29, Line: 2, Col: 15, EndLine: 2, EndCol: 19}},
+		{TokenSemicolon, "\n", nil},
+		{TokenError, "invalid digit '2' in binary literal", &Location{Start: 33, End: 34, Line: 3, Col: 4, EndLine: 3, EndCol: 5}},
+		{TokenError, "invalid symbol '#'", &Location{Start: 35, End: 36, Line: 3, Col: 6, EndLine: 3, EndCol: 7}},
+		{TokenIdentifier, "b", nil},
+	}, got)
+}
+
 // Use a package-level variable to avoid compiler optimisation
 var benchResult []Token
 
@@ -1,6 +1,9 @@
 package maqui
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // AST is an Abstract Syntax Tree that contains the statements found inside a file, and its respective symbol table.
 // The statements are presented as annotated expressions, that contain the resolved type of the expression, if any.
@@ -13,6 +16,8 @@ type AST struct {
 	Errors []CompileError
 	// Filename is a string that points to the file that created this AST
 	Filename string
+	// Target is the platform the AST was checked for
+	Target Target
 }
 
 // Expr defines an expression, that must at a minimum contain the location of the source code that generated it.
@@ -41,6 +46,8 @@ type BadExpr struct {
 	Location *Location
 	// Error gives a description of the error
 	Error string
+	// Suggestion is a replacement for the source code at Location that is likely to fix the error, if any
+	Suggestion string
 }
 
 // GetLocation returns the location of the source code that generated the error
@@ -57,6 +64,8 @@ type FuncDecl struct {
 	Name string
 	// Body contains all the statements inside the definition blocks
 	Body []Expr
+	// Doc holds the doc comment written right before the function, without the comment symbols
+	Doc string
 }
 
 // GetLocation returns the location of the source code that generated the function
@@ -76,6 +85,8 @@ type VariableDecl struct {
 	Value Expr
 	// ResolvedType contains the type the compiler resolved this variable to
 	ResolvedType Type
+	// Doc holds the doc comment written right before a global variable, without the comment symbols
+	Doc string
 }
 
 // GetLocation returns the location of the source code that generated the expression
@@ -128,8 +139,8 @@ func (e EOS) GetLocation() *Location {
 	return e.Location
 }
 
-// BinaryOp defines a binary operation type. Valid types are addition (+), subtraction (-), multiplication (*), and
-// division (/).
+// BinaryOp defines a binary operation type. Valid types are addition (+), subtraction (-), multiplication (*),
+// division (/), remainder (%), the bitwise operations (&, |, ^, &^) and shifts (<<, >>).
 type BinaryOp string
 
 const (
@@ -141,6 +152,21 @@ const (
 	BinaryMultiplication BinaryOp = "*"
 	// BinaryDivision is the division (/) of two expressions
 	BinaryDivision BinaryOp = "/"
+	// BinaryModulo is the remainder (%) of the division of two expressions
+	BinaryModulo BinaryOp = "%"
+	// BinaryAnd is the bitwise and (&) between two expressions
+	BinaryAnd BinaryOp = "&"
+	// BinaryOr is the bitwise or (|) between two expressions
+	BinaryOr BinaryOp = "|"
+	// BinaryXor is the bitwise xor (^) between two expressions
+	BinaryXor BinaryOp = "^"
+	// BinaryAndNot is the bit clear (&^) of the first expression by the second one
+	BinaryAndNot BinaryOp = "&^"
+	// BinaryShiftLeft is the left shift (<<) of the first expression by the second one
+	BinaryShiftLeft BinaryOp = "<<"
+	// BinaryShiftRight is the right shift (>>) of the first expression by the second one. Signed integers keep their
+	// sign (arithmetic shift) while unsigned integers are filled with zeros (logical shift).
+	BinaryShiftRight BinaryOp = ">>"
 )
 
 // BooleanOp defines a binary operation type with a resulting boolean, like comparator operators. Valid types are
@@ -164,6 +190,8 @@ type BinaryExpr struct {
 	Op1 Expr
 	// Op2 is the second operand
 	Op2 Expr
+	// ResolvedType contains the type the compiler resolved the operands and the result to
+	ResolvedType Type
 }
 
 // GetLocation returns the location of the source code that generated the expression
@@ -183,6 +211,8 @@ type BooleanExpr struct {
 	Op1 Expr
 	// Op2 is the second operand
 	Op2 Expr
+	// ResolvedType contains the type the compiler resolved the operands to. The result is always a boolean.
+	ResolvedType Type
 }
 
 // GetLocation returns the location of the source code that generated the expression
@@ -197,6 +227,8 @@ type UnaryOp string
 const (
 	// UnaryNegative is the negation of an expression. For example -1.
 	UnaryNegative UnaryOp = "-"
+	// UnaryBitwiseNot is the bitwise complement of an expression. For example ^1.
+	UnaryBitwiseNot UnaryOp = "^"
 )
 
 // UnaryExpr is an operation over only one operand. It contains the receiver, the operation performed, and the source
@@ -208,6 +240,8 @@ type UnaryExpr struct {
 	Operation UnaryOp
 	// Operand is the receiving operation
 	Operand Expr
+	// ResolvedType contains the type the compiler resolved the operand and the result to
+	ResolvedType Type
 }
 
 // GetLocation returns the location of the source code that generated the expression
@@ -223,6 +257,9 @@ const (
 	LiteralNumber LiteralType = iota
 	// LiteralString defines the immediate value type of an escaped text
 	LiteralString
+	// LiteralRune defines the immediate value type of a single character. Like numbers, runes are untyped constants,
+	// and they default to int32.
+	LiteralRune
 )
 
 // LiteralExpr contains an expression that's used as an immediate. It contains  the type (LiteralType), location and
@@ -232,7 +269,8 @@ type LiteralExpr struct {
 	Location *Location
 	// Typ is the type of the literal
 	Typ LiteralType
-	// Value holds the value of the literal. For string literals the commas escaping the string will be removed.
+	// Value holds the value of the literal. For string literals the commas escaping the string will be removed, and
+	// for string and rune literals escape sequences are already decoded.
 	Value string
 }
 
@@ -241,6 +279,36 @@ func (e LiteralExpr) GetLocation() *Location {
 	return e.Location
 }
 
+// InterpolationExpr is a string literal with embedded expressions, as in "x = {x}". The value of each expression is
+// formatted and written in the place it's embedded.
+type InterpolationExpr struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Texts holds the literal text around the embedded expressions, with escape sequences already decoded. It holds
+	// one more text than Values: the text before each value, followed by the text after the last one.
+	Texts []string
+	// Values are the embedded expressions, in the order they're found
+	Values []*Interpolation
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e InterpolationExpr) GetLocation() *Location {
+	return e.Location
+}
+
+// Interpolation is an expression embedded in a string, and the format used to write its value
+type Interpolation struct {
+	// Value is the embedded expression
+	Value Expr
+	// Format is the format specifier written after a colon, as in {x:08x}, without the colon. It's empty if the value
+	// is written in its default format.
+	Format string
+	// FormatLoc points to the format specifier, if any
+	FormatLoc *Location
+	// ResolvedType is the type of the value
+	ResolvedType Type
+}
+
 // IfExpr holds a logic branching expression.
 type IfExpr struct {
 	// Location points to the source code that created the expression
@@ -258,6 +326,24 @@ func (e IfExpr) GetLocation() *Location {
 	return e.Location
 }
 
+// ConversionExpr is an expression that converts a value into another type, for example int64(x). It contains the name
+// of the target type, the converted value and its resolved type, and the location inside the source that created it.
+type ConversionExpr struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Type is the name of the type the value is converted to
+	Type string
+	// Value is the expression being converted
+	Value Expr
+	// ResolvedType contains the type the compiler resolved the value to, before the conversion takes place
+	ResolvedType Type
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e ConversionExpr) GetLocation() *Location {
+	return e.Location
+}
+
 // isValidExpr will return false if the expression is of type *BadExpr or *EOS
 func isValidExpr(expr Expr) bool {
 	if expr == nil {
@@ -297,6 +383,17 @@ type Parser struct {
 	// buf holds the next token coming from the tokenizer. It might be empty and populated only when needed. It's used
 	// to keep peeked tokens without having to roll back the stream.
 	buf *Token
+	// comments holds the doc comments found since the last token, until the token they document is fetched
+	comments []string
+	// doc holds the doc comments found right before the last token fetched from the tokenizer
+	doc []string
+	// pos counts the tokens consumed, and it's used to make sure parsing always moves forward
+	pos int
+	// last is the location of the last consumed token. It's used to find where the expression being parsed ends.
+	last *Location
+	// panicking is set when a syntax error leaves the parser in an unknown position of the stream. Tokens are then
+	// skipped until a synchronization point is found (see [Parser.synchronize]).
+	panicking bool
 }
 
 // NewParser creates a Parses with the provided tokenizer as the token provider. It sets the filename of Parser to the
@@ -330,8 +427,8 @@ func (p *Parser) GetFilename() string {
 func (p *Parser) Do() {
 	go p.tokenizer.Do()
 
-	for p.peek().Typ != TokenEOF {
-		p.output <- p.statement()
+	for p.more(TokenEOF) {
+		p.output <- p.declaration()
 	}
 
 	p.output <- &EOS{p.next().Loc}
@@ -346,9 +443,9 @@ func (p *Parser) Run() *AST {
 		Filename: p.GetFilename(),
 	}
 
-	for p.peek().Typ != TokenEOF {
+	for p.more(TokenEOF) {
 		ast.Statements = append(ast.Statements, &AnnotatedExpr{
-			Expr: p.statement(),
+			Expr: p.declaration(),
 		})
 	}
 
@@ -360,7 +457,7 @@ func (p *Parser) Run() *AST {
 // the buffer.
 func (p *Parser) peek() Token {
 	if p.buf == nil {
-		temp := p.next()
+		temp := p.fetch()
 		p.buf = &temp
 	}
 
@@ -369,32 +466,63 @@ func (p *Parser) peek() Token {
 
 // next gets the next token in the stream and moves the position by one. Internally it will first check the buffer (buf)
 // if it contains a token that token will be returned and the buffer will be emptied. If the buffer is empty a new
-// token is fetched from the tokenizer.
+// token is fetched from the tokenizer. The end of the stream is never consumed, so it's always kept buffered.
 func (p *Parser) next() Token {
-	if p.buf != nil {
-		if p.buf.Typ == TokenEOF {
-			// If the token is EOF don't clear the buffer
-			return *p.buf
-		}
+	tok := p.peek()
+	if tok.Typ == TokenEOF {
+		return tok
+	}
 
-		temp := p.buf
-		p.buf = nil
+	p.buf = nil
+	p.pos++
+	p.last = tok.Loc
+
+	return tok
+}
+
+// fetch gets the next token from the tokenizer. Comments are skipped, keeping doc comments until the token they
+// document is found.
+func (p *Parser) fetch() Token {
+	for {
+		tok := p.tokenizer.Get()
+		if !tok.isComment() {
+			p.doc, p.comments = p.comments, nil
+			return tok
+		}
 
-		return *temp
+		if tok.Typ == TokenDocComment {
+			p.comments = append(p.comments, tok.Value)
+		} else {
+			p.comments = nil
+		}
 	}
+}
+
+// span returns the location from the start of an expression to the last consumed token
+func (p *Parser) span(start *Location) *Location {
+	return joinLocations(start, p.last)
+}
 
-	tok := p.tokenizer.Get()
-	if !tok.isValid() {
-		// If a token is invalid (such as Error or EOF) keep it buffered since no more valid tokens are expected
-		p.buf = &tok
+// joinLocations returns a location spanning from the start of the first location to the end of the second. If any of
+// them is missing the other is returned.
+func joinLocations(from *Location, to *Location) *Location {
+	if from == nil {
+		return to
 	}
 
-	if tok.isComment() {
-		// Skip comments
-		return p.next()
+	if to == nil || to.End < from.Start {
+		return from
 	}
 
-	return tok
+	return &Location{
+		Start:   from.Start,
+		End:     to.End,
+		Line:    from.Line,
+		Col:     from.Col,
+		EndLine: to.EndLine,
+		EndCol:  to.EndCol,
+		File:    from.File,
+	}
 }
 
 // expect fetches the next token and moves the position. If the provided type matches the fetched token, then it's
@@ -423,53 +551,232 @@ func (p *Parser) consume(typ TokenType) bool {
 	return true
 }
 
-// errorf is a shorthand for creating a *BadExpr with formatted text
+// errorf is a shorthand for creating a *BadExpr with formatted text. If no location is provided, the error is located at
+// the next token. The parser enters panic mode, so the statement being parsed is synchronized once it finishes.
 func (p *Parser) errorf(l *Location, format string, args ...interface{}) Expr {
+	if l == nil {
+		l = p.peek().Loc
+	}
+
+	p.panicking = true
+
 	return &BadExpr{
 		Location: l,
 		Error:    fmt.Sprintf(format, args...),
 	}
 }
 
+// suggestf works like errorf, but the *BadExpr suggests replacing the source code at the location with a fix
+func (p *Parser) suggestf(l *Location, suggestion string, format string, args ...interface{}) Expr {
+	expr := p.errorf(l, format, args...)
+	expr.(*BadExpr).Suggestion = suggestion
+
+	return expr
+}
+
+// misspelledKeyword returns the keyword an identifier is likely a misspelling of, or an empty string if it doesn't
+// resemble any keyword.
+func misspelledKeyword(name string) string {
+	keywords := make([]string, 0, len(keywordTable))
+	for kw := range keywordTable {
+		keywords = append(keywords, kw)
+	}
+
+	return suggest(name, keywords)
+}
+
+// unexpected creates a *BadExpr for the next token, which doesn't fit the construct being parsed. The token is not
+// consumed. If the token is an error from the lexer, the lexer error is consumed and reported instead, so a single
+// mistake doesn't generate two errors.
+func (p *Parser) unexpected(format string, args ...interface{}) Expr {
+	if tok := p.peek(); tok.Typ == TokenError {
+		p.next()
+		return p.errorf(tok.Loc, "%s", tok.Value)
+	}
+
+	return p.errorf(p.peek().Loc, format, args...)
+}
+
+// syncTokens holds the tokens where parsing can resume after a syntax error. Closing braces also synchronize the
+// parser, but only if they close the block where the error was found.
+var syncTokens = map[TokenType]bool{
+	TokenFunc:      true,
+	TokenIf:        true,
+	TokenSemicolon: true,
+	TokenError:     true, // Lexer errors are reported on their own
+}
+
+// synchronize leaves panic mode by skipping tokens until a synchronization point is found: a token of [syncTokens], the
+// closing brace of the current block, or the end of the stream. Blocks opened while skipping are skipped as a whole. A
+// semicolon terminates the broken statement, so it's consumed too.
+func (p *Parser) synchronize() {
+	p.panicking = false
+
+	depth := 0
+	for tok := p.peek(); tok.Typ != TokenEOF; tok = p.peek() {
+		switch {
+		case tok.Typ == TokenOpenCurly:
+			depth++
+		case tok.Typ == TokenCloseCurly:
+			if depth == 0 {
+				return
+			}
+
+			depth--
+		case depth == 0 && syncTokens[tok.Typ]:
+			if tok.Typ == TokenSemicolon {
+				p.next()
+			}
+
+			return
+		}
+
+		p.next()
+	}
+}
+
+// describe returns a description of the token to be used in error messages
+func describe(tok Token) string {
+	switch {
+	case tok.Typ == TokenEOF:
+		return "end of file"
+	case tok.Typ == TokenSemicolon && tok.Value == "\n":
+		return "newline"
+	case tok.Typ == TokenStringMiddle || tok.Typ == TokenStringTail:
+		return "'}'"
+	case tok.Typ == TokenFormatSpec:
+		return "':" + tok.Value + "'"
+	}
+
+	return fmt.Sprintf("'%s'", tok.Value)
+}
+
+// declaration parses a top level statement. Function declarations and global variables get the doc comment written
+// right before them attached.
+func (p *Parser) declaration() Expr {
+	p.peek() // Fetch the first token, and the doc comments before it
+	doc := docText(p.doc)
+
+	expr := p.statement()
+	switch e := expr.(type) {
+	case *FuncDecl:
+		e.Doc = doc
+	case *VariableDecl:
+		e.Doc = doc
+	}
+
+	return expr
+}
+
+// docText joins the lines of a doc comment, removing the space that usually follows the comment symbol
+func docText(lines []string) string {
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(strings.TrimRight(line, " \t"), " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 // statement is the entry point for parsing. It will first try to resolve the token type to find out what parsing branch
-// to take. If not able, it will use recursive decent to build the tree for the expression.
+// to take. If not able, it will use recursive decent to build the tree for the expression. Statements must be
+// terminated (see [Parser.terminator]). If a syntax error is found the parser is synchronized before returning, so the
+// next statement starts from a known position.
 func (p *Parser) statement() Expr {
+	pos := p.pos
+
+	var expr Expr
 	switch tok := p.peek(); tok.Typ {
 	case TokenFunc:
-		return p.funcDecl()
+		expr = p.funcDecl()
 	case TokenIf:
-		return p.ifBranch()
+		expr = p.ifBranch()
 	default:
-		return p.expr()
+		expr = p.expr()
+	}
+
+	if p.pos == pos {
+		// No statement can start with the token, skip it so parsing always moves forward
+		p.next()
+	}
+
+	if p.panicking || !isValidExpr(expr) {
+		p.synchronize()
+		return expr
 	}
+
+	return p.terminator(expr)
+}
+
+// terminator consumes the semicolon or new-line that terminates a statement. The terminator can be omitted right before
+// the closing brace of a block or the end of the file. If the statement is not terminated a *BadExpr is returned.
+func (p *Parser) terminator(stmt Expr) Expr {
+	switch tok := p.peek(); tok.Typ {
+	case TokenSemicolon:
+		p.next()
+	case TokenCloseCurly, TokenEOF:
+	default:
+		// Misspelled keywords are parsed as identifiers, and fail here: "fucn main() {" or "} esle {"
+		var expr Expr
+		if id, ok := stmt.(*Identifier); ok && misspelledKeyword(id.Name) != "" {
+			expr = p.suggestf(id.Location, misspelledKeyword(id.Name), "unexpected name '%s', expected a statement", id.Name)
+		} else if tok.Typ == TokenIdentifier && misspelledKeyword(tok.Value) != "" {
+			expr = p.suggestf(tok.Loc, misspelledKeyword(tok.Value), "unexpected %s after expression", describe(tok))
+		} else {
+			expr = p.unexpected("unexpected %s after expression; expected newline", describe(tok))
+		}
+		p.synchronize()
+
+		return expr
+	}
+
+	return stmt
+}
+
+// more skips empty statements, and returns true if there are statements left before the closer token or the end of
+// the file.
+func (p *Parser) more(closer TokenType) bool {
+	for p.check(TokenSemicolon) {
+		p.next()
+	}
+
+	tok := p.peek()
+	return tok.Typ != TokenEOF && tok.Typ != closer
 }
 
 // funcDecl builds a function declaration (*FuncDecl) expression. If it fails a *BadExpr will be returned.
 func (p *Parser) funcDecl() Expr {
 	start := p.next().Loc // func keyword
 
-	name := p.expect(TokenIdentifier)
-	if name == nil {
-		return p.errorf(start, "expected function name")
+	name := p.peek()
+	if name.Typ != TokenIdentifier {
+		return p.unexpected("expected function name, found %s", describe(name))
 	}
 
+	p.next()
+
 	// TODO: Allow arguments
-	if !p.consume(TokenOpenParentheses) || !p.consume(TokenCloseParentheses) {
-		return p.errorf(start, "bad function declaration")
+	for _, typ := range []TokenType{TokenOpenParentheses, TokenCloseParentheses} {
+		if tok := p.peek(); tok.Typ != typ {
+			return p.unexpected("bad function declaration: unexpected %s", describe(tok))
+		}
+
+		p.next()
 	}
 
+	body := p.blockStmt()
+
 	return &FuncDecl{
-		Location: start,
+		Location: p.span(start),
 		Name:     name.Value,
-		Body:     p.blockStmt(),
+		Body:     body,
 	}
 }
 
 // ifBranch builds an *IfExpr from the stream. If it fails a *BadExpr will be returned.
 func (p *Parser) ifBranch() Expr {
-	ifKw := p.expect(TokenIf)
-	if ifKw == nil {
-		return p.errorf(nil, "expected an if statement")
+	ifKw := p.next() // if keyword
+	if p.check(TokenOpenCurly) {
+		return p.errorf(ifKw.Loc, "missing condition in if statement")
 	}
 
 	expr := &IfExpr{
@@ -477,59 +784,48 @@ func (p *Parser) ifBranch() Expr {
 		Condition: p.expr(),
 	}
 
-	if !p.check(TokenOpenCurly) {
-		return p.errorf(expr.Location, "expected a code blocks after if statement")
+	if tok := p.peek(); tok.Typ != TokenOpenCurly {
+		return p.unexpected("expected a code block after if condition, found %s", describe(tok))
 	}
 
 	expr.Consequent = p.blockStmt()
 
-	if !p.check(TokenElse) {
-		return expr
+	if p.check(TokenElse) {
+		p.next() // Skip else
+		expr.Else = p.blockStmt()
 	}
 
-	p.next() // Skip else
-	expr.Else = p.blockStmt()
+	expr.Location = p.span(ifKw.Loc)
 	return expr
 }
 
 // blockStmt parses a list of statements. If it fails a *BadExpr will be placed inside the returned slice, but it might
 // have valid Expr inside.
 func (p *Parser) blockStmt() []Expr {
-	if tok := p.expect(TokenOpenCurly); tok == nil {
-		return []Expr{p.errorf(nil, "invalid blocks statement")}
+	if tok := p.peek(); tok.Typ != TokenOpenCurly {
+		return []Expr{p.unexpected("expected a code block, found %s", describe(tok))}
 	}
 
+	p.next() // Skip {
+
 	var exprs []Expr
-	for tok := p.peek(); tok.isValid() && tok.Typ != TokenCloseCurly; tok = p.peek() {
+	for p.more(TokenCloseCurly) {
 		exprs = append(exprs, p.statement())
 	}
 
-	switch closer := p.next(); closer.Typ {
-	case TokenCloseCurly:
-		return exprs
-	case TokenError:
-		return append(exprs, p.errorf(closer.Loc, "invalid blocks statement"))
-	case TokenEOF:
+	if closer := p.next(); closer.Typ != TokenCloseCurly {
 		return append(exprs, p.errorf(closer.Loc, "unclosed blocks statement"))
-	default:
-		return append(exprs, p.errorf(closer.Loc, "unexpected token in blocks statement"))
 	}
+
+	return exprs
 }
 
 // expr parses an expression using recursive decent. The expression might be a *BadExpr if a invalid token is found.
 func (p *Parser) expr() Expr {
-	expr := p.additiveExpr()
-
-	id, ok := expr.(*Identifier)
-	if ok {
-		tok := p.peek()
-		if tok.Typ == TokenDeclaration {
-			return p.varDeclExpr(id)
-		}
+	expr := p.booleanExpr()
 
-		if tok.Typ == TokenOpenParentheses {
-			return p.funcCall(id)
-		}
+	if id, ok := expr.(*Identifier); ok && p.check(TokenDeclaration) {
+		return p.varDeclExpr(id)
 	}
 
 	return expr
@@ -544,21 +840,23 @@ func (p *Parser) varDeclExpr(id *Identifier) Expr {
 
 	p.next() // Skip :=
 
+	value := p.expr()
+
 	return &VariableDecl{
-		Name:  id.Name,
-		Value: p.expr(),
+		Location: p.span(id.Location),
+		Name:     id.Name,
+		Value:    value,
 	}
 }
 
-// funcCall will try to parse a function call (*FuncCall). If an invalid token is found a *BadExpr will be returned
+// funcCall will try to parse a function call (*FuncCall). If the called identifier is a basic type, the call is a type
+// conversion and a *ConversionExpr is returned instead. If an invalid token is found a *BadExpr will be returned
 // containing an error description.
 func (p *Parser) funcCall(id *Identifier) Expr {
-	if !p.consume(TokenOpenParentheses) {
-		return p.errorf(nil, "bad function call")
-	}
+	p.next() // Skip (
 
 	var args []Expr
-	for tok := p.peek(); tok.isValid() && tok.Typ != TokenCloseParentheses; tok = p.peek() {
+	for tok := p.peek(); tok.Typ != TokenEOF && tok.Typ != TokenCloseParentheses; tok = p.peek() {
 		args = append(args, p.expr())
 
 		if !p.check(TokenComma) {
@@ -568,29 +866,72 @@ func (p *Parser) funcCall(id *Identifier) Expr {
 		p.next() // Skip the comma
 	}
 
-	if !p.consume(TokenCloseParentheses) {
-		return p.errorf(nil, "bad function call")
+	if tok := p.peek(); tok.Typ != TokenCloseParentheses {
+		// A bad argument, such as an unclosed string, is likely why the call isn't closed
+		for _, arg := range args {
+			if bad, isBad := arg.(*BadExpr); isBad {
+				return bad
+			}
+		}
+
+		return p.unexpected("bad function call: expected ',' or ')', found %s", describe(tok))
+	}
+
+	p.next() // Skip )
+
+	loc := p.span(id.Location)
+	if isBasicType(id.Name) {
+		if len(args) != 1 {
+			return p.errorf(loc, "conversion to %s expects exactly one argument, got %d", id.Name, len(args))
+		}
+
+		return &ConversionExpr{
+			Location: loc,
+			Type:     id.Name,
+			Value:    args[0],
+		}
 	}
 
 	return &FuncCall{
-		Name: id.Name,
-		Args: args,
+		Location: loc,
+		Name:     id.Name,
+		Args:     args,
 	}
 }
 
-// additiveExpr will parse an additive expression if found, or decent otherwise
-func (p *Parser) additiveExpr() Expr {
-	lhs := p.multiplicativeExpr()
+// additiveOperators holds the tokens of the operators that share precedence with the addition
+var additiveOperators = map[TokenType]bool{
+	TokenPlus:   true,
+	TokenMinus:  true,
+	TokenBitOr:  true,
+	TokenBitXor: true,
+}
+
+// multiplicativeOperators holds the tokens of the operators that share precedence with the multiplication
+var multiplicativeOperators = map[TokenType]bool{
+	TokenMulti:      true,
+	TokenDiv:        true,
+	TokenModulo:     true,
+	TokenBitAnd:     true,
+	TokenBitClear:   true,
+	TokenShiftLeft:  true,
+	TokenShiftRight: true,
+}
+
+// booleanExpr will parse a boolean expression if found, or decent otherwise
+func (p *Parser) booleanExpr() Expr {
+	start := p.peek().Loc
+	lhs := p.additiveExpr()
 
 	for true {
-		if tok := p.peek(); tok.Typ == TokenPlus || tok.Typ == TokenMinus {
-			// Chained operands (for example 1 * 3 + 1). Go over the operand and nest
+		if tok := p.peek(); tok.Typ == TokenBooleanEquals {
+			// Chained operands (for example 1 == 3 == 1). Go over the operand and nest
 			p.next()
 
 			rhs := p.additiveExpr()
-			lhs = &BinaryExpr{
-				Location:  tok.Loc,
-				Operation: BinaryOp(tok.Value),
+			lhs = &BooleanExpr{
+				Location:  p.span(start),
+				Operation: BooleanOp(tok.Value),
 				Op1:       lhs,
 				Op2:       rhs,
 			}
@@ -604,18 +945,19 @@ func (p *Parser) additiveExpr() Expr {
 	return lhs // Unreachable
 }
 
-// multiplicativeExpr will parse a multiplicative expression if found, or decent otherwise
-func (p *Parser) multiplicativeExpr() Expr {
-	lhs := p.booleanExpr()
+// additiveExpr will parse an additive expression if found, or decent otherwise
+func (p *Parser) additiveExpr() Expr {
+	start := p.peek().Loc
+	lhs := p.multiplicativeExpr()
 
 	for true {
-		if tok := p.peek(); tok.Typ == TokenMulti || tok.Typ == TokenDiv {
-			// Chained operands (for example 1 / 3 * 1). Go over the operand and nest
+		if tok := p.peek(); additiveOperators[tok.Typ] {
+			// Chained operands (for example 1 - 3 + 1) are nested from the left
 			p.next()
 
 			rhs := p.multiplicativeExpr()
 			lhs = &BinaryExpr{
-				Location:  lhs.GetLocation(),
+				Location:  p.span(start),
 				Operation: BinaryOp(tok.Value),
 				Op1:       lhs,
 				Op2:       rhs,
@@ -630,19 +972,20 @@ func (p *Parser) multiplicativeExpr() Expr {
 	return lhs // Unreachable
 }
 
-// booleanExpr will parse a boolean expression if found, or decent otherwise
-func (p *Parser) booleanExpr() Expr {
+// multiplicativeExpr will parse a multiplicative expression if found, or decent otherwise
+func (p *Parser) multiplicativeExpr() Expr {
+	start := p.peek().Loc
 	lhs := p.unaryExpr()
 
 	for true {
-		if tok := p.peek(); tok.Typ == TokenBooleanEquals {
-			// Chained operands (for example 1 == 3 == 1). Go over the operand and nest
+		if tok := p.peek(); multiplicativeOperators[tok.Typ] {
+			// Chained operands (for example 1 / 3 * 1) are nested from the left
 			p.next()
 
-			rhs := p.booleanExpr()
-			lhs = &BooleanExpr{
-				Location:  lhs.GetLocation(),
-				Operation: BooleanOp(tok.Value),
+			rhs := p.unaryExpr()
+			lhs = &BinaryExpr{
+				Location:  p.span(start),
+				Operation: BinaryOp(tok.Value),
 				Op1:       lhs,
 				Op2:       rhs,
 			}
@@ -658,27 +1001,33 @@ func (p *Parser) booleanExpr() Expr {
 
 // unaryExpr will parse a unary expression if found, or decent otherwise
 func (p *Parser) unaryExpr() Expr {
-	if p.check(TokenMinus) { // Unary negative
+	if p.check(TokenMinus) || p.check(TokenBitXor) { // Unary negative or bitwise not
 		tok := p.next()
+		operand := p.unaryExpr()
 
 		return &UnaryExpr{
-			Location:  tok.Loc,
-			Operation: UnaryNegative,
-			Operand:   p.primary(),
+			Location:  p.span(tok.Loc),
+			Operation: UnaryOp(tok.Value),
+			Operand:   operand,
 		}
 	}
 
 	return p.primary()
 }
 
-// primary will parse a primary expression if found, or decent otherwise. Primary expressions are identifiers, literals,
-// or parenthesised expressions.
+// primary will parse a primary expression if found, or decent otherwise. Primary expressions are identifiers, function
+// calls, literals, or parenthesised expressions.
 func (p *Parser) primary() Expr {
 	switch tok := p.peek(); tok.Typ {
 	case TokenOpenParentheses:
 		return p.parenthesisedExpression()
 	case TokenIdentifier:
-		return p.identifier()
+		id := p.identifier()
+		if p.check(TokenOpenParentheses) {
+			return p.funcCall(id.(*Identifier))
+		}
+
+		return id
 	}
 
 	return p.literal()
@@ -687,16 +1036,16 @@ func (p *Parser) primary() Expr {
 // parenthesisedExpression unwraps a parenthesised expression and returns the contained expression. If the expression
 // is not correctly parenthesised, a *BadExpr will be returned.
 func (p *Parser) parenthesisedExpression() Expr {
-	if tok := p.next(); tok.Typ != TokenOpenParentheses {
-		return p.errorf(tok.Loc, "expected opening parenthesis")
-	}
+	p.next() // Skip (
 
 	exp := p.expr()
 
-	if tok := p.next(); tok.Typ != TokenCloseParentheses {
-		return p.errorf(tok.Loc, "expected closing parenthesis")
+	if tok := p.peek(); tok.Typ != TokenCloseParentheses {
+		return p.unexpected("expected closing parenthesis, found %s", describe(tok))
 	}
 
+	p.next() // Skip )
+
 	return exp
 }
 
@@ -730,8 +1079,57 @@ func (p *Parser) literal() Expr {
 			Typ:      LiteralString,
 			Value:    p.next().Value,
 		}
+	case TokenStringHead:
+		return p.interpolation()
+	case TokenRune:
+		return &LiteralExpr{
+			Location: tok.Loc,
+			Typ:      LiteralRune,
+			Value:    p.next().Value,
+		}
+	case TokenError:
+		// The lexer already recovered from the error, so there's no need to synchronize
+		p.next()
+		return &BadExpr{
+			Location: tok.Loc,
+			Error:    tok.Value,
+		}
+	case TokenCloseParentheses, TokenOpenCurly, TokenCloseCurly, TokenEOF, TokenStringMiddle, TokenStringTail,
+		TokenFormatSpec:
+		// Delimiters are left in the stream for the enclosing construct
+		return p.errorf(tok.Loc, "unexpected %s, expected an expression", describe(tok))
 	default:
 		p.next() // Skip errored token
-		return p.errorf(tok.Loc, "invalid symbol '%s'", tok.Value)
+		return p.errorf(tok.Loc, "unexpected %s, expected an expression", describe(tok))
+	}
+}
+
+// interpolation parses a string with embedded expressions (*InterpolationExpr). The lexer emits the text before the
+// first expression as a [TokenStringHead], and every expression is followed by an optional [TokenFormatSpec], and the
+// text after it: a [TokenStringMiddle] if more expressions follow, or a [TokenStringTail].
+func (p *Parser) interpolation() Expr {
+	head := p.next()
+
+	expr := &InterpolationExpr{Texts: []string{head.Value}}
+	for {
+		value := &Interpolation{Value: p.expr()}
+		if tok := p.peek(); tok.Typ == TokenFormatSpec {
+			p.next()
+			value.Format, value.FormatLoc = tok.Value, tok.Loc
+		}
+
+		expr.Values = append(expr.Values, value)
+
+		switch tok := p.peek(); tok.Typ {
+		case TokenStringMiddle:
+			expr.Texts = append(expr.Texts, p.next().Value)
+		case TokenStringTail:
+			expr.Texts = append(expr.Texts, p.next().Value)
+			expr.Location = p.span(head.Loc)
+
+			return expr
+		default:
+			return p.unexpected("bad string: expected '}' after the embedded expression, found %s", describe(tok))
+		}
 	}
 }
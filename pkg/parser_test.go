@@ -1,6 +1,7 @@
 package maqui
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -89,6 +90,169 @@ func TestParser(t *testing.T) {
 				},
 			},
 		},
+		{
+			"FunctionDocComment",
+			[]Token{
+				{TokenLineComment, " license header", nil},
+				{TokenDocComment, " main is the entry point", nil},
+				{TokenDocComment, " of the program", nil},
+				{TokenFunc, "func", nil},
+				{TokenIdentifier, "main", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenOpenCurly, "{", nil},
+				{TokenCloseCurly, "}", nil},
+			},
+			false,
+			[]Expr{
+				&FuncDecl{
+					Name: "main",
+					Body: nil,
+					Doc:  "main is the entry point\nof the program",
+				},
+			},
+		},
+		{
+			"GlobalDocComment",
+			[]Token{
+				{TokenDocComment, " answer to everything", nil},
+				{TokenIdentifier, "answer", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "42", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenLineComment, " not a doc comment", nil},
+				{TokenIdentifier, "other", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+			},
+			false,
+			[]Expr{
+				&VariableDecl{
+					Name:  "answer",
+					Value: &LiteralExpr{Typ: LiteralNumber, Value: "42"},
+					Doc:   "answer to everything",
+				},
+				&VariableDecl{
+					Name:  "other",
+					Value: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				},
+			},
+		},
+		{
+			"NewlineTerminatesStatement",
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenMinus, "-", nil},
+				{TokenNumber, "2", nil},
+				{TokenSemicolon, "\n", nil},
+			},
+			false,
+			[]Expr{
+				&VariableDecl{
+					Name:  "x",
+					Value: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				},
+				&UnaryExpr{
+					Operation: UnaryNegative,
+					Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
+			},
+		},
+		{
+			"EmptyStatements",
+			[]Token{
+				{TokenSemicolon, ";", nil},
+				{TokenFunc, "func", nil},
+				{TokenIdentifier, "main", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenOpenCurly, "{", nil},
+				{TokenSemicolon, ";", nil},
+				{TokenSemicolon, ";", nil},
+				{TokenCloseCurly, "}", nil},
+				{TokenSemicolon, "\n", nil},
+			},
+			false,
+			[]Expr{
+				&FuncDecl{Name: "main"},
+			},
+		},
+		{
+			"MissingTerminator",
+			[]Token{
+				{TokenIdentifier, "x", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+				{TokenIdentifier, "x", nil},
+			},
+			false,
+			[]Expr{
+				&BadExpr{Error: "unexpected 'x' after expression; expected newline"},
+			},
+		},
+		{
+			"MisspelledKeyword",
+			[]Token{
+				{TokenIdentifier, "fucn", nil},
+				{TokenIdentifier, "main", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenSemicolon, "\n", nil},
+			},
+			false,
+			[]Expr{
+				&BadExpr{Error: "unexpected name 'fucn', expected a statement", Suggestion: "func"},
+			},
+		},
+		{
+			"MisspelledKeywordAfterExpression",
+			[]Token{
+				{TokenIf, "if", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenOpenCurly, "{", nil},
+				{TokenCloseCurly, "}", nil},
+				{TokenIdentifier, "esle", nil},
+				{TokenOpenCurly, "{", nil},
+				{TokenCloseCurly, "}", nil},
+			},
+			false,
+			[]Expr{
+				&BadExpr{Error: "unexpected 'esle' after expression", Suggestion: "else"},
+			},
+		},
+		{
+			"LexerErrorInsideBlock",
+			[]Token{
+				{TokenFunc, "func", nil},
+				{TokenIdentifier, "main", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenOpenCurly, "{", nil},
+				{TokenError, "invalid symbol '@'", nil},
+				{TokenSemicolon, "\n", nil},
+				{TokenIdentifier, "print", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenNumber, "1", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenCloseCurly, "}", nil},
+			},
+			false,
+			[]Expr{
+				&FuncDecl{
+					Name: "main",
+					Body: []Expr{
+						&BadExpr{Error: "invalid symbol '@'"},
+						&FuncCall{
+							Name: "print",
+							Args: []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "1"}},
+						},
+					},
+				},
+			},
+		},
 		{
 			"UnicodeIdentifier",
 			[]Token{
@@ -135,6 +299,52 @@ func TestParser(t *testing.T) {
 				},
 			},
 		},
+		{
+			"Interpolation",
+			[]Token{
+				{TokenIdentifier, "s", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenStringHead, "x = ", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenFormatSpec, "08x", nil},
+				{TokenStringMiddle, ", sum = ", nil},
+				{TokenIdentifier, "a", nil},
+				{TokenPlus, "+", nil},
+				{TokenNumber, "1", nil},
+				{TokenStringTail, "!", nil},
+			},
+			false,
+			[]Expr{
+				&VariableDecl{
+					Name: "s",
+					Value: &InterpolationExpr{
+						Texts: []string{"x = ", ", sum = ", "!"},
+						Values: []*Interpolation{
+							{Value: &Identifier{Name: "x"}, Format: "08x"},
+							{Value: &BinaryExpr{
+								Operation: BinaryAddition,
+								Op1:       &Identifier{Name: "a"},
+								Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+							}},
+						},
+					},
+				},
+			},
+		},
+		{
+			"EmptyInterpolation",
+			[]Token{
+				{TokenStringHead, "x = ", nil},
+				{TokenStringTail, "", nil},
+			},
+			false,
+			[]Expr{
+				&InterpolationExpr{
+					Texts:  []string{"x = ", ""},
+					Values: []*Interpolation{{Value: &BadExpr{Error: "unexpected '}', expected an expression"}}},
+				},
+			},
+		},
 		{
 			"FunctionCall",
 			[]Token{
@@ -300,6 +510,7 @@ func TestParser(t *testing.T) {
 				{TokenNumber, "2", nil},
 				{TokenMinus, "-", nil},
 				{TokenNumber, "3", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenNumber, "2", nil},
 				{TokenPlus, "+", nil},
 				{TokenNumber, "3", nil},
@@ -309,6 +520,7 @@ func TestParser(t *testing.T) {
 				{TokenNumber, "1", nil},
 				{TokenMinus, "-", nil},
 				{TokenNumber, "2", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenNumber, "1", nil},
 				{TokenPlus, "+", nil},
 				{TokenNumber, "2", nil},
@@ -360,6 +572,7 @@ func TestParser(t *testing.T) {
 				{TokenNumber, "2", nil},
 				{TokenMinus, "-", nil},
 				{TokenNumber, "3", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenNumber, "2", nil},
 				{TokenPlus, "+", nil},
 				{TokenNumber, "3", nil},
@@ -436,10 +649,12 @@ func TestParser(t *testing.T) {
 				{TokenNumber, "2", nil},
 				{TokenMinus, "-", nil},
 				{TokenNumber, "3", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenNumber, "2", nil},
 				{TokenPlus, "+", nil},
 				{TokenNumber, "3", nil},
 				{TokenCloseCurly, "}", nil},
+				{TokenSemicolon, "\n", nil},
 				{TokenIdentifier, "print", nil},
 				{TokenOpenParentheses, "(", nil},
 				{TokenNumber, "1", nil},
@@ -494,6 +709,110 @@ func TestParser(t *testing.T) {
 				},
 			},
 		},
+		{
+			"Conversion",
+			[]Token{
+				{TokenIdentifier, "float64", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenIdentifier, "x", nil},
+				{TokenCloseParentheses, ")", nil},
+				{TokenMulti, "*", nil},
+				{TokenNumber, "1.5", nil},
+			},
+			false,
+			[]Expr{
+				&BinaryExpr{
+					Operation: BinaryMultiplication,
+					Op1: &ConversionExpr{
+						Type:  "float64",
+						Value: &Identifier{Name: "x"},
+					},
+					Op2: &LiteralExpr{Typ: LiteralNumber, Value: "1.5"},
+				},
+			},
+		},
+		{
+			"ConversionTooManyArguments",
+			[]Token{
+				{TokenIdentifier, "uint8", nil},
+				{TokenOpenParentheses, "(", nil},
+				{TokenNumber, "1", nil},
+				{TokenComma, ",", nil},
+				{TokenNumber, "2", nil},
+				{TokenCloseParentheses, ")", nil},
+			},
+			true,
+			nil,
+		},
+		{
+			"RuneLiteral",
+			[]Token{
+				{TokenIdentifier, "r", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenRune, "a", nil},
+			},
+			false,
+			[]Expr{
+				&VariableDecl{
+					Name:  "r",
+					Value: &LiteralExpr{Typ: LiteralRune, Value: "a"},
+				},
+			},
+		},
+		{
+			"LeftAssociative",
+			[]Token{
+				{TokenNumber, "1", nil},
+				{TokenMinus, "-", nil},
+				{TokenNumber, "2", nil},
+				{TokenMinus, "-", nil},
+				{TokenNumber, "3", nil},
+			},
+			false,
+			[]Expr{
+				&BinaryExpr{
+					Operation: BinarySubtraction,
+					Op1: &BinaryExpr{
+						Operation: BinarySubtraction,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+					},
+					Op2: &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+				},
+			},
+		},
+		{
+			"BitwisePrecedence",
+			[]Token{
+				{TokenIdentifier, "a", nil},
+				{TokenBitOr, "|", nil},
+				{TokenIdentifier, "b", nil},
+				{TokenShiftLeft, "<<", nil},
+				{TokenNumber, "2", nil},
+				{TokenBooleanEquals, "==", nil},
+				{TokenBitXor, "^", nil},
+				{TokenIdentifier, "c", nil},
+			},
+			false,
+			[]Expr{
+				&BooleanExpr{
+					Operation: BooleanEquals,
+					Op1: &BinaryExpr{
+						Operation: BinaryOr,
+						Op1:       &Identifier{Name: "a"},
+						Op2: &BinaryExpr{
+							Operation: BinaryShiftLeft,
+							Op1:       &Identifier{Name: "b"},
+							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						},
+					},
+					Op2: &UnaryExpr{
+						Operation: UnaryBitwiseNot,
+						Operand:   &Identifier{Name: "c"},
+					},
+				},
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -530,3 +849,104 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParserRecovery(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		expect int
+		// first is the message of the first error, if it's checked
+		first string
+	}{
+		{
+			name:   "SingleError",
+			data:   "func a() {\n    print(1 +)\n}\n",
+			expect: 1,
+		},
+		{
+			name: "ErrorsInSeparateFunctions",
+			data: "func a() {\n    print(1 +)\n}\n" +
+				"func b() {\n    print((2)\n}\n" +
+				"func c() {\n    print(3)\n}\n",
+			expect: 2,
+		},
+		{
+			name:   "ErrorsInsideNestedBlocks",
+			data:   "func a() {\n    print(3 @)\n    if 1 == {\n        print(4)\n    }\n}\n",
+			expect: 2,
+		},
+		{
+			name:   "ErrorInDeclaration",
+			data:   "func (d) {\n    print(5)\n}\nfunc e() {\n    if {\n        print(6)\n    } else {\n        print(7)\n    }\n}\n",
+			expect: 2,
+		},
+		{
+			name:   "ErrorsInConsecutiveLines",
+			data:   "func a() {\n    x := 1 2\n    print(3 4)\n    print((5\n    print(6)\n}\n",
+			expect: 3,
+		},
+		{
+			name:   "LexerAndParserErrors",
+			data:   "func a() {\n    print(\"unclosed)\n}\nfunc b() {\n    print(1 +)\n}\n",
+			expect: 2,
+		},
+		{
+			name:   "LexerErrorInArguments",
+			data:   "func a() {\n    print(\"abc) }\n}\n",
+			expect: 1,
+			first:  "bad expression: unclosed string: abc) }",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := NewParser(NewLexerFromReader(strings.NewReader(c.data)))
+			analyzer := NewContextAnalyser(p)
+
+			global := NewGlobalSymbolTable()
+			analyzer.DefineInto(global)
+			ast := analyzer.Do(global)
+
+			assert.Len(t, ast.Errors, c.expect, "%v", ast.Errors)
+			if c.first != "" && len(ast.Errors) > 0 {
+				assert.Equal(t, c.first, ast.Errors[0].Diagnostic().Message)
+			}
+
+			for _, err := range ast.Errors {
+				if bad, ok := err.(*BadExprError); ok {
+					assert.NotNil(t, bad.Loc, "bad expression without location: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestParserLocation(t *testing.T) {
+	data := "func main() {\n    x := -a + b * 2\n    print(x, uint8(1))\n}"
+
+	p := NewParser(NewLexerFromReader(strings.NewReader(data)))
+	ast := p.Run()
+
+	span := func(e Expr) string {
+		loc := e.GetLocation()
+		return data[loc.Start:loc.End]
+	}
+
+	fn := ast.Statements[0].Expr.(*FuncDecl)
+	assert.Equal(t, data, span(fn))
+	assert.Equal(t, &Location{Start: 0, End: 58, Line: 1, Col: 1, EndLine: 4, EndCol: 2}, fn.Location)
+
+	decl := fn.Body[0].(*VariableDecl)
+	assert.Equal(t, "x := -a + b * 2", span(decl))
+	assert.Equal(t, uint64(2), decl.Location.Line)
+	assert.Equal(t, uint64(5), decl.Location.Col)
+
+	sum := decl.Value.(*BinaryExpr)
+	assert.Equal(t, "-a + b * 2", span(sum))
+	assert.Equal(t, "-a", span(sum.Op1))
+	assert.Equal(t, "b * 2", span(sum.Op2))
+
+	call := fn.Body[1].(*FuncCall)
+	assert.Equal(t, "print(x, uint8(1))", span(call))
+	assert.Equal(t, "uint8(1)", span(call.Args[1]))
+}
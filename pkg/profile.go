@@ -0,0 +1,133 @@
+package maqui
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OptLevel is how much the toolchain optimizes the generated code, as in the -O flags of clang
+type OptLevel string
+
+const (
+	// O0 disables the optimizations
+	O0 OptLevel = "0"
+	O1 OptLevel = "1"
+	O2 OptLevel = "2"
+	// O3 enables the optimizations that make the code faster at the cost of its size
+	O3 OptLevel = "3"
+	// Os optimizes like O2, but avoids the optimizations that make the code bigger
+	Os OptLevel = "s"
+)
+
+// OptLevels holds all the supported optimization levels
+var OptLevels = []OptLevel{O0, O1, O2, O3, Os}
+
+// ParseOptLevel parses an optimization level, with or without the -O prefix, as in 2 or -O2
+func ParseOptLevel(s string) (OptLevel, error) {
+	level := OptLevel(strings.TrimPrefix(s, "-O"))
+	for _, l := range OptLevels {
+		if l == level {
+			return l, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown optimization level %q, expected one of %v", s, OptLevels)
+}
+
+// flag returns the flag that sets the optimization level in clang
+func (o OptLevel) flag() string {
+	return "-O" + string(o)
+}
+
+// llcFlag returns the flag that sets the optimization level in llc, which has no level for size. Os is built as O2,
+// which is what it means for the code generation.
+func (o OptLevel) llcFlag() string {
+	if o == Os {
+		return O2.flag()
+	}
+
+	return o.flag()
+}
+
+// Overflow is what happens when integer arithmetic overflows its type
+type Overflow string
+
+const (
+	// OverflowWrap wraps around the results, keeping their low bits as in two's complement
+	OverflowWrap Overflow = "wrap"
+	// OverflowTrap stops the program with a trap instruction, which is cheaper than a check but has no message
+	OverflowTrap Overflow = "trap"
+	// OverflowCheck panics at the operation that overflows
+	OverflowCheck Overflow = "check"
+)
+
+// Overflows holds all the supported overflow modes
+var Overflows = []Overflow{OverflowWrap, OverflowTrap, OverflowCheck}
+
+// ParseOverflow parses an overflow mode
+func ParseOverflow(s string) (Overflow, error) {
+	for _, o := range Overflows {
+		if o == Overflow(s) {
+			return o, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown overflow mode %q, expected one of %v", s, Overflows)
+}
+
+// Profile is a named set of build settings. Profiles trade the safety and debuggability of the program for its speed
+// and size.
+type Profile struct {
+	Name string
+	// Opt is the optimization level of the build
+	Opt OptLevel
+	// Checks adds runtime safety checks, such as integer divisions by zero, and records the calls for the stack traces
+	// of the panics. Failed checks panic at the code that failed.
+	Checks bool
+	// Assertions keeps the calls to assert. Without them, the calls and their arguments are not evaluated.
+	Assertions bool
+	// Overflow is what happens when the integer additions, subtractions, multiplications, divisions and negations
+	// overflow
+	Overflow Overflow
+	// Strip removes the symbols from executables
+	Strip bool
+}
+
+var (
+	// ProfileDebug builds without optimizations and with all the checks. It's the default.
+	ProfileDebug = Profile{Name: "debug", Opt: O0, Checks: true, Assertions: true, Overflow: OverflowCheck}
+	// ProfileRelease builds optimized and stripped executables, without checks or assertions. Integers wrap around.
+	ProfileRelease = Profile{Name: "release", Opt: O2, Overflow: OverflowWrap, Strip: true}
+)
+
+// Profiles holds all the named profiles
+var Profiles = []Profile{ProfileDebug, ProfileRelease}
+
+// ParseProfile returns the profile with the name
+func ParseProfile(name string) (Profile, error) {
+	var names []string
+	for _, p := range Profiles {
+		if p.Name == name {
+			return p, nil
+		}
+
+		names = append(names, p.Name)
+	}
+
+	return Profile{}, fmt.Errorf("unknown profile %q, expected one of %v", name, names)
+}
+
+// String describes all the settings of the profile, as in "release -O2 checks=off assertions=off overflow=wrap
+// strip=on". It's recorded in the built files, so builds can be reproduced.
+func (p Profile) String() string {
+	onOff := func(v bool) string {
+		if v {
+			return "on"
+		}
+
+		return "off"
+	}
+
+	return fmt.Sprintf("%s %s checks=%s assertions=%s overflow=%s strip=%s", p.Name, p.Opt.flag(), onOff(p.Checks),
+		onOff(p.Assertions), p.Overflow, onOff(p.Strip))
+}
@@ -0,0 +1,67 @@
+package maqui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOptLevel(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect OptLevel
+		err    bool
+	}{
+		{"0", O0, false},
+		{"2", O2, false},
+		{"-O3", O3, false},
+		{"s", Os, false},
+		{"4", "", true},
+		{"z", "", true},
+		{"", "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			level, err := ParseOptLevel(c.input)
+			assert.Equal(t, c.err, err != nil, err)
+			assert.Equal(t, c.expect, level)
+		})
+	}
+}
+
+func TestOptLevelFlags(t *testing.T) {
+	assert.Equal(t, "-O3", O3.flag())
+	assert.Equal(t, "-O3", O3.llcFlag())
+	assert.Equal(t, "-Os", Os.flag())
+	assert.Equal(t, "-O2", Os.llcFlag(), "llc has no level for size")
+}
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile("release")
+	assert.NoError(t, err)
+	assert.Equal(t, ProfileRelease, p)
+
+	p, err = ParseProfile("debug")
+	assert.NoError(t, err)
+	assert.Equal(t, ProfileDebug, p)
+
+	_, err = ParseProfile("fast")
+	assert.Error(t, err)
+}
+
+func TestParseOverflow(t *testing.T) {
+	for _, o := range Overflows {
+		parsed, err := ParseOverflow(string(o))
+		assert.NoError(t, err)
+		assert.Equal(t, o, parsed)
+	}
+
+	_, err := ParseOverflow("saturate")
+	assert.Error(t, err)
+}
+
+func TestProfileString(t *testing.T) {
+	assert.Equal(t, "debug -O0 checks=on assertions=on overflow=check strip=off", ProfileDebug.String())
+	assert.Equal(t, "release -O2 checks=off assertions=off overflow=wrap strip=on", ProfileRelease.String())
+}
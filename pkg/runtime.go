@@ -0,0 +1,325 @@
+package maqui
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/llir/llvm/ir"
+	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
+	"github.com/llir/llvm/ir/types"
+	"github.com/llir/llvm/ir/value"
+)
+
+// The runtime library is built once per target and linked into every executable. It holds the built-in functions, the
+// panics and the entry point of the programs. Its functions are registered in builtinFuncs.
+const (
+	// runtimeMain is the symbol of the main function of Maqui programs, which is called by the entry point of the
+	// runtime
+	runtimeMain = runtimePrefix + "main"
+	// runtimeAlloc allocates memory, and panics when there's none left
+	runtimeAlloc = runtimePrefix + "alloc"
+	// runtimePanic writes the panic message and the stack trace to the standard error, and exits the program
+	runtimePanic = runtimePrefix + "panic"
+	// runtimeEnter, runtimeLeave and runtimeCall maintain the stack of calls shown in the panics
+	runtimeEnter = runtimePrefix + "enter"
+	runtimeLeave = runtimePrefix + "leave"
+	runtimeCall  = runtimePrefix + "call"
+)
+
+// The checks are defined in every module instead of the runtime library, so they're inlined and only call the runtime
+// when they fail
+const (
+	// builtinCheck panics when a runtime safety check fails
+	builtinCheck = "._check"
+	// runtimeTrap stops the program with a trap instruction when an integer operation overflows
+	runtimeTrap = "._trap"
+)
+
+// maxTraceFrames is the number of calls recorded for the stack traces. Deeper calls still run, but the innermost ones
+// are left out of the traces.
+const maxTraceFrames = 64
+
+// PanicExitCode is the exit code of programs that panic. It's apart from the exit codes of the maqui command, so the
+// panics of programs run by maqui run can be told apart from its own errors.
+const PanicExitCode = 101
+
+// newRuntime builds the runtime library for the target
+func newRuntime(target Target) *ir.Module {
+	mod := ir.NewModule()
+	mod.SourceFilename = "maqui runtime"
+	mod.TargetTriple = target.String()
+	mod.DataLayout = target.DataLayout()
+
+	for _, f := range builtinFuncs {
+		if f.define != nil {
+			f.define(mod, target.sizes()).SetName(f.symbolName())
+		}
+	}
+
+	runtimeEntryPoint(mod)
+
+	// The data of the runtime is private, so it doesn't collide with the symbols of other object files. The data of the
+	// C library is only declared.
+	for _, g := range mod.Globals {
+		if g.Init != nil {
+			g.Linkage = enum.LinkagePrivate
+		}
+	}
+
+	return mod
+}
+
+// runtimeEntryPoint defines the C entry point of the programs, which calls the main function of Maqui
+func runtimeEntryPoint(mod *ir.Module) {
+	main := mod.NewFunc(runtimeMain, types.I32)
+	entry := mod.NewFunc("main", types.I32,
+		ir.NewParam("argc", types.I32),
+		ir.NewParam("argv", types.NewPointer(types.I8Ptr)),
+	)
+
+	b := entry.NewBlock("")
+	b.NewRet(b.NewCall(main))
+}
+
+// runtimeCacheDir returns the directory where the runtime libraries are cached. It's the MAQUI_CACHE environment
+// variable if set, and otherwise the maqui directory of the user cache.
+func runtimeCacheDir() string {
+	if dir := os.Getenv("MAQUI_CACHE"); dir != "" {
+		return dir
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "maqui")
+}
+
+// callStack is a shadow stack of the Maqui calls, which is kept next to the machine stack when the profile has checks.
+// Every frame holds the name of the function and the location where it called the next frame, so the traces point to
+// the source code without reading the symbols or the debug information of the executable.
+type callStack struct {
+	// funcs and sites hold the function name and the call location of every frame
+	funcs *ir.Global
+	sites *ir.Global
+	// depth is the number of frames, including those deeper than maxTraceFrames
+	depth *ir.Global
+}
+
+// callStackOf returns the call stack of the runtime library, defining it the first time
+func callStackOf(mod *ir.Module) *callStack {
+	global := func(name string, init constant.Constant) *ir.Global {
+		for _, g := range mod.Globals {
+			if g.Name() == name {
+				return g
+			}
+		}
+
+		return mod.NewGlobalDef(name, init)
+	}
+
+	frames := types.NewArray(maxTraceFrames, types.I8Ptr)
+
+	return &callStack{
+		funcs: global("maqui.trace_funcs", constant.NewZeroInitializer(frames)),
+		sites: global("maqui.trace_sites", constant.NewZeroInitializer(frames)),
+		depth: global("maqui.trace_depth", constant.NewInt(types.I32, 0)),
+	}
+}
+
+// frame returns a pointer to the frame i of the array
+func (s *callStack) frame(block *ir.Block, frames *ir.Global, i value.Value) value.Value {
+	return block.NewGetElementPtr(frames.ContentType, frames, constant.NewInt(types.I32, 0), i)
+}
+
+// runtimeEnterFunc pushes a frame for the function with the name
+func runtimeEnterFunc(mod *ir.Module, _ sizes) *ir.Func {
+	s := callStackOf(mod)
+
+	f := mod.NewFunc("", types.Void, ir.NewParam("name", types.I8Ptr))
+	entry, record, done := f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+
+	depth := entry.NewLoad(types.I32, s.depth)
+	entry.NewCondBr(entry.NewICmp(enum.IPredSLT, depth, constant.NewInt(types.I32, maxTraceFrames)), record, done)
+
+	record.NewStore(f.Params[0], s.frame(record, s.funcs, depth))
+	record.NewBr(done)
+
+	done.NewStore(done.NewAdd(depth, constant.NewInt(types.I32, 1)), s.depth)
+	done.NewRet(nil)
+
+	return f
+}
+
+// runtimeLeaveFunc pops the last frame
+func runtimeLeaveFunc(mod *ir.Module, _ sizes) *ir.Func {
+	s := callStackOf(mod)
+
+	f := mod.NewFunc("", types.Void)
+	entry := f.NewBlock("")
+
+	depth := entry.NewLoad(types.I32, s.depth)
+	entry.NewStore(entry.NewSub(depth, constant.NewInt(types.I32, 1)), s.depth)
+	entry.NewRet(nil)
+
+	return f
+}
+
+// runtimeCallFunc records the location where the last frame calls the next function
+func runtimeCallFunc(mod *ir.Module, _ sizes) *ir.Func {
+	s := callStackOf(mod)
+
+	f := mod.NewFunc("", types.Void, ir.NewParam("site", types.I8Ptr))
+	entry, record, done := f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+
+	// The unsigned comparison also skips the calls done outside any frame, where the index wraps around
+	last := entry.NewSub(entry.NewLoad(types.I32, s.depth), constant.NewInt(types.I32, 1))
+	entry.NewCondBr(entry.NewICmp(enum.IPredULT, last, constant.NewInt(types.I32, maxTraceFrames)), record, done)
+
+	record.NewStore(f.Params[0], s.frame(record, s.sites, last))
+	record.NewBr(done)
+
+	done.NewRet(nil)
+
+	return f
+}
+
+// runtimePanicFunc writes "panic: message at site" to the standard error, followed by the stack trace from the
+// innermost call, and exits the program. The site is the location of the code that panics.
+func runtimePanicFunc(mod *ir.Module, _ sizes) *ir.Func {
+	s := callStackOf(mod)
+
+	f := mod.NewFunc("", types.Void, ir.NewParam("message", types.I8Ptr), ir.NewParam("site", types.I8Ptr))
+	f.FuncAttrs = append(f.FuncAttrs, enum.FuncAttrNoReturn)
+
+	entry, header, elided, loop, exit := f.NewBlock(""), f.NewBlock(""), f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+	message, site := f.Params[0], f.Params[1]
+
+	i32 := func(v int64) constant.Constant {
+		return constant.NewInt(types.I32, v)
+	}
+
+	fprintf := externalFunc(mod, "fprintf", types.I32, true,
+		ir.NewParam("stream", types.I8Ptr),
+		ir.NewParam("format", types.I8Ptr),
+	)
+	exitFunc := externalFunc(mod, "exit", types.Void, false, ir.NewParam("status", types.I32))
+
+	stderr := runtimeStderr(mod, entry)
+	entry.NewCall(fprintf, stderr, globalString(mod, "maqui.panic_fmt", "panic: %s at %s\n"), message, site)
+	depth := entry.NewLoad(types.I32, s.depth)
+	entry.NewCondBr(entry.NewICmp(enum.IPredSGT, depth, i32(0)), header, exit)
+
+	// Only the outermost frames are recorded, so the trace marks the missing ones before them
+	header.NewCall(fprintf, stderr, globalString(mod, "maqui.trace_header", "\nstack trace:\n"))
+	deep := header.NewICmp(enum.IPredSGT, depth, i32(maxTraceFrames))
+	start := header.NewSub(header.NewSelect(deep, i32(maxTraceFrames), depth), i32(1))
+	header.NewCondBr(deep, elided, loop)
+
+	elided.NewCall(fprintf, stderr, globalString(mod, "maqui.trace_elided", "\t...\n"))
+	elided.NewBr(loop)
+
+	i := loop.NewPhi(ir.NewIncoming(start, header), ir.NewIncoming(start, elided))
+
+	// The innermost frame is at the panic, and the rest at the call of the next frame
+	top := loop.NewICmp(enum.IPredEQ, i, loop.NewSub(depth, i32(1)))
+	name := loop.NewLoad(types.I8Ptr, s.frame(loop, s.funcs, i))
+	callSite := loop.NewLoad(types.I8Ptr, s.frame(loop, s.sites, i))
+	loop.NewCall(fprintf, stderr, globalString(mod, "maqui.trace_frame", "\t%s at %s\n"), name,
+		loop.NewSelect(top, site, callSite))
+
+	next := loop.NewSub(i, i32(1))
+	i.Incs = append(i.Incs, ir.NewIncoming(next, loop))
+	loop.NewCondBr(loop.NewICmp(enum.IPredSGE, next, i32(0)), loop, exit)
+
+	exit.NewCall(exitFunc, i32(PanicExitCode))
+	exit.NewUnreachable()
+
+	return f
+}
+
+// runtimeStderr returns the standard error stream of C. It's a macro, so the symbol behind it depends on the C library
+// of the target of the module.
+func runtimeStderr(mod *ir.Module, b *ir.Block) value.Value {
+	target, _ := ParseTarget(mod.TargetTriple)
+
+	name := "stderr"
+	switch target.OS {
+	case Windows:
+		iob := externalFunc(mod, "__acrt_iob_func", types.I8Ptr, false, ir.NewParam("index", types.I32))
+		return b.NewCall(iob, constant.NewInt(types.I32, 2))
+	case Darwin:
+		name = "__stderrp"
+	}
+
+	stream := mod.NewGlobal(name, types.I8Ptr)
+	stream.Linkage = enum.LinkageExternal
+
+	return b.NewLoad(types.I8Ptr, stream)
+}
+
+// runtimeAllocFunc allocates the number of bytes, panicking if the memory is exhausted
+func runtimeAllocFunc(mod *ir.Module, s sizes) *ir.Func {
+	f := mod.NewFunc("", types.I8Ptr, ir.NewParam("size", sizeT(s)))
+	entry, fail, done := f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+
+	malloc := externalFunc(mod, "malloc", types.I8Ptr, false, ir.NewParam("size", sizeT(s)))
+	mem := entry.NewCall(malloc, f.Params[0])
+	entry.NewCondBr(entry.NewICmp(enum.IPredEQ, mem, constant.NewNull(types.I8Ptr)), fail, done)
+
+	fail.NewCall(lookupFunc(mod, runtimePanic), globalString(mod, "maqui.alloc_msg", "out of memory"),
+		globalString(mod, "maqui.alloc_site", "runtime"))
+	fail.NewUnreachable()
+
+	done.NewRet(mem)
+
+	return f
+}
+
+// defineChecks defines the checks used by the generated code in the module. They're private to the module.
+func defineChecks(b *LLVMIRBuilder) {
+	define := func(name string, definition funcDefinition) {
+		f := definition(b.mod, b.sizes)
+		f.SetName(name)
+		f.Linkage = enum.LinkageInternal
+		b.values.Set(name, f)
+	}
+
+	define(builtinCheck, builtinCheckFunc)
+	define(runtimeTrap, builtinTrap)
+}
+
+// builtinCheckFunc panics with the message at the site when the condition is false
+func builtinCheckFunc(mod *ir.Module, _ sizes) *ir.Func {
+	f := mod.NewFunc("", types.Void,
+		ir.NewParam("ok", types.I1),
+		ir.NewParam("message", types.I8Ptr),
+		ir.NewParam("site", types.I8Ptr),
+	)
+	entry, pass, fail := f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+
+	entry.NewCondBr(f.Params[0], pass, fail)
+	pass.NewRet(nil)
+
+	fail.NewCall(lookupFunc(mod, runtimePanic), f.Params[1], f.Params[2])
+	fail.NewUnreachable()
+
+	return f
+}
+
+// builtinTrap executes a trap instruction when the condition is true. Unlike panics it writes nothing, and its code is
+// a single instruction once inlined.
+func builtinTrap(mod *ir.Module, _ sizes) *ir.Func {
+	f := mod.NewFunc("", types.Void, ir.NewParam("cond", types.I1))
+	entry, pass, trap := f.NewBlock(""), f.NewBlock(""), f.NewBlock("")
+
+	entry.NewCondBr(f.Params[0], trap, pass)
+	pass.NewRet(nil)
+
+	trap.NewCall(externalFunc(mod, "llvm.trap", types.Void, false))
+	trap.NewUnreachable()
+
+	return f
+}
@@ -0,0 +1,126 @@
+package maqui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallStack(t *testing.T) {
+	source := "func helper() {\n" +
+		"    panic(\"boom\")\n" +
+		"}\n" +
+		"\n" +
+		"func main() {\n" +
+		"    helper()\n" +
+		"}\n"
+
+	cases := []struct {
+		name    string
+		profile Profile
+		traced  bool
+	}{
+		{"Debug", ProfileDebug, true},
+		{"Release", ProfileRelease, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast := analyzeSource(source)
+			if !assert.Empty(t, ast.Errors) {
+				return
+			}
+
+			gen := NewLLVMGenerator(ast)
+			gen.SetProfile(c.profile)
+			out := gen.Do().String()
+
+			// Panics are located in every profile
+			assert.Contains(t, out, `c"<input>:2:5\00"`)
+			assert.Contains(t, out, "call void @maqui.panic(i8* getelementptr")
+
+			traced := []string{
+				`c"helper\00"`,
+				`c"<input>:6:5\00"`,
+				"call void @maqui.enter(i8* getelementptr",
+				"call void @maqui.call(i8* getelementptr",
+				"call void @maqui.leave()",
+			}
+
+			for _, s := range traced {
+				if c.traced {
+					assert.Contains(t, out, s)
+				} else {
+					assert.NotContains(t, out, s)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntimeMessages(t *testing.T) {
+	b := NewLLVMIRBuilder(DefaultTarget)
+
+	// Messages are defined once, however many times they are used
+	assert.Same(t, b.message("integer divide by zero"), b.message("integer divide by zero"))
+	assert.NotSame(t, b.message("integer divide by zero"), b.message("assertion failed"))
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	global := NewGlobalSymbolTable()
+	runtime := newRuntime(DefaultTarget)
+	b := NewLLVMIRBuilder(DefaultTarget)
+
+	for _, f := range builtinFuncs {
+		if f.name != "" {
+			assert.Equal(t, f.typ, global.Get(f.name), f.name)
+		}
+
+		if f.define == nil {
+			continue
+		}
+
+		// The declarations of the generated code match the definitions of the runtime library
+		def := lookupFunc(runtime, f.symbolName())
+		decl := lookupFunc(b.mod, f.symbolName())
+		if assert.NotNil(t, def, f.symbolName()) && assert.NotNil(t, decl, f.symbolName()) {
+			assert.NotEmpty(t, def.Blocks)
+			assert.Empty(t, decl.Blocks)
+			assert.Equal(t, def.Sig.LLString(), decl.Sig.LLString())
+		}
+	}
+}
+
+func TestRuntimeModule(t *testing.T) {
+	out := newRuntime(DefaultTarget).String()
+
+	// The runtime defines the entry point, which calls the main function of Maqui
+	assert.Contains(t, out, "define i32 @main(i32 %argc, i8** %argv)")
+	assert.Contains(t, out, "declare i32 @maqui.main()")
+	assert.Contains(t, out, "@maqui.trace_depth = private global i32 0")
+	assert.NotContains(t, out, "@.str.")
+}
+
+func TestRuntimeStderr(t *testing.T) {
+	cases := []struct {
+		target string
+		expect string
+	}{
+		{"x86_64-unknown-linux", "@stderr = external global i8*"},
+		{"wasm32-unknown-wasi", "@stderr = external global i8*"},
+		{"aarch64-apple-darwin", "@__stderrp = external global i8*"},
+		{"x86_64-pc-windows-msvc", "call i8* @__acrt_iob_func(i32 2)"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			target, err := ParseTarget(c.target)
+			assert.NoError(t, err)
+
+			// Panics are written with fprintf, as dprintf is only found in POSIX systems
+			out := newRuntime(target).String()
+			assert.Contains(t, out, c.expect)
+			assert.NotContains(t, out, "dprintf")
+		})
+	}
+}
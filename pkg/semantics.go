@@ -2,6 +2,8 @@ package maqui
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
 )
 
@@ -36,25 +38,41 @@ type ContextAnalyzer struct {
 	// index holds the current position of the ContextAnalyzer, but will only be used once live is set to false and the
 	// ContextAnalyzer is working offline.
 	index int
+	// locals holds the variables declared inside the function being analyzed. Reads of these variables are checked by
+	// the flow analysis instead of being reported as undefined.
+	locals map[string]bool
+	// target is the platform the code is compiled for, and sizes the size of its basic types
+	target Target
+	sizes  sizes
 }
 
-// NewContextAnalyser creates a *ContextAnalyzer that takes expressions from the parser.
+// NewContextAnalyser creates a *ContextAnalyzer that takes expressions from the parser. The expressions are checked for
+// the DefaultTarget unless SetTarget is called.
 func NewContextAnalyser(parser SyntacticAnalyzer) *ContextAnalyzer {
-	return &ContextAnalyzer{
+	c := &ContextAnalyzer{
 		filename: parser.GetFilename(),
 		parser:   parser,
 		live:     true,
 	}
+
+	c.SetTarget(DefaultTarget)
+	return c
+}
+
+// SetTarget sets the platform the code is compiled for. The size of word sized integers (int and uint) depends on it.
+func (c *ContextAnalyzer) SetTarget(target Target) {
+	c.target = target
+	c.sizes = target.sizes()
 }
 
 // DefineInto does a full but shallow pass over the expressions and brings the file definitions inside the provided scope.
-// It won't delve into nested definitions like functions.
+// It won't delve into nested definitions like functions. Invalid expressions are skipped, and reported later by Do.
 func (c *ContextAnalyzer) DefineInto(scope *SymbolTable) {
 	c.reset()
 
 	for {
 		expr := c.get()
-		if !isValidExpr(expr) {
+		if expr == nil {
 			break
 		}
 
@@ -69,18 +87,20 @@ func (c *ContextAnalyzer) DefineInto(scope *SymbolTable) {
 }
 
 // Do takes in a global symbol table and builds an annotated *AST. It delves into nested definitions and builds the
-// corresponding symbol tables as well.
+// corresponding symbol tables as well. Errors are sorted by their position in the source code.
 func (c *ContextAnalyzer) Do(global *SymbolTable) *AST {
 	c.reset()
 
 	ast := &AST{
 		Global:   global,
 		Filename: c.filename,
+		Target:   c.target,
 	}
 
 	for {
 		expr := c.get()
 		if expr == nil {
+			sortErrors(ast.Errors)
 			return ast
 		}
 
@@ -164,29 +184,31 @@ func (c *ContextAnalyzer) analyze(stab SymbolTable, expr Expr) SymbolTable {
 		return stab
 	case *FuncDecl:
 		c.addFunction(&stab, e)
+
+		flow := newFlowGraph(e.Body)
+		outer := stab.Copy()
+
+		prevLocals := c.locals
+		c.locals = flow.locals
+		defer func() {
+			c.locals = prevLocals
+		}()
+
 		for _, child := range e.Body {
 			stab.Import(c.analyze(stab, child))
 		}
 
+		for _, err := range flow.check(outer) {
+			stab.AddError(err)
+		}
+
 		return stab
 	case *VariableDecl:
 		t := c.resolve(&stab, e.Value)
 		stab.Add(e.Name, t)
 		e.ResolvedType = t
 	case *FuncCall:
-		if stab.Get(e.Name) == nil {
-			stab.AddError(&UndefinedError{
-				Loc:  e.GetLocation(),
-				Name: e.Name,
-			})
-
-			break
-		}
-
-		for _, arg := range e.Args {
-			e.ResolvedTypes = append(e.ResolvedTypes, c.resolve(&stab, arg))
-			// TODO See if arguments match
-		}
+		c.call(&stab, e)
 
 	case *IfExpr:
 		// TODO: Check if the condition is evaluable
@@ -203,16 +225,22 @@ func (c *ContextAnalyzer) analyze(stab SymbolTable, expr Expr) SymbolTable {
 
 	case *Identifier:
 		if stab.Get(e.Name) == nil {
-			stab.AddError(&UndefinedError{
-				Loc:  e.GetLocation(),
-				Name: e.Name,
-			})
+			c.undefined(&stab, e.GetLocation(), e.Name)
 		}
 	case *BinaryExpr:
 		c.resolve(&stab, e)
 
+	case *BooleanExpr:
+		c.resolve(&stab, e)
+
 	case *UnaryExpr:
 		c.resolve(&stab, e)
+
+	case *ConversionExpr:
+		c.resolve(&stab, e)
+
+	case *InterpolationExpr:
+		c.resolve(&stab, e)
 	}
 
 	return stab
@@ -234,49 +262,69 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 			return t
 		}
 
-		stab.AddError(&UndefinedError{
-			Loc:  e.GetLocation(),
-			Name: e.Name,
-		})
-
+		c.undefined(stab, e.GetLocation(), e.Name)
 		return &TypeErr{TypeErrUndefined}
 	case *BinaryExpr:
-		t1 := c.resolve(stab, e.Op1)
-		t2 := c.resolve(stab, e.Op2)
-
-		if c.isErrorType(t1) {
-			// Error already logged by the type resolution
-			return t1
+		if e.Operation == BinaryShiftLeft || e.Operation == BinaryShiftRight {
+			return c.shift(stab, e)
 		}
 
-		if c.isErrorType(t2) {
+		t := c.resolveOperands(stab, e.GetLocation(), e.Op1, e.Op2)
+		e.ResolvedType = t
+
+		if c.isErrorType(t) {
 			// Error already logged by the type resolution
-			return t2
+			return t
 		}
 
-		if !t1.Equals(t2) {
-			stab.AddError(&IncompatibleTypesError{
-				Loc:   e.GetLocation(),
-				Type1: t1,
-				Type2: t2,
+		if !c.isOpDefined(t, e.Operation) {
+			stab.AddError(&UndefinedOperationError{
+				Loc:  e.GetLocation(),
+				Type: t,
+				Op:   e.Operation,
 			})
 
-			return &TypeErr{TypeErrIncompatible}
+			return &TypeErr{TypeErrBadOp}
 		}
 
-		if !c.isOpDefined(t1, e.Operation) {
-			stab.AddError(&UndefinedOperationError{
-				Loc:  e.GetLocation(),
-				Type: t1,
-				Op:   e.Operation,
+		isDivision := e.Operation == BinaryDivision || e.Operation == BinaryModulo
+		if v, isConst := evalConstant(e.Op2, c.sizes); isConst && v.isZero() && isDivision {
+			stab.AddError(&DivisionByZeroError{
+				Loc: e.Op2.GetLocation(),
 			})
 
 			return &TypeErr{TypeErrBadOp}
 		}
 
-		return t1
+		if v, isConst := evalConstant(e, c.sizes); isConst && !c.fits(stab, e.GetLocation(), v, t.(*BasicType)) {
+			return &TypeErr{TypeErrOverflow}
+		}
+
+		return t
+	case *BooleanExpr:
+		t := c.resolveOperands(stab, e.GetLocation(), e.Op1, e.Op2)
+		e.ResolvedType = t
+
+		if c.isErrorType(t) {
+			// Error already logged by the type resolution
+			return t
+		}
+
+		return &BasicType{"bool"}
 	case *UnaryExpr:
-		if t, isBasicType := c.resolve(stab, e.Operand).(*BasicType); isBasicType && t.Typ != "int" {
+		if v, isConst := evalConstant(e, c.sizes); isConst && v.typ == nil {
+			return c.resolveAs(stab, e, nil)
+		}
+
+		t := c.resolve(stab, e.Operand)
+		e.ResolvedType = t
+
+		if c.isErrorType(t) {
+			// Error already logged by the type resolution
+			return t
+		}
+
+		if !isNumeric(t) || (e.Operation == UnaryBitwiseNot && !isInteger(t)) {
 			stab.AddError(&UndefinedUnitaryError{
 				Loc:  e.GetLocation(),
 				Type: t,
@@ -284,16 +332,36 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 			})
 
 			return &TypeErr{TypeErrBadOp}
-		} else {
-			return t
 		}
 
+		return t
+	case *ConversionExpr:
+		return c.conversion(stab, e)
+	case *InterpolationExpr:
+		return c.interpolation(stab, e)
+	case *FuncCall:
+		f := c.call(stab, e)
+		if f == nil {
+			// Error already logged by the call resolution
+			return &TypeErr{TypeErrUndefined}
+		}
+
+		if len(f.Returns) == 0 {
+			stab.AddError(&NoValueError{
+				Loc:  e.GetLocation(),
+				Name: e.Name,
+			})
+
+			return &TypeErr{TypeErrNoValue}
+		}
+
+		return f.Returns[0]
 	case *LiteralExpr:
 		switch e.Typ {
 		case LiteralString:
 			return &BasicType{"string"}
-		case LiteralNumber:
-			return &BasicType{"int"}
+		case LiteralNumber, LiteralRune:
+			return c.resolveAs(stab, e, nil)
 		default:
 			return &TypeErr{"unimplemented"} // TODO Log error
 		}
@@ -302,6 +370,425 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 	return &TypeErr{"unknown"}
 }
 
+// resolveAs resolves the type of an expression, giving untyped constants the type of the hint when the hint is numeric.
+// Untyped constants without a numeric hint take their default type (int or float64). If the constant doesn't fit in
+// the chosen type an error is added to the symbol table. Any other expression is resolved normally.
+func (c *ContextAnalyzer) resolveAs(stab *SymbolTable, expr Expr, hint Type) Type {
+	v, isConst := evalConstant(expr, c.sizes)
+	if !isConst || v.typ != nil {
+		return c.resolve(stab, expr)
+	}
+
+	t := v.defaultType()
+	if h, isBasic := hint.(*BasicType); isBasic && isNumeric(h) {
+		t = h
+	}
+
+	if !c.fits(stab, expr.GetLocation(), v, t) {
+		return &TypeErr{TypeErrOverflow}
+	}
+
+	annotateConstant(expr, t)
+	return t
+}
+
+// resolveOperands resolves the type of both operands of a binary operation, and returns the type they share. Untyped
+// constants take the type of the other operand. If the types differ an error is added to the symbol table.
+func (c *ContextAnalyzer) resolveOperands(stab *SymbolTable, loc *Location, op1 Expr, op2 Expr) Type {
+	v1, isConst1 := evalConstant(op1, c.sizes)
+	v2, isConst2 := evalConstant(op2, c.sizes)
+
+	untyped1 := isConst1 && v1.typ == nil
+	untyped2 := isConst2 && v2.typ == nil
+
+	var t1, t2 Type
+	switch {
+	case untyped1 && untyped2:
+		// The kind of the constant that ranks higher (float, then rune, then int) picks the type
+		t := v1.defaultType()
+		if v2.float || (v2.rune && !v1.float) {
+			t = v2.defaultType()
+		}
+
+		t1 = c.resolveAs(stab, op1, t)
+		t2 = c.resolveAs(stab, op2, t)
+	case untyped1:
+		t2 = c.resolve(stab, op2)
+		t1 = c.resolveAs(stab, op1, t2)
+	case untyped2:
+		t1 = c.resolve(stab, op1)
+		t2 = c.resolveAs(stab, op2, t1)
+	default:
+		t1 = c.resolve(stab, op1)
+		t2 = c.resolve(stab, op2)
+	}
+
+	if c.isErrorType(t1) {
+		// Error already logged by the type resolution
+		return t1
+	}
+
+	if c.isErrorType(t2) {
+		// Error already logged by the type resolution
+		return t2
+	}
+
+	if !t1.Equals(t2) {
+		stab.AddError(&IncompatibleTypesError{
+			Loc:   loc,
+			Type1: t1,
+			Type2: t2,
+		})
+
+		return &TypeErr{TypeErrIncompatible}
+	}
+
+	return t1
+}
+
+// shift resolves the type of a shift operation. Unlike other binary operations, the operands don't need to share a
+// type: the result has the type of the shifted value, and the count can be of any integer type. Constant counts are
+// checked to be in range of the shifted type.
+func (c *ContextAnalyzer) shift(stab *SymbolTable, e *BinaryExpr) Type {
+	count := c.resolveAs(stab, e.Op2, nil)
+	t := c.resolveAs(stab, e.Op1, nil)
+	e.ResolvedType = t
+
+	if c.isErrorType(t) {
+		// Error already logged by the type resolution
+		return t
+	}
+
+	if c.isErrorType(count) {
+		// Error already logged by the type resolution
+		return count
+	}
+
+	if !isInteger(t) {
+		stab.AddError(&UndefinedOperationError{
+			Loc:  e.GetLocation(),
+			Type: t,
+			Op:   e.Operation,
+		})
+
+		return &TypeErr{TypeErrBadOp}
+	}
+
+	if !isInteger(count) {
+		stab.AddError(&InvalidShiftCountError{
+			Loc:  e.Op2.GetLocation(),
+			Type: count,
+		})
+
+		return &TypeErr{TypeErrBadOp}
+	}
+
+	if v, isConst := evalConstant(e.Op2, c.sizes); isConst {
+		size := big.NewInt(int64(c.sizes.of(t.(*BasicType).Typ)))
+		if v.val.Sign() < 0 || v.int().Cmp(size) >= 0 {
+			stab.AddError(&ShiftCountOverflowError{
+				Loc:   e.Op2.GetLocation(),
+				Count: v.String(),
+				Type:  t,
+			})
+
+			return &TypeErr{TypeErrBadOp}
+		}
+	}
+
+	if v, isConst := evalConstant(e, c.sizes); isConst && !c.fits(stab, e.GetLocation(), v, t.(*BasicType)) {
+		return &TypeErr{TypeErrOverflow}
+	}
+
+	return t
+}
+
+// conversion resolves the type of a conversion expression. It checks the conversion is legal, and that constants being
+// converted fit in the target type.
+func (c *ContextAnalyzer) conversion(stab *SymbolTable, e *ConversionExpr) Type {
+	to := &BasicType{e.Type}
+
+	from := c.resolveAs(stab, e.Value, to)
+	e.ResolvedType = from
+
+	if c.isErrorType(from) {
+		// Error already logged by the type resolution
+		return from
+	}
+
+	if !isConvertible(from, to) {
+		stab.AddError(&InvalidConversionError{
+			Loc:  e.GetLocation(),
+			From: from,
+			To:   to,
+		})
+
+		return &TypeErr{TypeErrBadConversion}
+	}
+
+	if v, isConst := evalConstant(e, c.sizes); isConst && !c.fits(stab, e.GetLocation(), v, to) {
+		return &TypeErr{TypeErrOverflow}
+	}
+
+	return to
+}
+
+// call resolves a function call and checks the provided arguments match the ones declared by the function. It returns
+// the type of the called function, or nil if the called name is not a function.
+func (c *ContextAnalyzer) call(stab *SymbolTable, e *FuncCall) *FuncType {
+	t := stab.Get(e.Name)
+	if t == nil {
+		c.undefined(stab, e.GetLocation().prefix(e.Name), e.Name)
+
+		// The arguments are still checked, as their errors are unrelated to the function name
+		for _, arg := range e.Args {
+			c.resolve(stab, arg)
+		}
+
+		return nil
+	}
+
+	f, isFunc := t.(*FuncType)
+	if !isFunc {
+		stab.AddError(&NotCallableError{
+			Loc:  e.GetLocation(),
+			Name: e.Name,
+			Type: t,
+		})
+
+		return nil
+	}
+
+	counted := len(e.Args) == len(f.Args)
+	if f.Variadic {
+		counted = len(e.Args) >= len(f.Args)-1
+	}
+
+	if !counted {
+		expected := len(f.Args)
+		if f.Variadic {
+			expected--
+		}
+
+		stab.AddError(&ArgumentCountError{
+			Loc:      e.GetLocation(),
+			Name:     e.Name,
+			Expected: expected,
+			Got:      len(e.Args),
+			Variadic: f.Variadic,
+		})
+	} else if f.isGeneric() {
+		return c.instantiate(stab, e, f)
+	}
+
+	e.ResolvedTypes = nil
+	for i, arg := range e.Args {
+		param := f.param(i)
+
+		t := c.resolveAs(stab, arg, param)
+		e.ResolvedTypes = append(e.ResolvedTypes, t)
+
+		if param != nil && !c.isErrorType(t) && !param.Equals(t) {
+			stab.AddError(&ArgumentTypeError{
+				Loc:      arg.GetLocation(),
+				Name:     e.Name,
+				Expected: param,
+				Got:      t,
+			})
+		}
+	}
+
+	if counted && e.Name == "printf" {
+		c.format(stab, e)
+	}
+
+	return f
+}
+
+// format checks the format of a call to printf. The format must be a string literal, so its directives can be checked
+// against the types of the arguments at compile time.
+func (c *ContextAnalyzer) format(stab *SymbolTable, e *FuncCall) {
+	if !isString(e.ResolvedTypes[0]) {
+		// Error already logged by the argument checks
+		return
+	}
+
+	lit, isLit := e.Args[0].(*LiteralExpr)
+	if !isLit || lit.Typ != LiteralString {
+		stab.AddError(&InvalidFormatError{
+			Loc:    e.Args[0].GetLocation(),
+			Reason: "the format must be a string literal",
+		})
+
+		return
+	}
+
+	parts, err := parseFormat(lit.Value)
+	if err != nil {
+		stab.AddError(&InvalidFormatError{
+			Loc:    lit.GetLocation(),
+			Reason: err.Error(),
+		})
+
+		return
+	}
+
+	args := e.Args[1:]
+	if n := formatArgs(parts); n != len(args) {
+		stab.AddError(&FormatCountError{
+			Loc:      e.GetLocation(),
+			Expected: n,
+			Got:      len(args),
+		})
+
+		return
+	}
+
+	for _, part := range parts {
+		if part.spec == nil {
+			continue
+		}
+
+		t := e.ResolvedTypes[len(e.Args)-len(args)]
+		verb := formatVerbs[part.spec.verb]
+		if !c.isErrorType(t) && !verb.accepts(t) {
+			stab.AddError(&FormatTypeError{
+				Loc:      args[0].GetLocation(),
+				Spec:     part.spec.String(),
+				Expected: verb.expects,
+				Got:      t,
+			})
+		}
+
+		args = args[1:]
+	}
+}
+
+// interpolation resolves the embedded expressions of a string, and checks their format specifiers against their types.
+// The string is built at runtime, so it's never constant.
+func (c *ContextAnalyzer) interpolation(stab *SymbolTable, e *InterpolationExpr) Type {
+	for _, v := range e.Values {
+		t := c.resolveAs(stab, v.Value, nil)
+		v.ResolvedType = t
+
+		if c.isErrorType(t) {
+			// Error already logged by the type resolution
+			continue
+		}
+
+		spec := defaultSpec
+		if v.Format != "" {
+			var err error
+			if spec, err = parseSpec(v.Format); err != nil {
+				stab.AddError(&InvalidFormatError{
+					Loc:    v.FormatLoc,
+					Reason: err.Error(),
+				})
+
+				continue
+			}
+		}
+
+		if verb := formatVerbs[spec.verb]; !verb.accepts(t) {
+			stab.AddError(&FormatTypeError{
+				Loc:      v.Value.GetLocation(),
+				Spec:     v.Format,
+				Expected: verb.expects,
+				Got:      t,
+			})
+		}
+	}
+
+	return &BasicType{"string"}
+}
+
+// instantiate resolves a call to a built-in generic over the integer types. They are the integer operations, which take
+// two operands of the same type, as binary expressions do, and return a value of that type. It returns the signature
+// bound to the type of the operands, or nil if they are not integers.
+func (c *ContextAnalyzer) instantiate(stab *SymbolTable, e *FuncCall, f *FuncType) *FuncType {
+	t := c.resolveOperands(stab, e.GetLocation(), e.Args[0], e.Args[1])
+	e.ResolvedTypes = []Type{t, t}
+
+	if c.isErrorType(t) {
+		// Error already logged by the type resolution
+		return nil
+	}
+
+	if !isInteger(t) {
+		stab.AddError(&ArgumentTypeError{
+			Loc:      e.Args[0].GetLocation(),
+			Name:     e.Name,
+			Expected: f.Args[0].Type,
+			Got:      t,
+		})
+
+		return nil
+	}
+
+	return &FuncType{
+		Args:    []*ArgumentType{{Name: f.Args[0].Name, Type: t}, {Name: f.Args[1].Name, Type: t}},
+		Returns: []Type{t},
+	}
+}
+
+// fits returns true if the constant can be represented by the type. Otherwise, an error is added to the symbol table.
+func (c *ContextAnalyzer) fits(stab *SymbolTable, loc *Location, v *constValue, t *BasicType) bool {
+	if isInteger(t) && !v.isIntegral() {
+		stab.AddError(&ConstantTruncatedError{
+			Loc:   loc,
+			Value: v.String(),
+			Type:  t,
+		})
+
+		return false
+	}
+
+	if !v.fits(t, c.sizes) {
+		stab.AddError(&ConstantOverflowError{
+			Loc:   loc,
+			Value: v.String(),
+			Type:  t,
+		})
+
+		return false
+	}
+
+	return true
+}
+
+// annotateConstant sets the resolved type of a constant expression and all its operands
+func annotateConstant(expr Expr, t Type) {
+	switch e := expr.(type) {
+	case *BinaryExpr:
+		e.ResolvedType = t
+		annotateConstant(e.Op1, t)
+		annotateConstant(e.Op2, t)
+	case *UnaryExpr:
+		e.ResolvedType = t
+		annotateConstant(e.Operand, t)
+	}
+}
+
+// undefined adds an *UndefinedError to the symbol table, unless the name is declared later inside the current
+// function. In that case the read is reported by the flow analysis as a use before declaration.
+func (c *ContextAnalyzer) undefined(stab *SymbolTable, loc *Location, name string) {
+	if c.locals[name] {
+		return
+	}
+
+	// Only the names visible here are suggested, variables declared later in the function can't be used either
+	candidates := make([]string, 0, len(stab.Entries))
+	for entry := range stab.Entries {
+		candidates = append(candidates, entry)
+	}
+
+	stab.AddError(&UndefinedError{
+		Loc:        loc,
+		Name:       name,
+		Suggestion: suggest(name, candidates),
+	})
+}
+
 // addFunction is a shorthand to create a *FuncType entry inside the system table
 func (c *ContextAnalyzer) addFunction(stab *SymbolTable, e *FuncDecl) {
 	entry := &FuncType{}
@@ -321,6 +808,15 @@ func (c *ContextAnalyzer) isOpDefined(t Type, op BinaryOp) bool {
 		if t.Typ == "string" && op != BinaryAddition {
 			return false
 		}
+
+		if t.Typ == "bool" {
+			return false
+		}
+
+		switch op {
+		case BinaryModulo, BinaryAnd, BinaryOr, BinaryXor, BinaryAndNot, BinaryShiftLeft, BinaryShiftRight:
+			return isInteger(t)
+		}
 	}
 
 	return true
@@ -357,6 +853,12 @@ const (
 	// TypeErrBadOp occurs when a binary operation is attempted between operands of same type that have an undefined
 	// operation. For example "foo"-"bar".
 	TypeErrBadOp = "bad op"
+	// TypeErrOverflow occurs when a constant doesn't fit in the type it's given. For example uint8(300).
+	TypeErrOverflow = "overflow"
+	// TypeErrBadConversion occurs when a value is converted to a type it can't be converted to
+	TypeErrBadConversion = "bad conversion"
+	// TypeErrNoValue occurs when a function without returns is used as a value
+	TypeErrNoValue = "no value"
 )
 
 func (t *TypeErr) String() string {
@@ -385,6 +887,18 @@ func (t *AnyType) Equals(t2 Type) bool {
 	return true
 }
 
+// IntegerParam stands for any integer type in the signatures of built-in functions. Every call binds it to the type
+// of its arguments.
+type IntegerParam struct{}
+
+func (t *IntegerParam) String() string {
+	return "~integer"
+}
+
+func (t *IntegerParam) Equals(t2 Type) bool {
+	return isInteger(t2)
+}
+
 type BasicType struct {
 	Typ string
 }
@@ -401,6 +915,129 @@ func (t *BasicType) Equals(t2 Type) bool {
 	return false
 }
 
+// basicKind classifies the basic types by the values they can hold
+type basicKind int
+
+const (
+	kindSigned basicKind = iota
+	kindUnsigned
+	kindFloat
+	kindBool
+	kindString
+)
+
+// basicInfo describes the values a basic type can hold
+type basicInfo struct {
+	// kind is the class of values of the type
+	kind basicKind
+	// size is the size of the type in bits. Strings have no fixed size and their size is 0.
+	size int
+	// word is true for the integers as large as a pointer of the target (int and uint). Their size depends on the
+	// target, and must be taken from [sizes].
+	word bool
+}
+
+// basicTypes holds all built-in basic types, indexed by their name
+var basicTypes = map[string]basicInfo{
+	"int":     {kind: kindSigned, word: true},
+	"int8":    {kindSigned, 8, false},
+	"int16":   {kindSigned, 16, false},
+	"int32":   {kindSigned, 32, false},
+	"int64":   {kindSigned, 64, false},
+	"uint":    {kind: kindUnsigned, word: true},
+	"uint8":   {kindUnsigned, 8, false},
+	"uint16":  {kindUnsigned, 16, false},
+	"uint32":  {kindUnsigned, 32, false},
+	"uint64":  {kindUnsigned, 64, false},
+	"float32": {kindFloat, 32, false},
+	"float64": {kindFloat, 64, false},
+	"bool":    {kindBool, 1, false},
+	"string":  {kindString, 0, false},
+}
+
+// sizes tells the size of the basic types on a target
+type sizes struct {
+	// word is the size in bits of pointers, int and uint
+	word int
+}
+
+// of returns the size in bits of a basic type
+func (s sizes) of(typ string) int {
+	if info := basicTypes[typ]; !info.word {
+		return info.size
+	}
+
+	return s.word
+}
+
+// isBasicType returns true if the name is a built-in basic type
+func isBasicType(name string) bool {
+	_, ok := basicTypes[name]
+	return ok
+}
+
+// basicKindOf returns the kind of basic type. If the type is not a basic type false is returned.
+func basicKindOf(t Type) (basicKind, bool) {
+	b, isBasic := t.(*BasicType)
+	if !isBasic {
+		return 0, false
+	}
+
+	info, ok := basicTypes[b.Typ]
+	return info.kind, ok
+}
+
+// isNumeric returns true if the type is an integer or a floating point number
+func isNumeric(t Type) bool {
+	kind, ok := basicKindOf(t)
+	return ok && (kind == kindSigned || kind == kindUnsigned || kind == kindFloat)
+}
+
+// isInteger returns true if the type is a signed or unsigned integer
+func isInteger(t Type) bool {
+	kind, ok := basicKindOf(t)
+	return ok && (kind == kindSigned || kind == kindUnsigned)
+}
+
+// isSigned returns true if the type is a signed integer
+func isSigned(t Type) bool {
+	kind, ok := basicKindOf(t)
+	return ok && kind == kindSigned
+}
+
+// isFloat returns true if the type is a floating point number
+func isFloat(t Type) bool {
+	kind, ok := basicKindOf(t)
+	return ok && kind == kindFloat
+}
+
+// isBool returns true if the type is a bool
+func isBool(t Type) bool {
+	kind, ok := basicKindOf(t)
+	return ok && kind == kindBool
+}
+
+// isString returns true if the type is a string
+func isString(t Type) bool {
+	kind, ok := basicKindOf(t)
+	return ok && kind == kindString
+}
+
+// isConvertible returns true if a value of the first type can be explicitly converted to the second type. Numbers can
+// be converted between each other, and integers can be converted to strings holding the rune they represent.
+func isConvertible(from Type, to Type) bool {
+	if from.Equals(to) {
+		return true
+	}
+
+	if isNumeric(from) && isNumeric(to) {
+		return true
+	}
+
+	kind, ok := basicKindOf(to)
+	return ok && kind == kindString && isInteger(from)
+}
+
 type ArgumentType struct {
 	Name string
 	Type Type
@@ -420,7 +1057,33 @@ func (t *ArgumentType) Equals(t2 Type) bool {
 
 type FuncType struct {
 	Args    []*ArgumentType
-	Returns []*BasicType
+	Returns []Type
+	// Variadic is true if the last argument can be repeated any number of times, including none
+	Variadic bool
+}
+
+// param returns the type of the i-th argument of a call, or nil if the function takes fewer arguments
+func (t *FuncType) param(i int) Type {
+	switch {
+	case i < len(t.Args):
+		return t.Args[i].Type
+	case t.Variadic:
+		return t.Args[len(t.Args)-1].Type
+	default:
+		return nil
+	}
+}
+
+// isGeneric returns true if the function takes an IntegerParam, which is bound to the type of the arguments of each
+// call
+func (t *FuncType) isGeneric() bool {
+	for _, arg := range t.Args {
+		if _, ok := arg.Type.(*IntegerParam); ok {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (t *FuncType) String() string {
@@ -428,7 +1091,11 @@ func (t *FuncType) String() string {
 	str.WriteString("func(")
 
 	for i, arg := range t.Args {
-		str.WriteString(arg.String())
+		if t.Variadic && i == len(t.Args)-1 {
+			str.WriteString("..." + arg.Type.String())
+		} else {
+			str.WriteString(arg.String())
+		}
 
 		if i != len(t.Args)-1 {
 			str.WriteString(", ")
@@ -475,8 +1142,215 @@ func (t *FuncType) Equals(t2 Type) bool {
 	return false
 }
 
+// CompileError is an error found in the source code. Errors keep the data needed to analyze them, and are reported to
+// the user as a [Diagnostic].
 type CompileError interface {
-	fmt.Stringer
+	// Diagnostic builds the diagnostic reported to the user
+	Diagnostic() *Diagnostic
+}
+
+// Diagnostic codes identify each kind of error. Codes are stable: a code is never reused for a different kind of error,
+// so they can be looked up in the documentation and used by tools.
+const (
+	CodeSyntax               = "E0001"
+	CodeUndefined            = "E0002"
+	CodeIncompatibleTypes    = "E0003"
+	CodeUndefinedOperation   = "E0004"
+	CodeUseBeforeDeclaration = "E0005"
+	CodeUninitialized        = "E0006"
+	CodeUnusedVariable       = "E0007"
+	CodeInvalidConversion    = "E0008"
+	CodeConstantOverflow     = "E0009"
+	CodeConstantTruncated    = "E0010"
+	CodeDivisionByZero       = "E0011"
+	CodeInvalidShiftCount    = "E0012"
+	CodeShiftCountOverflow   = "E0013"
+	CodeNotCallable          = "E0014"
+	CodeArgumentCount        = "E0015"
+	CodeArgumentType         = "E0016"
+	CodeNoValue              = "E0017"
+	CodeInvalidFormat        = "E0018"
+	CodeFormatMismatch       = "E0019"
+)
+
+// Explanation is the long-form documentation of a diagnostic code
+type Explanation struct {
+	// Title is a short summary of the error
+	Title string
+	// Description explains what causes the error
+	Description string
+	// Example is a minimal program that fails with the error
+	Example string
+	// Fix explains how to solve the error
+	Fix string
+	// Fixed is the example program once fixed
+	Fixed string
+}
+
+// explanations holds the documentation of every diagnostic code. Every code emitted by the compiler must be documented
+// here.
+var explanations = map[string]*Explanation{
+	CodeSyntax: {
+		Title: "syntax error",
+		Description: "The code doesn't follow the grammar of the language, for example an operator is missing an " +
+			"operand, a parenthesis or brace is not closed, or an invalid symbol is found.",
+		Example: "func main() {\n    print(1 +)\n}",
+		Fix:     "Complete or remove the malformed expression.",
+		Fixed:   "func main() {\n    print(1 + 2)\n}",
+	},
+	CodeUndefined: {
+		Title:       "undefined name",
+		Description: "A name is used, but no variable or function with that name is declared.",
+		Example:     "func main() {\n    print(count)\n}",
+		Fix:         "Declare the name before using it, or fix its spelling.",
+		Fixed:       "func main() {\n    count := 1\n    print(count)\n}",
+	},
+	CodeIncompatibleTypes: {
+		Title: "incompatible types",
+		Description: "An operation mixes values of different types. Values are never converted implicitly, so both " +
+			"operands must have the same type. Untyped constants take the type of the other operand.",
+		Example: "func main() {\n    a := int64(1)\n    print(a + int32(2))\n}",
+		Fix:     "Convert one of the operands, so both have the same type.",
+		Fixed:   "func main() {\n    a := int64(1)\n    print(a + int64(int32(2)))\n}",
+	},
+	CodeUndefinedOperation: {
+		Title: "undefined operation",
+		Description: "The operator is not defined for the type of its operands. For example strings can only be " +
+			"added, and bitwise operators, shifts and remainders are only defined for integers.",
+		Example: "func main() {\n    print(\"a\" - \"b\")\n}",
+		Fix:     "Use an operator defined for the type, or convert the operands.",
+		Fixed:   "func main() {\n    print(\"a\" + \"b\")\n}",
+	},
+	CodeUseBeforeDeclaration: {
+		Title:       "variable used before its declaration",
+		Description: "A local variable is read before the statement that declares it.",
+		Example:     "func main() {\n    print(x)\n    x := 1\n}",
+		Fix:         "Move the declaration before the first use of the variable.",
+		Fixed:       "func main() {\n    x := 1\n    print(x)\n}",
+	},
+	CodeUninitialized: {
+		Title: "possibly uninitialized variable",
+		Description: "A local variable is declared on some paths only, for example inside an if statement, and then " +
+			"read on a path where it might not be declared.",
+		Example: "func main() {\n    if parseInt(\"1\") == 1 {\n        x := 1\n    }\n    print(x)\n}",
+		Fix:     "Declare the variable before the branch, so it's declared on every path.",
+		Fixed:   "func main() {\n    x := 0\n    if parseInt(\"1\") == 1 {\n        x := 1\n    }\n    print(x)\n}",
+	},
+	CodeUnusedVariable: {
+		Title:       "unused variable",
+		Description: "A local variable is declared, but never read.",
+		Example:     "func main() {\n    x := parseInt(\"1\")\n}",
+		Fix:         "Use the variable, remove it, or assign the value to _ to discard it.",
+		Fixed:       "func main() {\n    _ := parseInt(\"1\")\n}",
+	},
+	CodeInvalidConversion: {
+		Title: "invalid conversion",
+		Description: "The value can't be converted to the type. Numbers can be converted between them, and integers " +
+			"into strings, but strings can't be converted into numbers.",
+		Example: "func main() {\n    print(int64(\"1\"))\n}",
+		Fix:     "Use a built-in function to parse the string.",
+		Fixed:   "func main() {\n    print(parseInt(\"1\"))\n}",
+	},
+	CodeConstantOverflow: {
+		Title:       "constant overflow",
+		Description: "The value of a constant doesn't fit in its type.",
+		Example:     "func main() {\n    print(uint8(300))\n}",
+		Fix:         "Use a larger type.",
+		Fixed:       "func main() {\n    print(uint16(300))\n}",
+	},
+	CodeConstantTruncated: {
+		Title:       "constant truncated",
+		Description: "A constant with a fractional part is used as an integer, which would lose the fractional part.",
+		Example:     "func main() {\n    print(int(1.5))\n}",
+		Fix:         "Use a floating point type, or an integral constant.",
+		Fixed:       "func main() {\n    print(float64(1.5))\n}",
+	},
+	CodeDivisionByZero: {
+		Title:       "division by zero",
+		Description: "A division or remainder has a constant divisor equal to zero.",
+		Example:     "func main() {\n    print(10 / 0)\n}",
+		Fix:         "Divide by a value other than zero.",
+		Fixed:       "func main() {\n    print(10 / 2)\n}",
+	},
+	CodeInvalidShiftCount: {
+		Title:       "invalid shift count",
+		Description: "The count of a shift is not an integer.",
+		Example:     "func main() {\n    print(1 << 1.5)\n}",
+		Fix:         "Shift by an integer count.",
+		Fixed:       "func main() {\n    print(1 << 2)\n}",
+	},
+	CodeShiftCountOverflow: {
+		Title: "shift count overflow",
+		Description: "The constant count of a shift is negative, or not smaller than the size in bits of the shifted " +
+			"type, which would shift out every bit.",
+		Example: "func main() {\n    print(int8(1) << 8)\n}",
+		Fix:     "Use a count smaller than the size of the type, or a larger type.",
+		Fixed:   "func main() {\n    print(int16(1) << 8)\n}",
+	},
+	CodeNotCallable: {
+		Title:       "call of a non-function",
+		Description: "A value that is not a function is called.",
+		Example:     "func main() {\n    x := 1\n    print(x())\n}",
+		Fix:         "Remove the call, or call a function instead.",
+		Fixed:       "func main() {\n    x := 1\n    print(x)\n}",
+	},
+	CodeArgumentCount: {
+		Title:       "wrong number of arguments",
+		Description: "A function is called with more or fewer arguments than it expects.",
+		Example:     "func main() {\n    print(formatInt(1, 2))\n}",
+		Fix:         "Provide one argument for each parameter of the function.",
+		Fixed:       "func main() {\n    print(formatInt(12))\n}",
+	},
+	CodeArgumentType: {
+		Title:       "wrong argument type",
+		Description: "A function is called with an argument whose type doesn't match the type of the parameter.",
+		Example:     "func main() {\n    print(parseInt(3))\n}",
+		Fix:         "Provide an argument of the expected type.",
+		Fixed:       "func main() {\n    print(parseInt(\"3\"))\n}",
+	},
+	CodeNoValue: {
+		Title:       "function call has no value",
+		Description: "The result of a function that returns nothing is used as a value.",
+		Example:     "func main() {\n    x := print(1)\n    print(x)\n}",
+		Fix:         "Call the function as a statement on its own.",
+		Fixed:       "func main() {\n    print(1)\n}",
+	},
+	CodeInvalidFormat: {
+		Title: "invalid format",
+		Description: "The format of printf is not a string literal, or one of its directives is malformed. A " +
+			"directive starts with '%', followed by optional flags, width and precision, and ends with a verb: v, d, " +
+			"x, X, o, c, e, E, f, F, g, G, s or t. A literal percent sign is written as '%%'. The format specifiers " +
+			"of the expressions embedded in strings, as in \"{x:08x}\", are directives without the '%'.",
+		Example: "func main() {\n    printf(\"%y\\n\", 1)\n}",
+		Fix:     "Use a valid verb for the value.",
+		Fixed:   "func main() {\n    printf(\"%d\\n\", 1)\n}",
+	},
+	CodeFormatMismatch: {
+		Title: "format mismatch",
+		Description: "The directives of a format don't match its arguments: there are more or fewer arguments than " +
+			"directives, or a verb can't format the type of its argument. The format specifiers of the expressions " +
+			"embedded in strings must also match the type of the expression.",
+		Example: "func main() {\n    printf(\"%d\\n\", \"one\")\n}",
+		Fix:     "Use a verb that formats the type of the argument, such as s for strings or v for any value.",
+		Fixed:   "func main() {\n    printf(\"%s\\n\", \"one\")\n}",
+	},
+}
+
+// Explain returns the long-form documentation of a diagnostic code, with an example of the error and how to fix it. It
+// returns false if the code is unknown.
+func Explain(code string) (string, bool) {
+	e, ok := explanations[strings.ToUpper(code)]
+	if !ok {
+		return "", false
+	}
+
+	return fmt.Sprintf("%s: %s\n\n%s\n\nErroneous code example:\n\n%s\n\n%s\n\n%s\n", strings.ToUpper(code), e.Title,
+		e.Description, indent(e.Example), e.Fix, indent(e.Fixed)), true
+}
+
+// indent indents every line of the code with four spaces
+func indent(code string) string {
+	return "    " + strings.ReplaceAll(code, "\n", "\n    ")
 }
 
 type BadExprError struct {
@@ -484,17 +1358,205 @@ type BadExprError struct {
 	Expr *BadExpr
 }
 
-func (e BadExprError) String() string {
-	return fmt.Sprintf("%s bad expression: %s", e.Loc, e.Expr.Error)
+func (e BadExprError) Diagnostic() *Diagnostic {
+	d := newError(CodeSyntax, e.Loc, "bad expression: %s", e.Expr.Error)
+	if e.Expr.Suggestion != "" {
+		d.fix(e.Expr.Location, e.Expr.Suggestion, fmt.Sprintf("did you mean '%s'?", e.Expr.Suggestion))
+	}
+
+	return d
 }
 
 type UndefinedError struct {
 	Loc  *Location
 	Name string
+	// Suggestion is a visible name with a similar spelling, if any
+	Suggestion string
+}
+
+func (e UndefinedError) Diagnostic() *Diagnostic {
+	d := newError(CodeUndefined, e.Loc, "undefined: %s", e.Name)
+	if e.Suggestion != "" {
+		d.fix(e.Loc, e.Suggestion, fmt.Sprintf("did you mean '%s'?", e.Suggestion))
+	}
+
+	return d
+}
+
+type UseBeforeDeclarationError struct {
+	Loc  *Location
+	Name string
+	// Decl points to the declaration of the variable
+	Decl *Location
 }
 
-func (e UndefinedError) String() string {
-	return fmt.Sprintf("%s undefined: %s", e.Loc, e.Name)
+func (e UseBeforeDeclarationError) Diagnostic() *Diagnostic {
+	return newError(CodeUseBeforeDeclaration, e.Loc, "used before declaration: %s", e.Name).
+		related(e.Decl, "%s is declared here", e.Name)
+}
+
+type UninitializedError struct {
+	Loc  *Location
+	Name string
+	// Decl points to the first declaration of the variable
+	Decl *Location
+}
+
+func (e UninitializedError) Diagnostic() *Diagnostic {
+	return newError(CodeUninitialized, e.Loc, "possibly uninitialized: %s is not declared on every path", e.Name).
+		related(e.Decl, "%s is declared here", e.Name).
+		note("declare %s before the branch to initialize it on every path", e.Name)
+}
+
+type UnusedVariableError struct {
+	Loc  *Location
+	Name string
+}
+
+func (e UnusedVariableError) Diagnostic() *Diagnostic {
+	name := e.Loc.prefix(e.Name)
+	return newError(CodeUnusedVariable, name, "declared and not used: %s", e.Name).
+		fix(name, "_", "assign the value to _ to discard it")
+}
+
+type InvalidConversionError struct {
+	Loc  *Location
+	From Type
+	To   Type
+}
+
+func (e InvalidConversionError) Diagnostic() *Diagnostic {
+	return newError(CodeInvalidConversion, e.Loc, "cannot convert '%s' to '%s'", e.From, e.To)
+}
+
+type ConstantOverflowError struct {
+	Loc   *Location
+	Value string
+	Type  Type
+}
+
+func (e ConstantOverflowError) Diagnostic() *Diagnostic {
+	return newError(CodeConstantOverflow, e.Loc, "constant %s overflows '%s'", e.Value, e.Type)
+}
+
+type ConstantTruncatedError struct {
+	Loc   *Location
+	Value string
+	Type  Type
+}
+
+func (e ConstantTruncatedError) Diagnostic() *Diagnostic {
+	return newError(CodeConstantTruncated, e.Loc, "constant %s truncated to '%s'", e.Value, e.Type)
+}
+
+type DivisionByZeroError struct {
+	Loc *Location
+}
+
+func (e DivisionByZeroError) Diagnostic() *Diagnostic {
+	return newError(CodeDivisionByZero, e.Loc, "division by zero")
+}
+
+type InvalidShiftCountError struct {
+	Loc  *Location
+	Type Type
+}
+
+func (e InvalidShiftCountError) Diagnostic() *Diagnostic {
+	return newError(CodeInvalidShiftCount, e.Loc, "invalid shift count of type '%s', it must be an integer", e.Type)
+}
+
+type ShiftCountOverflowError struct {
+	Loc   *Location
+	Count string
+	Type  Type
+}
+
+func (e ShiftCountOverflowError) Diagnostic() *Diagnostic {
+	return newError(CodeShiftCountOverflow, e.Loc, "invalid shift count %s for '%s'", e.Count, e.Type).
+		note("the count of a shift must be less than the size in bits of the shifted type")
+}
+
+type NotCallableError struct {
+	Loc  *Location
+	Name string
+	Type Type
+}
+
+func (e NotCallableError) Diagnostic() *Diagnostic {
+	return newError(CodeNotCallable, e.Loc, "cannot call non-function %s of type '%s'", e.Name, e.Type)
+}
+
+type ArgumentCountError struct {
+	Loc      *Location
+	Name     string
+	Expected int
+	Got      int
+	// Variadic is true if the function takes at least Expected arguments
+	Variadic bool
+}
+
+func (e ArgumentCountError) Diagnostic() *Diagnostic {
+	expected := fmt.Sprint(e.Expected)
+	if e.Variadic {
+		expected = "at least " + expected
+	}
+
+	return newError(CodeArgumentCount, e.Loc, "wrong number of arguments in call to %s: expected %s, got %d", e.Name,
+		expected, e.Got)
+}
+
+type ArgumentTypeError struct {
+	Loc      *Location
+	Name     string
+	Expected Type
+	Got      Type
+}
+
+func (e ArgumentTypeError) Diagnostic() *Diagnostic {
+	return newError(CodeArgumentType, e.Loc, "cannot use '%s' as '%s' in argument to %s", e.Got, e.Expected, e.Name)
+}
+
+type NoValueError struct {
+	Loc  *Location
+	Name string
+}
+
+func (e NoValueError) Diagnostic() *Diagnostic {
+	return newError(CodeNoValue, e.Loc, "%s() has no value and can't be used as one", e.Name)
+}
+
+type InvalidFormatError struct {
+	Loc    *Location
+	Reason string
+}
+
+func (e InvalidFormatError) Diagnostic() *Diagnostic {
+	return newError(CodeInvalidFormat, e.Loc, "invalid format: %s", e.Reason)
+}
+
+type FormatCountError struct {
+	Loc      *Location
+	Expected int
+	Got      int
+}
+
+func (e FormatCountError) Diagnostic() *Diagnostic {
+	return newError(CodeFormatMismatch, e.Loc, "format mismatch: expected %d arguments for the directives, got %d",
+		e.Expected, e.Got)
+}
+
+type FormatTypeError struct {
+	Loc *Location
+	// Spec is the directive formatting the argument as written, such as %08x in printf, or 08x in {x:08x}
+	Spec     string
+	Expected string
+	Got      Type
+}
+
+func (e FormatTypeError) Diagnostic() *Diagnostic {
+	return newError(CodeFormatMismatch, e.Loc, "format mismatch: '%s' expects %s, got '%s'", e.Spec, e.Expected, e.Got).
+		note("the verb v formats values of any type")
 }
 
 type IncompatibleTypesError struct {
@@ -503,8 +1565,15 @@ type IncompatibleTypesError struct {
 	Type2 Type
 }
 
-func (e IncompatibleTypesError) String() string {
-	return fmt.Sprintf("%s incompatible types: '%s' and '%s'", e.Loc, e.Type1, e.Type2)
+func (e IncompatibleTypesError) Diagnostic() *Diagnostic {
+	d := newError(CodeIncompatibleTypes, e.Loc, "incompatible types: '%s' and '%s'", e.Type1, e.Type2)
+
+	// Only numbers convert into each other
+	if isNumeric(e.Type1) && isNumeric(e.Type2) {
+		d.note("values of different types are never converted implicitly, convert one of them as in %s(x)", e.Type1)
+	}
+
+	return d
 }
 
 type UndefinedOperationError struct {
@@ -513,8 +1582,8 @@ type UndefinedOperationError struct {
 	Op   BinaryOp
 }
 
-func (e UndefinedOperationError) String() string {
-	return fmt.Sprintf("%s undefined operation: '%s' has no operand '%s'", e.Loc, e.Type, e.Op)
+func (e UndefinedOperationError) Diagnostic() *Diagnostic {
+	return newError(CodeUndefinedOperation, e.Loc, "undefined operation: '%s' has no operand '%s'", e.Type, e.Op)
 }
 
 type UndefinedUnitaryError struct {
@@ -523,8 +1592,20 @@ type UndefinedUnitaryError struct {
 	Op   UnaryOp
 }
 
-func (e UndefinedUnitaryError) String() string {
-	return fmt.Sprintf("%s undefined operation: '%s' has no operand '%s'", e.Loc, e.Type, e.Op)
+func (e UndefinedUnitaryError) Diagnostic() *Diagnostic {
+	return newError(CodeUndefinedOperation, e.Loc, "undefined operation: '%s' has no operand '%s'", e.Type, e.Op)
+}
+
+// sortErrors orders the errors by their position in the source code. Errors without location go last, in their order.
+func sortErrors(errs []CompileError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		l1, l2 := errs[i].Diagnostic().Loc, errs[j].Diagnostic().Loc
+		if l1 == nil || l2 == nil {
+			return l1 != nil && l2 == nil
+		}
+
+		return l1.Start < l2.Start
+	})
 }
 
 // SymbolTable keeps a list of definitions and types inside a code context. It also hold all related errors generated
@@ -536,22 +1617,17 @@ type SymbolTable struct {
 	Errors []CompileError
 }
 
-// NewGlobalSymbolTable crates a new symbol table with global definitions prepopulated
+// NewGlobalSymbolTable crates a new symbol table with global definitions prepopulated. They're the built-in functions,
+// see builtinFuncs.
 func NewGlobalSymbolTable() *SymbolTable {
-	// TODO: Move the creation of global definitions elsewhere
-	return &SymbolTable{
-		Entries: map[string]Type{
-			"print": &FuncType{
-				Args: []*ArgumentType{
-					{
-						Name: "v",
-						Type: &AnyType{},
-					},
-				},
-				Returns: nil,
-			},
-		},
+	entries := make(map[string]Type)
+	for _, f := range builtinFuncs {
+		if f.name != "" {
+			entries[f.name] = f.typ
+		}
 	}
+
+	return &SymbolTable{Entries: entries}
 }
 
 // NewSymbolTable creates a new empty symbol table
@@ -577,17 +1653,35 @@ func (t *SymbolTable) Get(name string) Type {
 }
 
 // Import merges the provided symbol table into the current table. It copies entries and errors. If an entry with the
-// same name already exists, it will be replaced. Priority is given to the incoming entry.
+// same name already exists, it will be replaced. Priority is given to the incoming entry. Errors already present in the
+// current table are not duplicated.
 func (t *SymbolTable) Import(t2 SymbolTable) {
 	for key, typ2 := range t2.Entries {
 		t.Entries[key] = typ2
 	}
 
-	for _, err := range t2.Errors {
-		t.Errors = append(t.Errors, err)
+	// Both tables might share the same backing array, so the incoming errors are copied before appending
+	errs := make([]CompileError, len(t2.Errors))
+	copy(errs, t2.Errors)
+
+	for _, err := range errs {
+		if !t.hasError(err) {
+			t.Errors = append(t.Errors, err)
+		}
 	}
 }
 
+// hasError returns true if the exact error is already in the table's error list
+func (t *SymbolTable) hasError(err CompileError) bool {
+	for _, err2 := range t.Errors {
+		if err == err2 {
+			return true
+		}
+	}
+
+	return false
+}
+
 // Copy creates a new table and copies all entries and errors into it
 func (t *SymbolTable) Copy() *SymbolTable {
 	t2 := NewSymbolTable()
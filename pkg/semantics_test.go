@@ -1,6 +1,13 @@
 package maqui
 
 import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"io/fs"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -84,6 +91,7 @@ func TestContextAnalyzer(t *testing.T) {
 											Typ:   LiteralNumber,
 											Value: "1",
 										},
+										ResolvedType: &BasicType{"int"},
 									},
 									ResolvedType: &BasicType{
 										Typ: "int",
@@ -94,14 +102,24 @@ func TestContextAnalyzer(t *testing.T) {
 						Stab: &SymbolTable{
 							Entries: map[string]Type{
 								"x":    &BasicType{"int"},
-								"main": &FuncType{nil, nil},
+								"main": &FuncType{},
+							},
+							Errors: []CompileError{
+								&UnusedVariableError{
+									Name: "x",
+								},
 							},
 						},
 					},
 				},
+				Errors: []CompileError{
+					&UnusedVariableError{
+						Name: "x",
+					},
+				},
 				Global: &SymbolTable{
 					Entries: map[string]Type{
-						"main": &FuncType{nil, nil},
+						"main": &FuncType{},
 					},
 				},
 			},
@@ -139,6 +157,7 @@ func TestContextAnalyzer(t *testing.T) {
 									Typ:   LiteralString,
 									Value: "text",
 								},
+								ResolvedType: &TypeErr{TypeErrIncompatible},
 							},
 							ResolvedType: &TypeErr{TypeErrIncompatible},
 						},
@@ -189,7 +208,7 @@ func TestContextAnalyzer(t *testing.T) {
 						},
 						Stab: &SymbolTable{
 							Entries: map[string]Type{
-								"foo": &FuncType{nil, nil},
+								"foo": &FuncType{},
 							},
 						},
 					},
@@ -200,7 +219,7 @@ func TestContextAnalyzer(t *testing.T) {
 						},
 						Stab: &SymbolTable{
 							Entries: map[string]Type{
-								"foo": &FuncType{nil, nil},
+								"foo": &FuncType{},
 							},
 						},
 					},
@@ -208,7 +227,7 @@ func TestContextAnalyzer(t *testing.T) {
 				Errors: nil,
 				Global: &SymbolTable{
 					Entries: map[string]Type{
-						"foo": &FuncType{nil, nil},
+						"foo": &FuncType{},
 					},
 				},
 			},
@@ -297,6 +316,7 @@ func TestContextAnalyzer(t *testing.T) {
 								Typ:   LiteralNumber,
 								Value: "1",
 							},
+							ResolvedType: &BasicType{"int"},
 						},
 						Stab: NewSymbolTable(),
 					},
@@ -325,6 +345,7 @@ func TestContextAnalyzer(t *testing.T) {
 								Typ:   LiteralString,
 								Value: "foo",
 							},
+							ResolvedType: &BasicType{"string"},
 						},
 						Stab: &SymbolTable{
 							Entries: map[string]Type{},
@@ -374,6 +395,7 @@ func TestContextAnalyzer(t *testing.T) {
 								Typ:   LiteralString,
 								Value: "bar",
 							},
+							ResolvedType: &BasicType{"string"},
 						},
 						Stab: &SymbolTable{
 							Entries: map[string]Type{},
@@ -441,6 +463,7 @@ func TestContextAnalyzer(t *testing.T) {
 									Typ:   LiteralNumber,
 									Value: "1",
 								},
+								ResolvedType: &BasicType{"int"},
 							},
 							ResolvedType: &BasicType{"int"},
 						},
@@ -463,6 +486,7 @@ func TestContextAnalyzer(t *testing.T) {
 								Op2: &Identifier{
 									Name: "x",
 								},
+								ResolvedType: &BasicType{"int"},
 							},
 							ResolvedType: &BasicType{"int"},
 						},
@@ -514,6 +538,7 @@ func TestContextAnalyzer(t *testing.T) {
 								Op2: &Identifier{
 									Name: "x",
 								},
+								ResolvedType: &TypeErr{TypeErrUndefined},
 							},
 							ResolvedType: &TypeErr{TypeErrUndefined},
 						},
@@ -549,6 +574,7 @@ func TestContextAnalyzer(t *testing.T) {
 			analyzer := NewContextAnalyser(parser)
 
 			c.expect.Filename = parser.GetFilename()
+			c.expect.Target = DefaultTarget
 
 			global := NewGlobalSymbolTable()
 			analyzer.DefineInto(global)
@@ -580,7 +606,7 @@ func TestTypeEquals(t *testing.T) {
 				Type: tInt1,
 			},
 		},
-		Returns: []*BasicType{tStr},
+		Returns: []Type{tStr},
 	}
 
 	tFunc2 := &FuncType{
@@ -590,7 +616,7 @@ func TestTypeEquals(t *testing.T) {
 				Type: tInt1,
 			},
 		},
-		Returns: []*BasicType{tStr},
+		Returns: []Type{tStr},
 	}
 
 	tFunc3 := &FuncType{
@@ -600,7 +626,7 @@ func TestTypeEquals(t *testing.T) {
 				Type: tInt1,
 			},
 		},
-		Returns: []*BasicType{tInt1},
+		Returns: []Type{tInt1},
 	}
 
 	assert.True(t, tInt1.Equals(tInt2))
@@ -627,14 +653,15 @@ func TestTypeString(t *testing.T) {
 				Type: &BasicType{"int"},
 			},
 		},
-		Returns: []*BasicType{
-			{"string"},
-			{"int"},
+		Returns: []Type{
+			&BasicType{"string"},
+			&BasicType{"int"},
 		},
 	}
 
 	assert.Equal(t, "int", tInt.String())
 	assert.Equal(t, "func(string, int) string, int", tFunc.String())
+	assert.Equal(t, "func(string, ...~any) ", variadicSignature(&ArgumentType{Type: &BasicType{"string"}}).String())
 }
 
 func TestStabCopy(t *testing.T) {
@@ -648,9 +675,9 @@ func TestStabCopy(t *testing.T) {
 						Type: &BasicType{"string"},
 					},
 				},
-				Returns: []*BasicType{
-					{"string"},
-					{"int"},
+				Returns: []Type{
+					&BasicType{"string"},
+					&BasicType{"int"},
 				},
 			},
 		},
@@ -664,3 +691,526 @@ func TestStabCopy(t *testing.T) {
 
 	assert.Equal(t, stab, stab.Copy())
 }
+
+func TestConversion(t *testing.T) {
+	lit := func(v string) Expr {
+		return &LiteralExpr{Typ: LiteralNumber, Value: v}
+	}
+
+	cases := []struct {
+		name   string
+		expr   Expr
+		expect Type
+		err    CompileError
+	}{
+		{
+			"IntToInt64",
+			&ConversionExpr{Type: "int64", Value: &Identifier{Name: "i"}},
+			&BasicType{"int64"},
+			nil,
+		},
+		{
+			"FloatToUint8",
+			&ConversionExpr{Type: "uint8", Value: &Identifier{Name: "f"}},
+			&BasicType{"uint8"},
+			nil,
+		},
+		{
+			"IntToString",
+			&ConversionExpr{Type: "string", Value: &Identifier{Name: "i"}},
+			&BasicType{"string"},
+			nil,
+		},
+		{
+			"ConstantInRange",
+			&ConversionExpr{Type: "int8", Value: &UnaryExpr{Operation: UnaryNegative, Operand: lit("128")}},
+			&BasicType{"int8"},
+			nil,
+		},
+		{
+			"LargeConstantToInt64",
+			&ConversionExpr{Type: "int64", Value: lit("3000000000")},
+			&BasicType{"int64"},
+			nil,
+		},
+		{
+			"ConstantOverflow",
+			&ConversionExpr{Type: "uint8", Value: lit("300")},
+			&TypeErr{TypeErrOverflow},
+			&ConstantOverflowError{Value: "300", Type: &BasicType{"uint8"}},
+		},
+		{
+			"NegativeToUnsigned",
+			&ConversionExpr{Type: "uint64", Value: &UnaryExpr{Operation: UnaryNegative, Operand: lit("1")}},
+			&TypeErr{TypeErrOverflow},
+			&ConstantOverflowError{Value: "-1", Type: &BasicType{"uint64"}},
+		},
+		{
+			"TypedConstantOverflow",
+			&ConversionExpr{Type: "uint8", Value: &ConversionExpr{Type: "int64", Value: lit("256")}},
+			&TypeErr{TypeErrOverflow},
+			&ConstantOverflowError{Value: "256", Type: &BasicType{"uint8"}},
+		},
+		{
+			"ConstantTruncated",
+			&ConversionExpr{Type: "int", Value: lit("1.5")},
+			&TypeErr{TypeErrOverflow},
+			&ConstantTruncatedError{Value: "1.5", Type: &BasicType{"int"}},
+		},
+		{
+			"StringToInt",
+			&ConversionExpr{Type: "int", Value: &Identifier{Name: "s"}},
+			&TypeErr{TypeErrBadConversion},
+			&InvalidConversionError{From: &BasicType{"string"}, To: &BasicType{"int"}},
+		},
+		{
+			"FloatToString",
+			&ConversionExpr{Type: "string", Value: &Identifier{Name: "f"}},
+			&TypeErr{TypeErrBadConversion},
+			&InvalidConversionError{From: &BasicType{"float64"}, To: &BasicType{"string"}},
+		},
+		{
+			"UntypedConstantAdoptsType",
+			&BinaryExpr{
+				Operation: BinaryAddition,
+				Op1:       &ConversionExpr{Type: "uint8", Value: &Identifier{Name: "i"}},
+				Op2:       lit("255"),
+			},
+			&BasicType{"uint8"},
+			nil,
+		},
+		{
+			"TypedConstantSumOverflow",
+			&BinaryExpr{
+				Operation: BinaryAddition,
+				Op1:       &ConversionExpr{Type: "uint8", Value: lit("200")},
+				Op2:       lit("100"),
+			},
+			&TypeErr{TypeErrOverflow},
+			&ConstantOverflowError{Value: "300", Type: &BasicType{"uint8"}},
+		},
+		{
+			"HexadecimalConstant",
+			&ConversionExpr{Type: "uint8", Value: lit("0xFF")},
+			&BasicType{"uint8"},
+			nil,
+		},
+		{
+			"SeparatedConstantOverflow",
+			&ConversionExpr{Type: "int16", Value: lit("0b1000_0000_0000_0000")},
+			&TypeErr{TypeErrOverflow},
+			&ConstantOverflowError{Value: "32768", Type: &BasicType{"int16"}},
+		},
+		{
+			"RuneToString",
+			&ConversionExpr{Type: "string", Value: &LiteralExpr{Typ: LiteralRune, Value: "é"}},
+			&BasicType{"string"},
+			nil,
+		},
+		{
+			"RuneConstantDefaultsToInt32",
+			&BinaryExpr{Operation: BinaryAddition, Op1: lit("1"), Op2: &LiteralExpr{Typ: LiteralRune, Value: "a"}},
+			&BasicType{"int32"},
+			nil,
+		},
+		{
+			"DivisionByZero",
+			&BinaryExpr{Operation: BinaryDivision, Op1: &Identifier{Name: "i"}, Op2: lit("0")},
+			&TypeErr{TypeErrBadOp},
+			&DivisionByZeroError{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stab := NewSymbolTable()
+			stab.Add("i", &BasicType{"int"})
+			stab.Add("f", &BasicType{"float64"})
+			stab.Add("s", &BasicType{"string"})
+
+			analyzer := NewContextAnalyser(NewParserMocker(nil))
+			assert.Equal(t, c.expect, analyzer.resolve(stab, c.expr))
+
+			if c.err == nil {
+				assert.Empty(t, stab.Errors)
+				return
+			}
+
+			assert.Equal(t, []CompileError{c.err}, stab.Errors)
+		})
+	}
+}
+
+func TestIntegerOperations(t *testing.T) {
+	lit := func(v string) Expr {
+		return &LiteralExpr{Typ: LiteralNumber, Value: v}
+	}
+	id := func(name string) Expr {
+		return &Identifier{Name: name}
+	}
+
+	cases := []struct {
+		name   string
+		expr   Expr
+		expect Type
+		err    CompileError
+	}{
+		{
+			"Modulo",
+			&BinaryExpr{Operation: BinaryModulo, Op1: id("i"), Op2: lit("3")},
+			&BasicType{"int"},
+			nil,
+		},
+		{
+			"ModuloByZero",
+			&BinaryExpr{Operation: BinaryModulo, Op1: id("i"), Op2: lit("0")},
+			&TypeErr{TypeErrBadOp},
+			&DivisionByZeroError{},
+		},
+		{
+			"FloatModulo",
+			&BinaryExpr{Operation: BinaryModulo, Op1: id("f"), Op2: lit("2")},
+			&TypeErr{TypeErrBadOp},
+			&UndefinedOperationError{Type: &BasicType{"float64"}, Op: BinaryModulo},
+		},
+		{
+			"FloatAnd",
+			&BinaryExpr{Operation: BinaryAnd, Op1: id("f"), Op2: id("f")},
+			&TypeErr{TypeErrBadOp},
+			&UndefinedOperationError{Type: &BasicType{"float64"}, Op: BinaryAnd},
+		},
+		{
+			"FloatBitwiseNot",
+			&UnaryExpr{Operation: UnaryBitwiseNot, Operand: id("f")},
+			&TypeErr{TypeErrBadOp},
+			&UndefinedUnitaryError{Type: &BasicType{"float64"}, Op: UnaryBitwiseNot},
+		},
+		{
+			"UnsignedBitwiseNotConstant",
+			&UnaryExpr{Operation: UnaryBitwiseNot, Operand: &ConversionExpr{Type: "uint8", Value: lit("0")}},
+			&BasicType{"uint8"},
+			nil,
+		},
+		{
+			"ShiftKeepsLeftType",
+			&BinaryExpr{Operation: BinaryShiftLeft, Op1: id("u"), Op2: id("i")},
+			&BasicType{"uint8"},
+			nil,
+		},
+		{
+			"ShiftByFloat",
+			&BinaryExpr{Operation: BinaryShiftRight, Op1: id("i"), Op2: id("f")},
+			&TypeErr{TypeErrBadOp},
+			&InvalidShiftCountError{Type: &BasicType{"float64"}},
+		},
+		{
+			"ShiftFloat",
+			&BinaryExpr{Operation: BinaryShiftLeft, Op1: id("f"), Op2: lit("1")},
+			&TypeErr{TypeErrBadOp},
+			&UndefinedOperationError{Type: &BasicType{"float64"}, Op: BinaryShiftLeft},
+		},
+		{
+			"ShiftCountTooLarge",
+			&BinaryExpr{Operation: BinaryShiftLeft, Op1: id("u"), Op2: lit("8")},
+			&TypeErr{TypeErrBadOp},
+			&ShiftCountOverflowError{Count: "8", Type: &BasicType{"uint8"}},
+		},
+		{
+			"NegativeShiftCount",
+			&BinaryExpr{Operation: BinaryShiftRight, Op1: id("i"), Op2: &UnaryExpr{Operation: UnaryNegative, Operand: lit("1")}},
+			&TypeErr{TypeErrBadOp},
+			&ShiftCountOverflowError{Count: "-1", Type: &BasicType{"int"}},
+		},
+		{
+			"ConstantShiftOverflow",
+			&BinaryExpr{Operation: BinaryShiftLeft, Op1: &ConversionExpr{Type: "int8", Value: lit("64")}, Op2: lit("1")},
+			&TypeErr{TypeErrOverflow},
+			&ConstantOverflowError{Value: "128", Type: &BasicType{"int8"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			stab := NewSymbolTable()
+			stab.Add("i", &BasicType{"int"})
+			stab.Add("u", &BasicType{"uint8"})
+			stab.Add("f", &BasicType{"float64"})
+
+			analyzer := NewContextAnalyser(NewParserMocker(nil))
+			assert.Equal(t, c.expect, analyzer.resolve(stab, c.expr))
+
+			if c.err == nil {
+				assert.Empty(t, stab.Errors)
+				return
+			}
+
+			assert.Equal(t, []CompileError{c.err}, stab.Errors)
+		})
+	}
+}
+
+// analyzeSource runs the lexer, parser and context analyzer over the source code
+func analyzeSource(source string) *AST {
+	analyzer := NewContextAnalyser(NewParser(NewLexerFromReader(strings.NewReader(source))))
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+
+	return analyzer.Do(global)
+}
+
+func TestUndefinedSuggestion(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect string
+	}{
+		{"Builtin", "func main() {\n    prnt(\"a\")\n}", "print"},
+		{"Global", "counter := 1\nfunc main() {\n    print(formatInt(countr))\n}", "counter"},
+		{"Local", "func main() {\n    total := 1\n    print(formatInt(totl + total))\n}", "total"},
+		{"NoMatch", "func main() {\n    print(formatInt(zzz))\n}", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := analyzeSource(c.input).Errors
+			if !assert.Len(t, errs, 1) {
+				return
+			}
+
+			e, ok := errs[0].(*UndefinedError)
+			if !assert.True(t, ok, "expected *UndefinedError, got %T", errs[0]) {
+				return
+			}
+			assert.Equal(t, c.expect, e.Suggestion)
+
+			d := e.Diagnostic()
+			if c.expect == "" {
+				assert.Empty(t, d.Fixes)
+				return
+			}
+
+			if assert.Len(t, d.Fixes, 1) {
+				assert.Equal(t, c.expect, d.Fixes[0].Replacement)
+				assert.Equal(t, e.Loc, d.Fixes[0].Loc)
+			}
+		})
+	}
+}
+
+func TestExplanations(t *testing.T) {
+	for code, e := range explanations {
+		t.Run(code, func(t *testing.T) {
+			var codes []string
+			for _, err := range analyzeSource(e.Example).Errors {
+				codes = append(codes, err.Diagnostic().Code)
+			}
+
+			assert.Contains(t, codes, code, "the example must fail with its code")
+			assert.Empty(t, analyzeSource(e.Fixed).Errors, "the fixed example must compile")
+
+			text, ok := Explain(strings.ToLower(code))
+			assert.True(t, ok)
+			assert.True(t, strings.HasPrefix(text, code+": "+e.Title+"\n"))
+		})
+	}
+
+	_, ok := Explain("E9999")
+	assert.False(t, ok)
+}
+
+// TestEveryCodeIsExplained checks that every code passed to newError in the package has an explanation
+func TestEveryCodeIsExplained(t *testing.T) {
+	fset := gotoken.NewFileSet()
+	pkgs, err := goparser.ParseDir(fset, ".", func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	assert.NoError(t, err)
+
+	values := make(map[string]string)
+	used := make(map[string]bool)
+	for _, pkg := range pkgs {
+		goast.Inspect(pkg, func(n goast.Node) bool {
+			switch n := n.(type) {
+			case *goast.ValueSpec:
+				for i, name := range n.Names {
+					if i >= len(n.Values) {
+						break
+					}
+
+					if lit, ok := n.Values[i].(*goast.BasicLit); ok && strings.HasPrefix(name.Name, "Code") {
+						values[name.Name], _ = strconv.Unquote(lit.Value)
+					}
+				}
+			case *goast.CallExpr:
+				if fn, ok := n.Fun.(*goast.Ident); ok && fn.Name == "newError" {
+					code, ok := n.Args[0].(*goast.Ident)
+					if assert.True(t, ok, "%s: codes must be constants", fset.Position(n.Pos())) {
+						used[code.Name] = true
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	assert.NotEmpty(t, used)
+	for name := range used {
+		value, declared := values[name]
+		assert.True(t, declared, "code %s is not declared", name)
+		assert.Contains(t, explanations, value, "code %s (%s) has no explanation", name, value)
+	}
+}
+
+func TestWordSize(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		target Target
+		err    CompileError
+	}{
+		{"Int64Bits", "3000000000", DefaultTarget, nil},
+		{"Int32Bits", "3000000000", Target{Arch: I386, Vendor: Unknown, OS: Linux}, &ConstantOverflowError{}},
+		{"Uint64Bits", "uint32(^uint(0))", DefaultTarget, &ConstantOverflowError{}},
+		{"Uint32Bits", "uint32(^uint(0))", Target{Arch: Wasm32, Vendor: Unknown, OS: WASI}, nil},
+		{"ShiftInt32Bits", "1 << 40", Target{Arch: Wasm32, Vendor: Unknown, OS: WASI}, &ShiftCountOverflowError{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			source := fmt.Sprintf("func main() {\n    x := %s\n    print(formatInt(int64(x)))\n}", c.input)
+			analyzer := NewContextAnalyser(NewParser(NewLexerFromReader(strings.NewReader(source))))
+			analyzer.SetTarget(c.target)
+
+			global := NewGlobalSymbolTable()
+			analyzer.DefineInto(global)
+			ast := analyzer.Do(global)
+
+			assert.Equal(t, c.target, ast.Target)
+			if c.err == nil {
+				assert.Empty(t, ast.Errors)
+				return
+			}
+
+			if assert.Len(t, ast.Errors, 1) {
+				assert.IsType(t, c.err, ast.Errors[0])
+			}
+		})
+	}
+}
+
+func TestIntegerBuiltins(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect Type
+		err    CompileError
+	}{
+		{"BoundToOperands", "wrappingAdd(int32(1), int32(2))", &BasicType{"int32"}, nil},
+		{"UntypedConstant", "checkedMul(parseInt(\"3\"), 2)", &BasicType{"int64"}, nil},
+		{"UntypedFirst", "wrappingSub(1, uint8(2))", &BasicType{"uint8"}, nil},
+		{"DefaultType", "checkedAdd(1, 2)", &BasicType{"int"}, nil},
+		{"Float", "wrappingAdd(1.5, 2.0)", nil, &ArgumentTypeError{}},
+		{"Incompatible", "checkedSub(int8(1), int16(2))", nil, &IncompatibleTypesError{}},
+		{"ArgumentCount", "checkedAdd(1)", nil, &ArgumentCountError{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast := analyzeSource(fmt.Sprintf("func main() {\n    x := %s\n    print(x)\n}", c.input))
+			if c.err != nil {
+				if assert.Len(t, ast.Errors, 1) {
+					assert.IsType(t, c.err, ast.Errors[0])
+				}
+
+				return
+			}
+
+			if assert.Empty(t, ast.Errors) {
+				decl := ast.Statements[0].Expr.(*FuncDecl).Body[0].(*VariableDecl)
+				assert.Equal(t, c.expect, decl.ResolvedType)
+			}
+		})
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		err   CompileError
+	}{
+		{"PrintNothing", "print()", nil},
+		{"PrintAnyType", "print(1, 2.5, \"s\", 1 == 1, int8(1))", nil},
+		{"Println", "println(\"x =\", 1)", nil},
+		{"Printf", "printf(\"%d %5.2f %s %t %v %c 100%%\\n\", 1, 2.5, \"s\", 1 == 1, uint8(1), 65)", nil},
+		{"PrintfWithoutFormat", "printf()", &ArgumentCountError{}},
+		{"FormatNotLiteral", "printf(formatInt(1))", &InvalidFormatError{}},
+		{"FormatNotString", "printf(1)", &ArgumentTypeError{}},
+		{"UnknownVerb", "printf(\"%y\", 1)", &InvalidFormatError{}},
+		{"MissingVerb", "printf(\"%08\", 1)", &InvalidFormatError{}},
+		{"MissingArgument", "printf(\"%d %d\", 1)", &FormatCountError{}},
+		{"ExtraArgument", "printf(\"%d\", 1, 2)", &FormatCountError{}},
+		{"WrongVerb", "printf(\"%d\", \"one\")", &FormatTypeError{}},
+		{"FloatAsInteger", "printf(\"%x\", 1.5)", &FormatTypeError{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast := analyzeSource(fmt.Sprintf("func main() {\n    %s\n}", c.input))
+			if c.err == nil {
+				assert.Empty(t, ast.Errors)
+				return
+			}
+
+			if assert.Len(t, ast.Errors, 1) {
+				assert.IsType(t, c.err, ast.Errors[0])
+			}
+		})
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		types []Type
+		err   CompileError
+	}{
+		{"DefaultTypes", `"{1} {2.5} {'a'}"`, []Type{&BasicType{"int"}, &BasicType{"float64"}, &BasicType{"int32"}}, nil},
+		{"Expressions", `"{x + 1} {x == 2} {formatInt(int64(x))}"`,
+			[]Type{&BasicType{"int8"}, &BasicType{"bool"}, &BasicType{"string"}}, nil},
+		{"FormatSpec", `"{x:08x} {1.5:.2f} {x:c}"`, []Type{&BasicType{"int8"}, &BasicType{"float64"}, &BasicType{"int8"}},
+			nil},
+		{"Nested", `"[{"{x}"}]"`, []Type{&BasicType{"string"}}, nil},
+		{"Undefined", `"{y}"`, nil, &UndefinedError{}},
+		{"UnknownVerb", `"{x:y}"`, nil, &InvalidFormatError{}},
+		{"WrongVerb", `"{"s":d}"`, nil, &FormatTypeError{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast := analyzeSource(fmt.Sprintf("func main() {\n    x := int8(1)\n    s := %s\n    print(x, s)\n}", c.input))
+			if c.err != nil {
+				if assert.Len(t, ast.Errors, 1) {
+					assert.IsType(t, c.err, ast.Errors[0])
+				}
+
+				return
+			}
+
+			if assert.Empty(t, ast.Errors) {
+				decl := ast.Statements[0].Expr.(*FuncDecl).Body[1].(*VariableDecl)
+				assert.Equal(t, &BasicType{"string"}, decl.ResolvedType)
+
+				var typs []Type
+				for _, v := range decl.Value.(*InterpolationExpr).Values {
+					typs = append(typs, v.ResolvedType)
+				}
+
+				assert.Equal(t, c.types, typs)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package maqui
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Arch string
+type Vendor string
+type OS string
+
+const (
+	X86_64  Arch = "x86_64"
+	AArch64 Arch = "aarch64"
+	RISCV64 Arch = "riscv64"
+	I386    Arch = "i386"
+	Wasm32  Arch = "wasm32"
+
+	Unknown Vendor = "unknown"
+	PC      Vendor = "pc"
+	Apple   Vendor = "apple"
+
+	Windows   OS = "windows"
+	Linux     OS = "linux"
+	Darwin    OS = "darwin"
+	WASI      OS = "wasi"
+	UnknownOS OS = "unknown"
+)
+
+// Archs holds all the supported architectures
+var Archs = []Arch{X86_64, AArch64, RISCV64, I386, Wasm32}
+
+// archAliases maps the alternative names of the architectures, as used by other tools, to their canonical name
+var archAliases = map[string]Arch{
+	"x86_64":  X86_64,
+	"amd64":   X86_64,
+	"aarch64": AArch64,
+	"arm64":   AArch64,
+	"riscv64": RISCV64,
+	"i386":    I386,
+	"i486":    I386,
+	"i586":    I386,
+	"i686":    I386,
+	"x86":     I386,
+	"wasm32":  Wasm32,
+}
+
+// osAliases maps the alternative names of the operating systems to their canonical name
+var osAliases = map[string]OS{
+	"windows":   Windows,
+	"windows64": Windows,
+	"win32":     Windows,
+	"linux":     Linux,
+	"darwin":    Darwin,
+	"macos":     Darwin,
+	"macosx":    Darwin,
+	"wasi":      WASI,
+	"unknown":   UnknownOS,
+}
+
+// Target is the platform the code is compiled for, described as in an LLVM target triple
+type Target struct {
+	Arch   Arch
+	Vendor Vendor
+	OS     OS
+	// Env is the environment or ABI, such as gnu, musl or msvc. It's optional.
+	Env string
+}
+
+// String returns the target triple, in the arch-vendor-os[-env] form
+func (t Target) String() string {
+	s := fmt.Sprintf("%s-%s-%s", t.Arch, t.Vendor, t.OS)
+	if t.Env != "" {
+		s += "-" + t.Env
+	}
+
+	return s
+}
+
+// DefaultTarget is the target used when none is provided
+var DefaultTarget = Target{
+	Arch:   X86_64,
+	Vendor: Unknown,
+	OS:     Linux,
+}
+
+// ParseTarget parses a target triple in the arch-vendor-os[-env] form, for example x86_64-unknown-linux or
+// aarch64-unknown-linux-gnu. The vendor can be left out, as in x86_64-linux-gnu or wasm32-wasi, and common aliases of
+// the architectures and operating systems are accepted, such as amd64, arm64 or macos.
+func ParseTarget(s string) (Target, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 2 || len(parts) > 4 {
+		return Target{}, fmt.Errorf("invalid target %q, expected arch-vendor-os", s)
+	}
+
+	arch, ok := archAliases[parts[0]]
+	if !ok {
+		return Target{}, fmt.Errorf("unsupported architecture %q in target %q", parts[0], s)
+	}
+
+	t := Target{Arch: arch, Vendor: Unknown}
+
+	rest := parts[1:]
+	if _, isOS := osAliases[rest[0]]; len(rest) > 1 && (!isOS || isVendor(rest[0])) {
+		t.Vendor = Vendor(rest[0])
+		rest = rest[1:]
+	}
+
+	if len(rest) > 2 {
+		return Target{}, fmt.Errorf("invalid target %q, expected arch-vendor-os", s)
+	}
+
+	if t.OS, ok = osAliases[rest[0]]; !ok {
+		return Target{}, fmt.Errorf("unsupported operating system %q in target %q", rest[0], s)
+	}
+
+	if len(rest) > 1 {
+		t.Env = rest[1]
+	}
+
+	// WebAssembly has its own system interface, and the rest of the architectures need a real operating system
+	if (t.Arch == Wasm32) != (t.OS == WASI || t.OS == UnknownOS) {
+		return Target{}, fmt.Errorf("unsupported operating system %q for architecture %q in target %q", t.OS, t.Arch, s)
+	}
+
+	return t, nil
+}
+
+// isVendor returns true if the name is a known vendor. It tells apart vendors from operating systems with the same
+// name, as in wasm32-unknown-unknown.
+func isVendor(name string) bool {
+	switch Vendor(name) {
+	case Unknown, PC, Apple:
+		return true
+	}
+
+	return false
+}
+
+// PointerSize returns the size in bits of pointers, which is also the size of int and uint
+func (t Target) PointerSize() int {
+	switch t.Arch {
+	case I386, Wasm32:
+		return 32
+	default:
+		return 64
+	}
+}
+
+// sizes returns the size of the basic types on the target
+func (t Target) sizes() sizes {
+	return sizes{word: t.PointerSize()}
+}
+
+// DataLayout returns the LLVM data layout of the target. It describes the size and alignment of the types, and must
+// match the one used by the backend to build the target.
+func (t Target) DataLayout() string {
+	switch t.Arch {
+	case X86_64:
+		// The symbol mangling follows the object file format of the operating system
+		mangling := "e"
+		switch t.OS {
+		case Darwin:
+			mangling = "o"
+		case Windows:
+			mangling = "w"
+		}
+
+		return "e-m:" + mangling + "-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128"
+	case AArch64:
+		switch t.OS {
+		case Darwin:
+			return "e-m:o-i64:64-i128:128-n32:64-S128"
+		case Windows:
+			return "e-m:w-p:64:64-i32:32-i64:64-i128:128-n32:64-S128"
+		default:
+			return "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128"
+		}
+	case RISCV64:
+		return "e-m:e-p:64:64-i64:64-i128:128-n64-S128"
+	case I386:
+		const pointers = "-p:32:32-p270:32:32-p271:32:32-p272:64:64"
+		switch t.OS {
+		case Windows:
+			// MinGW keeps the 80-bit floats of the System V ABI
+			f80 := "128"
+			if t.Env == "gnu" {
+				f80 = "32"
+			}
+
+			return "e-m:x" + pointers + "-i64:64-f80:" + f80 + "-n8:16:32-a:0:32-S32"
+		case Darwin:
+			return "e-m:o" + pointers + "-f64:32:64-f80:128-n8:16:32-S128"
+		default:
+			return "e-m:e" + pointers + "-f64:32:64-f80:32-n8:16:32-S128"
+		}
+	case Wasm32:
+		return "e-m:e-p:32:32-p10:8:8-p20:8:8-i64:64-n32:64-S128-ni:1:10:20"
+	}
+
+	return ""
+}
@@ -0,0 +1,69 @@
+package maqui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTarget(t *testing.T) {
+	cases := []struct {
+		name   string
+		input  string
+		expect Target
+		err    bool
+	}{
+		{"Linux", "x86_64-unknown-linux", Target{Arch: X86_64, Vendor: Unknown, OS: Linux}, false},
+		{"Windows", "x86_64-pc-windows-msvc", Target{Arch: X86_64, Vendor: PC, OS: Windows, Env: "msvc"}, false},
+		{"WindowsAlias", "x86_64-unknown-windows64", Target{Arch: X86_64, Vendor: Unknown, OS: Windows}, false},
+		{"Default", DefaultTarget.String(), DefaultTarget, false},
+		{"WithoutVendor", "aarch64-linux-gnu", Target{Arch: AArch64, Vendor: Unknown, OS: Linux, Env: "gnu"}, false},
+		{"OnlyOS", "x86_64-linux", Target{Arch: X86_64, Vendor: Unknown, OS: Linux}, false},
+		{"ArchAlias", "arm64-apple-macos", Target{Arch: AArch64, Vendor: Apple, OS: Darwin}, false},
+		{"RISCV", "riscv64-unknown-linux-gnu", Target{Arch: RISCV64, Vendor: Unknown, OS: Linux, Env: "gnu"}, false},
+		{"I686", "i686-pc-windows-gnu", Target{Arch: I386, Vendor: PC, OS: Windows, Env: "gnu"}, false},
+		{"WASI", "wasm32-wasi", Target{Arch: Wasm32, Vendor: Unknown, OS: WASI}, false},
+		{"WasmUnknown", "wasm32-unknown-unknown", Target{Arch: Wasm32, Vendor: Unknown, OS: UnknownOS}, false},
+		{"MissingParts", "x86_64", Target{}, true},
+		{"TooManyParts", "x86_64-pc-linux-gnu-extra", Target{}, true},
+		{"UnknownArch", "sparc-unknown-linux", Target{}, true},
+		{"UnknownOS", "x86_64-unknown-plan9", Target{}, true},
+		{"WasmWithOS", "wasm32-unknown-linux", Target{}, true},
+		{"WASIWithoutWasm", "x86_64-unknown-wasi", Target{}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			target, err := ParseTarget(c.input)
+			assert.Equal(t, c.err, err != nil, err)
+			assert.Equal(t, c.expect, target)
+		})
+	}
+}
+
+func TestTargetDataLayout(t *testing.T) {
+	cases := []struct {
+		target  string
+		pointer int
+		expect  string
+	}{
+		{"x86_64-unknown-linux", 64, "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128"},
+		{"x86_64-pc-windows-msvc", 64, "e-m:w-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128"},
+		{"x86_64-apple-darwin", 64, "e-m:o-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128"},
+		{"aarch64-unknown-linux", 64, "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128"},
+		{"aarch64-apple-darwin", 64, "e-m:o-i64:64-i128:128-n32:64-S128"},
+		{"riscv64-unknown-linux", 64, "e-m:e-p:64:64-i64:64-i128:128-n64-S128"},
+		{"i386-unknown-linux", 32, "e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-f64:32:64-f80:32-n8:16:32-S128"},
+		{"i386-pc-windows-gnu", 32, "e-m:x-p:32:32-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:32-n8:16:32-a:0:32-S32"},
+		{"wasm32-unknown-wasi", 32, "e-m:e-p:32:32-p10:8:8-p20:8:8-i64:64-n32:64-S128-ni:1:10:20"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			target, err := ParseTarget(c.target)
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect, target.DataLayout())
+			assert.Equal(t, c.pointer, target.PointerSize())
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package maqui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoToolchain is returned when neither clang nor llc and a C compiler are found
+var ErrNoToolchain = errors.New("no toolchain found: install clang, or llc and a C compiler such as cc, " +
+	"or point MAQUI_CC to one")
+
+// Toolchain holds the external tools that turn LLVM IR into bitcode, assembly, object files and executables. Either
+// clang runs every step, or llc compiles the IR and a C compiler driver links the object files. The driver calls the
+// system linker (ld) with the C runtime and libraries of the platform.
+type Toolchain struct {
+	// Clang is the path of clang. If set, the rest of the tools are not used.
+	Clang string
+	// LLC is the path of llc, which compiles LLVM IR into assembly and object files
+	LLC string
+	// LLVMAs is the path of llvm-as, which turns LLVM IR into bitcode. It's optional.
+	LLVMAs string
+	// Linker is the path of the C compiler that links executables, such as cc or gcc
+	Linker string
+	// LinkerTarget is the target the Linker builds executables for, unlike clang which builds them for any target. If
+	// zero, it's unknown and the Linker is used for every target.
+	LinkerTarget Target
+}
+
+// LinkOptions are passed to the linker when building executables
+type LinkOptions struct {
+	// Libraries are linked by name, as in -l
+	Libraries []string
+	// LibraryPaths are searched for libraries, as in -L
+	LibraryPaths []string
+	// Inputs are object files and archives linked into the executable
+	Inputs []string
+}
+
+// FindToolchain looks for a toolchain. The C compiler is taken from cc, the MAQUI_CC environment variable, or searched
+// in PATH, in that order. If the C compiler is not clang it's only used to link, and llc is used to compile. When
+// searching, clang is preferred over clang-NN (the newest version first), and llc with cc or gcc is the fallback.
+func FindToolchain(cc string) (*Toolchain, error) {
+	if cc == "" {
+		cc = os.Getenv("MAQUI_CC")
+	}
+
+	if cc != "" {
+		path, err := exec.LookPath(cc)
+		if err != nil {
+			return nil, fmt.Errorf("C compiler %q not found: %w", cc, err)
+		}
+
+		if isClang(path) {
+			return &Toolchain{Clang: path}, nil
+		}
+
+		// Other compilers can't read LLVM IR, so llc compiles it and the compiler only links
+		llc := findVersioned("llc")
+		if llc == "" {
+			return nil, fmt.Errorf("%s can't compile LLVM IR, and llc was not found", cc)
+		}
+
+		return linkerToolchain(llc, path), nil
+	}
+
+	if clang := findVersioned("clang"); clang != "" {
+		return &Toolchain{Clang: clang}, nil
+	}
+
+	llc := findVersioned("llc")
+	for _, linker := range []string{"cc", "gcc"} {
+		if path, err := exec.LookPath(linker); err == nil && llc != "" {
+			return linkerToolchain(llc, path), nil
+		}
+	}
+
+	return nil, ErrNoToolchain
+}
+
+// linkerToolchain returns the toolchain where llc compiles, and the C compiler links for its own target
+func linkerToolchain(llc string, linker string) *Toolchain {
+	t := &Toolchain{LLC: llc, LLVMAs: findVersioned("llvm-as"), Linker: linker}
+
+	// The compiler prints the triple it builds for, as in x86_64-linux-gnu or aarch64-apple-darwin23.1.0
+	if out, err := exec.Command(linker, "-dumpmachine").Output(); err == nil {
+		machine := strings.Replace(strings.TrimSpace(string(out)), "mingw32", string(Windows), 1)
+		machine = osVersion.ReplaceAllString(machine, "$1")
+		t.LinkerTarget, _ = ParseTarget(machine)
+	}
+
+	return t
+}
+
+// osVersion matches the version that follows the operating system in a target triple
+var osVersion = regexp.MustCompile(`(darwin|macos)[0-9.]+`)
+
+// isClang returns true if the executable is clang, possibly versioned as in clang-15
+func isClang(path string) bool {
+	name := strings.TrimSuffix(filepath.Base(path), ".exe")
+	return name == "clang" || versionedName("clang").MatchString(name)
+}
+
+// versionedName matches the name of a versioned LLVM tool, as in llc-15, capturing its version
+func versionedName(name string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `-(\d+)$`)
+}
+
+// findVersioned returns the path of an LLVM tool. The unversioned name is preferred, and otherwise the newest version
+// found in PATH is used. An empty string is returned if the tool is not found.
+func findVersioned(name string) string {
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+
+	re := versionedName(name)
+	best, bestVersion := "", -1
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range entries {
+			m := re.FindStringSubmatch(strings.TrimSuffix(e.Name(), ".exe"))
+			if m == nil {
+				continue
+			}
+
+			version, _ := strconv.Atoi(m[1])
+			path, err := exec.LookPath(filepath.Join(dir, e.Name()))
+			if err == nil && version > bestVersion {
+				best, bestVersion = path, version
+			}
+		}
+	}
+
+	return best
+}
+
+// commands returns the commands that build the output from the IR, which is read from the standard input of the first
+// command. The optimization level and the stripping of executables are taken from the profile. The returned cleanup
+// function removes the intermediate files.
+func (t *Toolchain) commands(target Target, profile Profile, emit Emit, output string,
+	link LinkOptions) ([]*exec.Cmd, func(), error) {
+	noCleanup := func() {}
+
+	if t.Clang != "" {
+		args := []string{"--target=" + target.String(), profile.Opt.flag()}
+		switch emit {
+		case EmitLLVMBC:
+			args = append(args, "-c", "-emit-llvm")
+		case EmitAsm:
+			args = append(args, "-S")
+		case EmitObj:
+			args = append(args, "-c")
+		}
+
+		args = append(args, "-o", output, "-x", "ir", "-")
+		if emit == EmitExe {
+			// Reset the language, so inputs are detected by their extension
+			args = append(args, "-x", "none")
+			args = append(args, link.args()...)
+
+			if profile.Strip {
+				args = append(args, "-s")
+			}
+		}
+
+		return []*exec.Cmd{exec.Command(t.Clang, args...)}, noCleanup, nil
+	}
+
+	llc := func(fileType string, output string) *exec.Cmd {
+		return exec.Command(t.LLC, "-mtriple="+target.String(), profile.Opt.llcFlag(), "-relocation-model=pic",
+			"-filetype="+fileType, "-o", output, "-")
+	}
+
+	switch emit {
+	case EmitLLVMBC:
+		if t.LLVMAs == "" {
+			return nil, nil, errors.New("emitting LLVM bitcode requires clang or llvm-as, but none was found")
+		}
+
+		return []*exec.Cmd{exec.Command(t.LLVMAs, "-o", output, "-")}, noCleanup, nil
+	case EmitAsm:
+		return []*exec.Cmd{llc("asm", output)}, noCleanup, nil
+	case EmitObj:
+		return []*exec.Cmd{llc("obj", output)}, noCleanup, nil
+	}
+
+	linker := t.LinkerTarget
+	if linker != (Target{}) && (linker.Arch != target.Arch || linker.OS != target.OS) {
+		return nil, nil, fmt.Errorf("%s links executables for %s, not for %s: use clang, or a C compiler for %s in "+
+			"MAQUI_CC", filepath.Base(t.Linker), linker, target, target)
+	}
+
+	dir, err := os.MkdirTemp("", "maqui-build-")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj := filepath.Join(dir, "main.o")
+	args := append([]string{"-o", output, obj}, link.args()...)
+	if profile.Strip {
+		args = append(args, "-s")
+	}
+
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	return []*exec.Cmd{llc("obj", obj), exec.Command(t.Linker, args...)}, cleanup, nil
+}
+
+// args returns the command line arguments of the link options, as understood by C compiler drivers
+func (l LinkOptions) args() []string {
+	args := append([]string{}, l.Inputs...)
+	for _, dir := range l.LibraryPaths {
+		args = append(args, "-L"+dir)
+	}
+
+	for _, lib := range l.Libraries {
+		args = append(args, "-l"+lib)
+	}
+
+	return args
+}
+
+// ToolchainError is a failure reported by one of the tools of the [Toolchain], such as the linker not finding a
+// symbol or a library. As there's no source code to point to, it has no location.
+type ToolchainError struct {
+	// Tool is the name of the tool that failed, as in clang or ld
+	Tool string
+	// Message describes the failure
+	Message string
+	// Notes hold further details, such as where an undefined symbol is referenced
+	Notes []string
+}
+
+// Diagnostic returns an error without code, as toolchain failures are not problems of the source code
+func (e ToolchainError) Diagnostic() *Diagnostic {
+	return &Diagnostic{
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("%s: %s", e.Tool, e.Message),
+		Notes:    e.Notes,
+	}
+}
+
+var (
+	// undefinedReference matches undefined symbols reported by GNU ld, as in "undefined reference to `foo'"
+	undefinedReference = regexp.MustCompile("undefined reference to [`']([^'`]+)'")
+	// undefinedSymbol matches undefined symbols reported by lld, as in "error: undefined symbol: foo"
+	undefinedSymbol = regexp.MustCompile(`undefined symbol: (\S+)`)
+	// referencedBy matches where lld found an undefined symbol, as in ">>> referenced by main.o"
+	referencedBy = regexp.MustCompile(`^>>> referenced by (.+)$`)
+	// undefinedDarwin matches undefined symbols reported by the linker of macOS, as in `  "_foo", referenced from:`
+	undefinedDarwin = regexp.MustCompile(`^\s*"_?([^"]+)", referenced from:`)
+	// inFunction matches the function referencing an undefined symbol, as in "main.o: in function `main':"
+	inFunction = regexp.MustCompile("in function [`']([^'`]+)'")
+	// missingLibrary matches libraries the linker couldn't find, as in "cannot find -lfoo"
+	missingLibrary = regexp.MustCompile(`(?:cannot find|unable to find library|library not found for) -l(\S+?)(?::|$|\s)`)
+	// toolPrefix matches the name of the tool at the start of its messages, as in "/usr/bin/ld: " or "clang: error: "
+	toolPrefix = regexp.MustCompile(`^(?:\S*/)?([\w.+-]+): (?:(?:fatal )?error: )?`)
+	// linkerSummary matches the lines that only repeat that a tool failed, as in "collect2: error: ld returned 1"
+	linkerSummary = regexp.MustCompile(`linker command failed|ld returned \d+ exit status|` +
+		`^Undefined symbols for architecture|^ld: symbol\(s\) not found`)
+)
+
+// parseToolchainOutput turns the output of a failed tool into compile errors. Undefined symbols and missing libraries
+// are recognized, as reported by GNU ld, lld and the linker of macOS, while the rest of the messages are reported as
+// they are. If the tool gave no output, its exit status is reported.
+func parseToolchainOutput(tool string, err error, output []byte) []CompileError {
+	var errs []CompileError
+
+	undefined := make(map[string][]string)
+	var symbols []string
+	addUndefined := func(symbol string, function string) {
+		if _, ok := undefined[symbol]; !ok {
+			symbols = append(symbols, symbol)
+			undefined[symbol] = nil
+		}
+
+		if function != "" {
+			undefined[symbol] = append(undefined[symbol], function)
+		}
+	}
+
+	// Tools like GNU ld only prefix the first line of a message with their name, so the last name seen is kept
+	current, linker := tool, tool
+	function, last := "", ""
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || linkerSummary.MatchString(line) {
+			continue
+		}
+
+		if m := toolPrefix.FindStringSubmatch(line); m != nil {
+			current = m[1]
+		}
+
+		if m := inFunction.FindStringSubmatch(line); m != nil && !undefinedReference.MatchString(line) {
+			function = m[1]
+			continue
+		}
+
+		switch m := matchAny(line, undefinedReference, undefinedSymbol, undefinedDarwin); {
+		case m != "":
+			linker = current
+			last = m
+			addUndefined(m, function)
+		case strings.HasPrefix(line, ">>>"):
+			// Details of the last undefined symbol found by lld
+			if ref := referencedBy.FindStringSubmatch(line); ref != nil && last != "" {
+				addUndefined(last, ref[1])
+			}
+		case missingLibrary.MatchString(line):
+			lib := missingLibrary.FindStringSubmatch(line)[1]
+			errs = append(errs, &ToolchainError{
+				Tool:    current,
+				Message: fmt.Sprintf("library not found: %s", lib),
+				Notes:   []string{"add the directory holding the library with -L"},
+			})
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			// Continuation of the previous message, such as the source line shown by llc. Carets are dropped, as
+			// the columns are lost in the notes.
+			if len(errs) > 0 && strings.Trim(line, " \t^~") != "" {
+				e := errs[len(errs)-1].(*ToolchainError)
+				e.Notes = append(e.Notes, strings.TrimSpace(line))
+			}
+		default:
+			errs = append(errs, &ToolchainError{
+				Tool:    current,
+				Message: trimToolPrefix(line),
+			})
+		}
+	}
+
+	for _, symbol := range symbols {
+		e := &ToolchainError{
+			Tool:    linker,
+			Message: fmt.Sprintf("undefined symbol: %s", symbol),
+		}
+
+		functions := uniqueSorted(undefined[symbol])
+		if len(functions) > 0 {
+			e.Notes = append(e.Notes, fmt.Sprintf("referenced in %s", strings.Join(functions, ", ")))
+		}
+
+		e.Notes = append(e.Notes, "the symbol might be defined in a library or object file missing from the build, "+
+			"add it with -l or as an input file")
+		errs = append(errs, e)
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, &ToolchainError{Tool: tool, Message: err.Error()})
+	}
+
+	return errs
+}
+
+// matchAny returns the first submatch of the first expression matching the line, or an empty string
+func matchAny(line string, res ...*regexp.Regexp) string {
+	for _, re := range res {
+		if m := re.FindStringSubmatch(line); m != nil {
+			return m[1]
+		}
+	}
+
+	return ""
+}
+
+// trimToolPrefix removes the names of the tools at the start of the line, which might be nested as in
+// "llc: error: llc: <stdin>:3:5: error: ..."
+func trimToolPrefix(line string) string {
+	for {
+		trimmed := toolPrefix.ReplaceAllString(line, "")
+		if trimmed == line {
+			return line
+		}
+
+		line = trimmed
+	}
+}
+
+// uniqueSorted returns the sorted values without duplicates
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+
+	sort.Strings(unique)
+	return unique
+}
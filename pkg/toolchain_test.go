@@ -0,0 +1,381 @@
+package maqui
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToolchainOutput(t *testing.T) {
+	cases := []struct {
+		name   string
+		tool   string
+		output string
+		expect []CompileError
+	}{
+		{
+			"GNUUndefinedReference",
+			"cc",
+			"/usr/bin/ld: /tmp/main.o: in function `main':\n" +
+				"<stdin>:(.text+0x12): undefined reference to `foo'\n" +
+				"/usr/bin/ld: <stdin>:(.text+0x20): undefined reference to `foo'\n" +
+				"/usr/bin/ld: /tmp/main.o: in function `bar':\n" +
+				"<stdin>:(.text+0x30): undefined reference to `baz'\n" +
+				"collect2: error: ld returned 1 exit status\n",
+			[]CompileError{
+				&ToolchainError{
+					Tool:    "ld",
+					Message: "undefined symbol: foo",
+					Notes: []string{
+						"referenced in main",
+						"the symbol might be defined in a library or object file missing from the build, add it with -l or as an input file",
+					},
+				},
+				&ToolchainError{
+					Tool:    "ld",
+					Message: "undefined symbol: baz",
+					Notes: []string{
+						"referenced in bar",
+						"the symbol might be defined in a library or object file missing from the build, add it with -l or as an input file",
+					},
+				},
+			},
+		},
+		{
+			"LLDUndefinedSymbol",
+			"clang",
+			"ld.lld: error: undefined symbol: foo\n" +
+				">>> referenced by main.o\n" +
+				">>>               main.o:(main)\n" +
+				"clang: error: linker command failed with exit code 1 (use -v to see invocation)\n",
+			[]CompileError{
+				&ToolchainError{
+					Tool:    "ld.lld",
+					Message: "undefined symbol: foo",
+					Notes: []string{
+						"referenced in main.o",
+						"the symbol might be defined in a library or object file missing from the build, add it with -l or as an input file",
+					},
+				},
+			},
+		},
+		{
+			"DarwinUndefinedSymbol",
+			"clang",
+			"Undefined symbols for architecture x86_64:\n" +
+				"  \"_foo\", referenced from:\n" +
+				"      _main in main.o\n" +
+				"ld: symbol(s) not found for architecture x86_64\n",
+			[]CompileError{
+				&ToolchainError{
+					Tool:    "clang",
+					Message: "undefined symbol: foo",
+					Notes: []string{
+						"the symbol might be defined in a library or object file missing from the build, add it with -l or as an input file",
+					},
+				},
+			},
+		},
+		{
+			"MissingLibrary",
+			"cc",
+			"/usr/bin/ld: cannot find -lfoo: No such file or directory\n" +
+				"collect2: error: ld returned 1 exit status\n",
+			[]CompileError{
+				&ToolchainError{
+					Tool:    "ld",
+					Message: "library not found: foo",
+					Notes:   []string{"add the directory holding the library with -L"},
+				},
+			},
+		},
+		{
+			"MissingLibraryClang",
+			"clang",
+			"ld: library not found for -lbar\n",
+			[]CompileError{
+				&ToolchainError{
+					Tool:    "ld",
+					Message: "library not found: bar",
+					Notes:   []string{"add the directory holding the library with -L"},
+				},
+			},
+		},
+		{
+			"LLCError",
+			"llc",
+			"llc: error: llc: <stdin>:3:12: error: use of undefined value '@foo'\n" +
+				"        call void @foo()\n" +
+				"                  ^\n",
+			[]CompileError{
+				&ToolchainError{
+					Tool:    "llc",
+					Message: "<stdin>:3:12: error: use of undefined value '@foo'",
+					Notes:   []string{"call void @foo()"},
+				},
+			},
+		},
+		{
+			"NoOutput",
+			"cc",
+			"",
+			[]CompileError{
+				&ToolchainError{Tool: "cc", Message: "exit status 1"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			errs := parseToolchainOutput(c.tool, errors.New("exit status 1"), []byte(c.output))
+			assert.Equal(t, c.expect, errs)
+		})
+	}
+}
+
+func TestToolchainErrorDiagnostic(t *testing.T) {
+	d := ToolchainError{Tool: "ld", Message: "library not found: foo", Notes: []string{"a note"}}.Diagnostic()
+
+	assert.Equal(t, "error: ld: library not found: foo", d.String())
+	assert.Equal(t, "error: ld: library not found: foo\n  = note: a note", d.Format(nil))
+	assert.Empty(t, d.Code)
+}
+
+// fakeTools creates empty executables in a directory, and sets it as the only directory in PATH
+func fakeTools(t *testing.T, names ...string) string {
+	dir := t.TempDir()
+	for _, name := range names {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755))
+	}
+
+	t.Setenv("PATH", dir)
+	t.Setenv("MAQUI_CC", "")
+	return dir
+}
+
+func TestFindToolchain(t *testing.T) {
+	cases := []struct {
+		name   string
+		tools  []string
+		env    string
+		cc     string
+		expect func(dir string) *Toolchain
+		err    bool
+	}{
+		{
+			"Clang",
+			[]string{"clang", "clang-15", "llc", "cc"},
+			"", "",
+			func(dir string) *Toolchain { return &Toolchain{Clang: filepath.Join(dir, "clang")} },
+			false,
+		},
+		{
+			"NewestVersionedClang",
+			[]string{"clang-9", "clang-15", "clang-14"},
+			"", "",
+			func(dir string) *Toolchain { return &Toolchain{Clang: filepath.Join(dir, "clang-15")} },
+			false,
+		},
+		{
+			"LLCAndCC",
+			[]string{"llc-14", "llvm-as", "gcc", "cc"},
+			"", "",
+			func(dir string) *Toolchain {
+				return &Toolchain{
+					LLC:    filepath.Join(dir, "llc-14"),
+					LLVMAs: filepath.Join(dir, "llvm-as"),
+					Linker: filepath.Join(dir, "cc"),
+				}
+			},
+			false,
+		},
+		{
+			"Environment",
+			[]string{"clang", "llc", "gcc"},
+			"gcc", "",
+			func(dir string) *Toolchain {
+				return &Toolchain{LLC: filepath.Join(dir, "llc"), Linker: filepath.Join(dir, "gcc")}
+			},
+			false,
+		},
+		{
+			"FlagOverridesEnvironment",
+			[]string{"clang-13", "gcc"},
+			"gcc", "clang-13",
+			func(dir string) *Toolchain { return &Toolchain{Clang: filepath.Join(dir, "clang-13")} },
+			false,
+		},
+		{"CompilerNotFound", []string{"clang"}, "", "tcc", nil, true},
+		{"CompilerWithoutLLC", []string{"gcc"}, "", "gcc", nil, true},
+		{"LLCWithoutLinker", []string{"llc"}, "", "", nil, true},
+		{"Nothing", nil, "", "", nil, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := fakeTools(t, c.tools...)
+			t.Setenv("MAQUI_CC", c.env)
+
+			tc, err := FindToolchain(c.cc)
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, c.expect(dir), tc)
+		})
+	}
+
+	fakeTools(t)
+	_, err := FindToolchain("")
+	assert.ErrorIs(t, err, ErrNoToolchain)
+}
+
+func TestToolchainCommands(t *testing.T) {
+	link := LinkOptions{Libraries: []string{"m"}, LibraryPaths: []string{"/opt/lib"}, Inputs: []string{"a.o"}}
+
+	cases := []struct {
+		name      string
+		toolchain Toolchain
+		profile   Profile
+		emit      Emit
+		expect    [][]string
+	}{
+		{
+			"ClangExe",
+			Toolchain{Clang: "clang"},
+			ProfileDebug,
+			EmitExe,
+			[][]string{{"clang", "--target=x86_64-unknown-linux", "-O0", "-o", "out", "-x", "ir", "-", "-x", "none",
+				"a.o", "-L/opt/lib", "-lm"}},
+		},
+		{
+			"ClangObj",
+			Toolchain{Clang: "clang"},
+			ProfileDebug,
+			EmitObj,
+			[][]string{{"clang", "--target=x86_64-unknown-linux", "-O0", "-c", "-o", "out", "-x", "ir", "-"}},
+		},
+		{
+			"ClangBitcode",
+			Toolchain{Clang: "clang"},
+			ProfileDebug,
+			EmitLLVMBC,
+			[][]string{{"clang", "--target=x86_64-unknown-linux", "-O0", "-c", "-emit-llvm", "-o", "out", "-x", "ir",
+				"-"}},
+		},
+		{
+			"ClangRelease",
+			Toolchain{Clang: "clang"},
+			ProfileRelease,
+			EmitExe,
+			[][]string{{"clang", "--target=x86_64-unknown-linux", "-O2", "-o", "out", "-x", "ir", "-", "-x", "none",
+				"a.o", "-L/opt/lib", "-lm", "-s"}},
+		},
+		{
+			"LLCAsm",
+			Toolchain{LLC: "llc", Linker: "cc"},
+			ProfileDebug,
+			EmitAsm,
+			[][]string{{"llc", "-mtriple=x86_64-unknown-linux", "-O0", "-relocation-model=pic", "-filetype=asm", "-o", "out",
+				"-"}},
+		},
+		{
+			"LLVMAsBitcode",
+			Toolchain{LLC: "llc", LLVMAs: "llvm-as", Linker: "cc"},
+			ProfileDebug,
+			EmitLLVMBC,
+			[][]string{{"llvm-as", "-o", "out", "-"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cmds, cleanup, err := c.toolchain.commands(DefaultTarget, c.profile, c.emit, "out", link)
+			assert.NoError(t, err)
+			defer cleanup()
+
+			var args [][]string
+			for _, cmd := range cmds {
+				args = append(args, cmd.Args)
+			}
+
+			assert.Equal(t, c.expect, args)
+		})
+	}
+}
+
+func TestToolchainCommandsLink(t *testing.T) {
+	tc := Toolchain{LLC: "llc", Linker: "cc"}
+	cmds, cleanup, err := tc.commands(DefaultTarget, ProfileDebug, EmitExe, "out", LinkOptions{Libraries: []string{"m"}})
+	assert.NoError(t, err)
+
+	if assert.Len(t, cmds, 2) {
+		obj := cmds[0].Args[len(cmds[0].Args)-2]
+		assert.Equal(t, []string{"cc", "-o", "out", obj, "-lm"}, cmds[1].Args)
+
+		dir := filepath.Dir(obj)
+		_, err = os.Stat(dir)
+		assert.NoError(t, err)
+
+		cleanup()
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err), "the intermediate files must be removed")
+	}
+
+	cmds, cleanup, err = tc.commands(DefaultTarget, ProfileRelease, EmitExe, "out", LinkOptions{})
+	assert.NoError(t, err)
+	defer cleanup()
+
+	if assert.Len(t, cmds, 2) {
+		assert.Contains(t, cmds[0].Args, "-O2")
+		assert.Equal(t, "-s", cmds[1].Args[len(cmds[1].Args)-1], "release executables are stripped")
+	}
+
+	_, _, err = tc.commands(DefaultTarget, ProfileDebug, EmitLLVMBC, "out", LinkOptions{})
+	assert.Error(t, err, "bitcode can't be emitted without llvm-as")
+}
+
+func TestLinkerTarget(t *testing.T) {
+	cases := []struct {
+		machine string
+		expect  Target
+	}{
+		{"x86_64-linux-gnu", Target{Arch: X86_64, Vendor: Unknown, OS: Linux, Env: "gnu"}},
+		{"aarch64-apple-darwin23.1.0", Target{Arch: AArch64, Vendor: Apple, OS: Darwin}},
+		{"x86_64-w64-mingw32", Target{Arch: X86_64, Vendor: "w64", OS: Windows}},
+		{"", Target{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.machine, func(t *testing.T) {
+			cc := filepath.Join(t.TempDir(), "cc")
+			assert.NoError(t, os.WriteFile(cc, []byte("#!/bin/sh\necho '"+c.machine+"'\n"), 0o755))
+
+			assert.Equal(t, c.expect, linkerToolchain("llc", cc).LinkerTarget)
+		})
+	}
+}
+
+func TestToolchainCommandsCrossLink(t *testing.T) {
+	tc := Toolchain{LLC: "llc", Linker: "/usr/bin/cc", LinkerTarget: Target{Arch: X86_64, Vendor: PC, OS: Linux, Env: "gnu"}}
+	aarch64 := Target{Arch: AArch64, Vendor: Unknown, OS: Linux}
+
+	_, _, err := tc.commands(aarch64, ProfileDebug, EmitExe, "out", LinkOptions{})
+	assert.EqualError(t, err, "cc links executables for x86_64-pc-linux-gnu, not for aarch64-unknown-linux: use clang, "+
+		"or a C compiler for aarch64-unknown-linux in MAQUI_CC")
+
+	// Object files are built by llc for any target
+	_, cleanup, err := tc.commands(aarch64, ProfileDebug, EmitObj, "out", LinkOptions{})
+	assert.NoError(t, err)
+	cleanup()
+
+	// The vendor and the environment don't change the executables
+	_, cleanup, err = tc.commands(DefaultTarget, ProfileDebug, EmitExe, "out", LinkOptions{})
+	assert.NoError(t, err)
+	cleanup()
+}